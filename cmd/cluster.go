@@ -16,7 +16,7 @@ limitations under the License.
 package cmd
 
 import (
-	"os"
+	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/structure-projects/somcli/pkg/cluster"
@@ -34,7 +34,7 @@ var clusterCreateCmd = &cobra.Command{
 	Short: "Create a new cluster",
 	Long:  `Create a new Kubernetes or Docker Swarm cluster based on configuration file.`,
 	Args:  cobra.ExactArgs(0),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		configFile, _ := cmd.Flags().GetString("file")
 		clusterType, _ := cmd.Flags().GetString("cluster-type")
 		force, _ := cmd.Flags().GetBool("force")
@@ -42,18 +42,17 @@ var clusterCreateCmd = &cobra.Command{
 
 		// 验证配置文件存在
 		if !utils.FileExists(configFile) {
-			utils.PrintError("Config file %s does not exist", configFile)
-			os.Exit(1)
+			return fmt.Errorf("Config file %s does not exist", configFile)
 		}
 
 		// 创建集群
 		err := cluster.CreateCluster(configFile, clusterType, force, skipPrecheck)
 		if err != nil {
-			utils.PrintError("Failed to create cluster: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("Failed to create cluster: %w", err)
 		}
 
 		utils.PrintSuccess("Cluster created successfully")
+		return nil
 	},
 }
 
@@ -62,24 +61,46 @@ var clusterRemoveCmd = &cobra.Command{
 	Short: "Remove an existing cluster",
 	Long:  `Remove an existing Kubernetes or Docker Swarm cluster based on configuration file.`,
 	Args:  cobra.ExactArgs(0),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		configFile, _ := cmd.Flags().GetString("file")
 		force, _ := cmd.Flags().GetBool("force")
 
 		// 验证配置文件存在
 		if !utils.FileExists(configFile) {
-			utils.PrintError("Config file %s does not exist", configFile)
-			os.Exit(1)
+			return fmt.Errorf("Config file %s does not exist", configFile)
 		}
 
 		// 移除集群
 		err := cluster.RemoveCluster(configFile, force)
 		if err != nil {
-			utils.PrintError("Failed to remove cluster: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("Failed to remove cluster: %w", err)
 		}
 
 		utils.PrintSuccess("Cluster removed successfully")
+		return nil
+	},
+}
+
+var clusterRotateTokenCmd = &cobra.Command{
+	Use:   "rotate-token",
+	Short: "Rotate cluster join tokens",
+	Long: `Rotate the join tokens of an existing cluster so that previously issued join commands stop working.
+For Docker Swarm the worker and/or manager token is rotated; for Kubernetes all bootstrap tokens are deleted.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("file")
+		role, _ := cmd.Flags().GetString("role")
+
+		if !utils.FileExists(configFile) {
+			return fmt.Errorf("Config file %s does not exist", configFile)
+		}
+
+		if err := cluster.RotateJoinTokens(configFile, role); err != nil {
+			return fmt.Errorf("Failed to rotate join tokens: %w", err)
+		}
+
+		utils.PrintSuccess("Join tokens rotated successfully")
+		return nil
 	},
 }
 
@@ -96,9 +117,15 @@ func init() {
 	clusterRemoveCmd.Flags().Bool("force", false, "Force removal without confirmation")
 	_ = clusterRemoveCmd.MarkFlagRequired("file")
 
+	// 轮换令牌命令
+	clusterRotateTokenCmd.Flags().StringP("file", "f", "", "Cluster configuration file (required)")
+	clusterRotateTokenCmd.Flags().String("role", "all", "Swarm token to rotate (worker|manager|all)")
+	_ = clusterRotateTokenCmd.MarkFlagRequired("file")
+
 	// 添加子命令
 	clusterCmd.AddCommand(clusterCreateCmd)
 	clusterCmd.AddCommand(clusterRemoveCmd)
+	clusterCmd.AddCommand(clusterRotateTokenCmd)
 
 	// 添加到根命令
 	rootCmd.AddCommand(clusterCmd)
@@ -51,7 +51,7 @@ Examples:
   somcli docker-compose logs -f     # Passthrough with signals
   somcli docker-compose --env-file .env.prod up`,
 		DisableFlagParsing: true,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if envFile != "" {
 				if _, err := os.Stat(envFile); err == nil {
 					os.Setenv("COMPOSE_FILE", envFile)
@@ -65,9 +65,9 @@ Examples:
 
 			filteredArgs := filterArgs(args, envFile != "")
 			if err := coomposeInstall.Passthrough(filteredArgs); err != nil {
-				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
+				return err
 			}
+			return nil
 		},
 	}
 
@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
@@ -46,7 +45,7 @@ func NewDockerCmd() *cobra.Command {
 By default (without subcommands), it will install Docker on local machine.
 
 For Docker commands, just use 'somcli docker [command]' to pass through to Docker CLI.`,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			// 默认行为改为执行本地安装
 			if len(args) == 0 {
 				if !silent {
@@ -55,18 +54,17 @@ For Docker commands, just use 'somcli docker [command]' to pass through to Docke
 
 				installer := docker.NewInstaller(silent, offline)
 				if err := installer.Install(version); err != nil {
-					fmt.Printf("Error installing Docker: %v\n", err)
-					os.Exit(1)
+					return fmt.Errorf("Error installing Docker: %w", err)
 				}
-				return
+				return nil
 			}
 
 			// 如果有参数则透传给Docker CLI
 			installer := docker.NewInstaller(silent, offline)
 			if err := installer.Passthrough(args); err != nil {
-				fmt.Printf("Error executing docker command: %v\n", err)
-				os.Exit(1)
+				return fmt.Errorf("Error executing docker command: %w", err)
 			}
+			return nil
 		},
 	}
 
@@ -219,12 +217,12 @@ func getTargetNodes(nodesFile string, nodeIPs []string, user string, sshKey stri
 			})
 		}
 	}
+	utils.ApplySSHDefaults(nodes, utils.Config.SSH)
 
 	return nodes, nil
 }
 
 // loadNodesFromFile 从YAML文件加载节点配置
 func loadNodesFromFile(filePath string) ([]types.RemoteNode, error) {
-	utils.LoadConfig(filePath)
-	return nil, fmt.Errorf("YAML node config loading not implemented yet")
+	return utils.LoadNodes(filePath)
 }
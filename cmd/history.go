@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+var (
+	historyLimit      int
+	historyShowOutput bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Browse the audit log of previous runs",
+	Long: `Every somcli invocation writes a JSON lines audit log under <workdir>/logs/history, containing
+the subcommand, its flags (secrets redacted) and every local or remote command with node, exit code,
+duration and truncated output.`,
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List previous runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runs, err := utils.ListAuditRuns()
+		if err != nil {
+			return fmt.Errorf("Failed to read audit log: %w", err)
+		}
+		if len(runs) == 0 {
+			utils.PrintInfo("No runs recorded in %s", utils.AuditDir())
+			return nil
+		}
+		if historyLimit > 0 && len(runs) > historyLimit {
+			runs = runs[:historyLimit]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN ID\tSTARTED\tDURATION\tSTATUS\tCOMMANDS\tFAILED\tCOMMAND")
+		for _, runID := range runs {
+			run, err := utils.ReadAuditRun(runID)
+			if err != nil {
+				utils.PrintWarning("Skipping %s: %v", runID, err)
+				continue
+			}
+			duration := "-"
+			if run.End != nil {
+				duration = (time.Duration(run.End.DurationMS) * time.Millisecond).Round(time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+				runID, run.Start.Time.Local().Format("2006-01-02 15:04:05"), duration, run.Status(),
+				len(run.Execs), run.Failed, strings.TrimSpace(run.Start.Command+" "+strings.Join(run.Start.Args, " ")))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <run-id>",
+	Short: "Show the commands executed by a run",
+	Long: `Show the subcommand, flags and every executed command of a run. Output is printed for failed
+commands, use --output to print it for all commands.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		run, err := utils.ReadAuditRun(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Run:     %s\n", run.RunID)
+		fmt.Printf("Command: %s\n", strings.TrimSpace(run.Start.Command+" "+strings.Join(run.Start.Args, " ")))
+		if len(run.Start.Flags) > 0 {
+			names := make([]string, 0, len(run.Start.Flags))
+			for name := range run.Start.Flags {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			flags := make([]string, len(names))
+			for i, name := range names {
+				flags[i] = fmt.Sprintf("--%s=%s", name, run.Start.Flags[name])
+			}
+			fmt.Printf("Flags:   %s\n", strings.Join(flags, " "))
+		}
+		fmt.Printf("Started: %s\n", run.Start.Time.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Status:  %s\n", run.Status())
+		if run.End != nil && run.End.Error != "" {
+			fmt.Printf("Error:   %s\n", run.End.Error)
+		}
+		fmt.Println()
+
+		for i, event := range run.Execs {
+			marker := "✓"
+			if event.ExitCode != 0 {
+				marker = "✗"
+			}
+			fmt.Printf("%s #%d %s [%s] exit=%d %s\n", marker, i+1, event.Time.Local().Format("15:04:05"),
+				event.Node, event.ExitCode, time.Duration(event.DurationMS)*time.Millisecond)
+			fmt.Printf("    $ %s\n", event.Command)
+			if event.Error != "" && event.ExitCode != 0 {
+				fmt.Printf("    error: %s\n", firstLine(event.Error))
+			}
+			if event.Output != "" && (historyShowOutput || event.ExitCode != 0) {
+				for _, line := range strings.Split(strings.TrimRight(event.Output, "\n"), "\n") {
+					fmt.Printf("    | %s\n", line)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// firstLine 返回字符串的第一行
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func init() {
+	historyListCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Maximum number of runs to list (0 for all)")
+	historyShowCmd.Flags().BoolVar(&historyShowOutput, "output", false, "Print output of all commands, not only failed ones")
+
+	historyCmd.AddCommand(historyListCmd, historyShowCmd)
+	rootCmd.AddCommand(historyCmd)
+}
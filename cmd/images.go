@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/structure-projects/somcli/pkg/images"
@@ -40,7 +39,7 @@ var imagesCmd = &cobra.Command{
 var pullCmd = &cobra.Command{
 	Use:   "pull",
 	Short: "Pull images from registry",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := images.Config{
 			Scope:      scope,
 			Repo:       repo,
@@ -48,32 +47,32 @@ var pullCmd = &cobra.Command{
 			OutputFile: outputFile,
 		}
 		if err := images.Pull(config); err != nil {
-			fmt.Printf("Error pulling images: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error pulling images: %w", err)
 		}
+		return nil
 	},
 }
 
 var pushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "Push images to registry",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := images.Config{
 			Scope:     scope,
 			Repo:      repo,
 			InputFile: inputFile,
 		}
 		if err := images.Push(config); err != nil {
-			fmt.Printf("Error pushing images: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error pushing images: %w", err)
 		}
+		return nil
 	},
 }
 
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Export images to file",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := images.Config{
 			Scope:      scope,
 			Repo:       repo,
@@ -81,25 +80,25 @@ var exportCmd = &cobra.Command{
 			OutputFile: outputFile,
 		}
 		if err := images.Export(config); err != nil {
-			fmt.Printf("Error exporting images: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error exporting images: %w", err)
 		}
+		return nil
 	},
 }
 
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Import images from file",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := images.Config{
 			Scope:     scope,
 			Repo:      repo,
 			InputFile: inputFile,
 		}
 		if err := images.Import(config); err != nil {
-			fmt.Printf("Error importing images: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error importing images: %w", err)
 		}
+		return nil
 	},
 }
 
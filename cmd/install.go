@@ -19,6 +19,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"github.com/structure-projects/somcli/pkg/installer"
@@ -30,27 +31,35 @@ var (
 	installToolName   string
 	downloadConfig    string
 	quiet             bool
+	installForce      bool
+	statusConfigFile  string
 )
 
 var installCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install system tools",
 	Long: `Supported installation methods:
-- package: Use system package manager (apt/yum)
-- binary:  Install pre-built binaries
-- source:  Compile from source code
-- container: Run as container`,
+- package:   Use the node's package manager (apt-get/dnf/yum/zypper/apk)
+- binary:    Install pre-built binaries into bin_dir
+- container: Run image as container
+- manifest:  kubectl apply the resource files
+- script:    Only run pre_install and post_install scripts`,
 	Example: `  # Install single tool
   somcli install --tool k9s --method binary
   
   # Batch install from config
   somcli install -f configs/install.yaml`,
-	Run: runInstall,
+	RunE: runInstall,
 }
 
 func init() {
 	rootCmd.AddCommand(installCmd)
 	installCmd.Flags().StringVarP(&installConfigFile, "file", "f", "", "Installation config file path")
+	installCmd.Flags().BoolVar(&installForce, "force", false, "Reinstall resources already installed with the same version")
+
+	installCmd.AddCommand(installStatusCmd)
+	installStatusCmd.Flags().StringVarP(&statusConfigFile, "file", "f", "", "Installation config file path (required)")
+	installStatusCmd.MarkFlagRequired("file")
 
 	rootCmd.AddCommand(downloadCmd)
 
@@ -60,32 +69,66 @@ func init() {
 	downloadCmd.MarkFlagRequired("file")
 }
 
-func runInstall(cmd *cobra.Command, args []string) {
-	inst := installer.NewInstaller()
+func runInstall(cmd *cobra.Command, args []string) error {
+	inst := installer.NewInstaller().WithForce(installForce)
 
 	switch {
 	case installConfigFile != "":
 		if err := inst.InstallFromFile(installConfigFile, quiet); err != nil {
-			fmt.Fprintf(os.Stderr, "Batch install failed: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Batch install failed: %w", err)
 		}
 
 	default:
-		fmt.Fprintln(os.Stderr, "Error: must specify --file or --tool")
 		cmd.Help()
-		os.Exit(1)
+		return fmt.Errorf("must specify --file or --tool")
 	}
+	return nil
+}
+
+var installStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show installed resources and drift per node",
+	Long: `Compare the resources of a config with the local install state, the marker files on the nodes
+and the checksums of the installed files.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		statuses, err := installer.NewInstaller().Status(statusConfigFile)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NODE\tRESOURCE\tVERSION\tINSTALLED\tSTATUS\tDETAIL")
+		counts := make(map[string]int)
+		for _, status := range statuses {
+			installed := status.Installed
+			if installed == "" {
+				installed = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", status.Node, status.Resource, status.Desired, installed, status.Status, status.Detail)
+			counts[status.Status]++
+		}
+		w.Flush()
+
+		fmt.Printf("\nSummary: %d/%d installed", counts[installer.StatusInstalled], len(statuses))
+		for _, name := range []string{installer.StatusOutdated, installer.StatusChanged, installer.StatusDrifted, installer.StatusMarkerMissing, installer.StatusUnreachable} {
+			if counts[name] > 0 {
+				fmt.Printf(", %d %s", counts[name], name)
+			}
+		}
+		fmt.Println()
+		return nil
+	},
 }
 
 var downloadCmd = &cobra.Command{
 	Use:   "download",
 	Short: "Download offline resources",
 	Long:  `Download all required resources based on configuration file`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := executeOfflineDownload(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			return err
 		}
+		return nil
 	},
 }
 
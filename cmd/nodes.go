@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+var nodesFile string
+
+var nodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "Manage remote nodes",
+	Long:  `Manage the remote nodes used by somcli, such as trusting their SSH host keys.`,
+}
+
+var nodesTrustCmd = &cobra.Command{
+	Use:   "trust [host...]",
+	Short: "Record SSH host keys of nodes in known_hosts",
+	Long: `Connect to each node of the inventory, fetch its SSH host key and record it in the somcli
+managed known_hosts file. Nodes are read from the file given by -f (top-level "nodes" or a cluster
+configuration), or from the global somcli config when -f is omitted. Hosts given as arguments limit
+the operation to those nodes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodes := utils.GetNodes()
+		if nodesFile != "" {
+			var err error
+			if nodes, err = utils.LoadNodes(nodesFile); err != nil {
+				return fmt.Errorf("Failed to load nodes from %s: %w", nodesFile, err)
+			}
+		}
+
+		nodes = filterNodes(nodes, args)
+		if len(nodes) == 0 {
+			return fmt.Errorf("No nodes to trust")
+		}
+
+		failed := 0
+		for i := range nodes {
+			node := &nodes[i]
+			address := node.IP
+			if address == "" {
+				address = node.Host
+			}
+
+			fingerprint, added, err := utils.TrustHostKey(node)
+			switch {
+			case err != nil:
+				utils.PrintError("%s (%s): %v", node.Host, address, err)
+				failed++
+			case added:
+				utils.PrintSuccess("%s (%s): trusted %s", node.Host, address, fingerprint)
+			default:
+				utils.PrintInfo("%s (%s): already trusted %s", node.Host, address, fingerprint)
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d nodes could not be trusted", failed, len(nodes))
+		}
+		utils.PrintSuccess("Host keys saved to %s", utils.KnownHostsFile())
+		return nil
+	},
+}
+
+// filterNodes 按主机名或 IP 过滤节点，未指定时返回全部
+func filterNodes(nodes []types.RemoteNode, hosts []string) []types.RemoteNode {
+	if len(hosts) == 0 {
+		return nodes
+	}
+
+	var result []types.RemoteNode
+	for _, node := range nodes {
+		for _, host := range hosts {
+			if node.Host == host || node.IP == host {
+				result = append(result, node)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func init() {
+	nodesTrustCmd.Flags().StringVarP(&nodesFile, "file", "f", "", "Node inventory or cluster configuration file")
+
+	nodesCmd.AddCommand(nodesTrustCmd)
+	rootCmd.AddCommand(nodesCmd)
+}
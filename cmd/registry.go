@@ -51,7 +51,7 @@ var registryInstallCmd = &cobra.Command{
 		}
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		manager := registry.NewHarborManager(
 			harborVersion,
 			harborHost,
@@ -60,10 +60,10 @@ var registryInstallCmd = &cobra.Command{
 		)
 
 		if err := manager.Install(); err != nil {
-			fmt.Printf("Error installing Harbor: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error installing Harbor: %w", err)
 		}
 		fmt.Printf("Harbor installed successfully at %s\n", harborHost)
+		return nil
 	},
 }
 
@@ -79,7 +79,7 @@ var unInstallCmd = &cobra.Command{
 		}
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		manager := registry.NewHarborManager(
 			harborVersion,
 			harborHost,
@@ -88,10 +88,10 @@ var unInstallCmd = &cobra.Command{
 		)
 
 		if err := manager.Uninstall(); err != nil {
-			fmt.Printf("Error UnInstall Harbor: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error UnInstall Harbor: %w", err)
 		}
 		fmt.Printf("Harbor UnInstalled successfully at %s\n", harborHost)
+		return nil
 	},
 }
 
@@ -120,12 +120,11 @@ var syncCmd = &cobra.Command{
 		}
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if password == "" {
 			password = os.Getenv("REGISTRY_PASSWORD")
 			if password == "" {
-				fmt.Println("Error: password must be provided via -p flag or REGISTRY_PASSWORD environment variable")
-				os.Exit(1)
+				return fmt.Errorf("password must be provided via -p flag or REGISTRY_PASSWORD environment variable")
 			}
 		}
 
@@ -139,20 +138,18 @@ var syncCmd = &cobra.Command{
 
 		images, err := readImageList(imageList)
 		if err != nil {
-			fmt.Printf("Error reading image list: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error reading image list: %w", err)
 		}
 
 		if len(images) == 0 {
-			fmt.Println("No images found in the image list file")
-			os.Exit(1)
+			return fmt.Errorf("No images found in the image list file")
 		}
 
 		if err := syncer.SyncAll(images); err != nil {
-			fmt.Printf("Error syncing images: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("Error syncing images: %w", err)
 		}
 		fmt.Println("Image sync completed successfully")
+		return nil
 	},
 }
 
@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/structure-projects/somcli/pkg/cluster"
@@ -29,6 +28,7 @@ var (
 	allNamespaces bool
 	namespace     string
 	outputFormat  string
+	createOpts    resources.SwarmCreateOptions
 )
 
 var getCmd = &cobra.Command{
@@ -36,20 +36,19 @@ var getCmd = &cobra.Command{
 	Short: "Get resources",
 	Long:  `Get resources from Kubernetes, Docker Swarm or Docker clusters.`,
 	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		resourceType := args[0]
 		clusterType := cluster.DetectClusterType()
 		if clusterType == cluster.TypeNone {
-			utils.PrintError("No supported cluster detected")
-			os.Exit(1)
+			return fmt.Errorf("No supported cluster detected")
 		}
 		result, err := resources.GetResources(clusterType, resourceType, namespace, allNamespaces, outputFormat)
 		if err != nil {
-			utils.PrintError("Failed to get resources: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("Failed to get resources: %w", err)
 		}
 
 		fmt.Println(result)
+		return nil
 	},
 }
 
@@ -58,20 +57,19 @@ var applyCmd = &cobra.Command{
 	Short: "Apply configuration",
 	Long:  `Apply configuration to Kubernetes, Docker Swarm or Docker clusters.`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		file := args[0]
 		clusterType := cluster.DetectClusterType()
 		if clusterType == cluster.TypeNone {
-			utils.PrintError("No supported cluster detected")
-			os.Exit(1)
+			return fmt.Errorf("No supported cluster detected")
 		}
 
 		if err := resources.ApplyResources(clusterType, file); err != nil {
-			utils.PrintError("Failed to apply resources: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("Failed to apply resources: %w", err)
 		}
 
 		utils.PrintSuccess("Resources applied successfully")
+		return nil
 	},
 }
 
@@ -80,21 +78,20 @@ var deleteCmd = &cobra.Command{
 	Short: "Delete resources",
 	Long:  `Delete resources from Kubernetes, Docker Swarm or Docker clusters.`,
 	Args:  cobra.MinimumNArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		resourceType := args[0]
 		resourceName := args[1]
 		clusterType := cluster.DetectClusterType()
 		if clusterType == cluster.TypeNone {
-			utils.PrintError("No supported cluster detected")
-			os.Exit(1)
+			return fmt.Errorf("No supported cluster detected")
 		}
 
 		if err := resources.DeleteResource(clusterType, resourceType, resourceName, namespace); err != nil {
-			utils.PrintError("Failed to delete resource: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("Failed to delete resource: %w", err)
 		}
 
 		utils.PrintSuccess("Resource deleted successfully")
+		return nil
 	},
 }
 
@@ -104,26 +101,60 @@ var describeCmd = &cobra.Command{
 	Short: "Show details of a specific resource",
 	Long:  `Show detailed information about a specific resource in Kubernetes, Docker Swarm or Docker clusters.`,
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		resourceType := args[0]
 		resourceName := args[1]
 		clusterType := cluster.DetectClusterType()
 		if clusterType == cluster.TypeNone {
-			utils.PrintError("No supported cluster detected")
-			os.Exit(1)
+			return fmt.Errorf("No supported cluster detected")
 		}
 
 		result, err := resources.DescribeResource(clusterType, resourceType, resourceName, namespace)
 		if err != nil {
-			utils.PrintError("Failed to describe resource: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("Failed to describe resource: %w", err)
 		}
 
 		fmt.Println(result)
+		return nil
+	},
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create <type> <name>",
+	Short: "Create a resource",
+	Long: `Create Docker Swarm secrets, configs, networks or volumes.
+Examples:
+  somcli create secret db_password --from-literal 's3cret'
+  somcli create config nginx_conf --from-file ./nginx.conf
+  somcli create network backend --attachable --subnet 10.30.0.0/24
+  somcli create volume data`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resourceType := args[0]
+		resourceName := args[1]
+		clusterType := cluster.DetectClusterType()
+		if clusterType == cluster.TypeNone {
+			return fmt.Errorf("No supported cluster detected")
+		}
+
+		if err := resources.CreateResource(clusterType, resourceType, resourceName, createOpts); err != nil {
+			return fmt.Errorf("Failed to create resource: %w", err)
+		}
+
+		utils.PrintSuccess("Resource created successfully")
+		return nil
 	},
 }
 
 func init() {
+	// create 命令标志
+	createCmd.Flags().StringVar(&createOpts.FromFile, "from-file", "", "Read secret/config content from file")
+	createCmd.Flags().StringVar(&createOpts.FromLiteral, "from-literal", "", "Secret/config content")
+	createCmd.Flags().StringSliceVarP(&createOpts.Labels, "label", "l", nil, "Labels (key=value)")
+	createCmd.Flags().StringVarP(&createOpts.Driver, "driver", "d", "", "Network or volume driver")
+	createCmd.Flags().BoolVar(&createOpts.Attachable, "attachable", false, "Allow standalone containers to attach to the network")
+	createCmd.Flags().StringSliceVar(&createOpts.Subnets, "subnet", nil, "Network subnets in CIDR format")
+
 	// get 命令标志
 	getCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "All namespaces")
 	getCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace")
@@ -135,4 +166,5 @@ func init() {
 	rootCmd.AddCommand(applyCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(createCmd)
 }
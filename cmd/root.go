@@ -18,9 +18,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/structure-projects/somcli/pkg/utils"
 )
@@ -38,22 +42,61 @@ var rootCmd = &cobra.Command{
 	Short: "Structure-Projects Container Management CLI",
 	Long: `somcli is a unified management tool for container technologies including 
 Docker, Docker Compose, Docker Swarm and Kubernetes.`,
+	// 错误由 Execute 在写入审计日志后统一输出
+	SilenceErrors: true,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// 参数校验已通过，命令执行失败时不再输出用法
+		cmd.SilenceUsage = true
 		// 设置调试模式
 		utils.SetDebugMode(debugMode)
 
 		utils.SetOffline(offline)
 		// 初始化配置必须在所有命令执行前完成
 		initConfig()
+		startAudit(cmd, args)
 	},
 }
 
+// startAudit 开始记录本次运行的审计日志，查看历史和帮助类命令不记录
+func startAudit(cmd *cobra.Command, args []string) {
+	if parts := strings.Fields(cmd.CommandPath()); len(parts) > 1 {
+		switch parts[1] {
+		case "history", "help", "version", "completion":
+			return
+		}
+	}
+
+	flags := make(map[string]string)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	utils.StartAudit(cmd.CommandPath(), args, flags)
+}
+
 func Execute() {
 	// 添加所有子命令
 	addSubcommands()
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	// 收到中断信号时终止执行中的命令并关闭 SSH 连接池后退出
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		utils.CancelRunningCommands(3 * time.Second)
+		utils.CloseSSHPool()
+		utils.FinishAudit(fmt.Errorf("interrupted by %s", sig))
+		if s, ok := sig.(syscall.Signal); ok {
+			os.Exit(128 + int(s))
+		}
+		os.Exit(1)
+	}()
+
+	// 命令通过 RunE 返回错误，不直接 os.Exit，保证连接池关闭并写入审计日志的 end 事件
+	err := rootCmd.Execute()
+	utils.CloseSSHPool()
+	utils.FinishAudit(err)
+	if err != nil {
+		utils.PrintError("%v", err)
 		os.Exit(1)
 	}
 }
@@ -74,6 +117,9 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&debugMode, "debug", false, "enable debug mode")                                // 新增debug标志
 	rootCmd.PersistentFlags().BoolVar(&source, "source", false, "Mirror sources (comma-separated or multiple flags)") //  Mirror source
 	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "enable 离线模式")                                      // 新增debug标志 Mirror source
+	rootCmd.PersistentFlags().String("host-key-checking", "", "SSH host key checking mode (strict|tofu|insecure, default tofu)")
+	rootCmd.PersistentFlags().String("known-hosts", "", "somcli managed known_hosts file (default is $HOME/.somcli/known_hosts)")
+	rootCmd.PersistentFlags().Duration("command-timeout", 0, "timeout for long running node commands such as installs (0 means no timeout)")
 
 	// 绑定viper
 	viper.BindPFlag("github_proxy", rootCmd.PersistentFlags().Lookup("github-proxy"))
@@ -81,6 +127,9 @@ func init() {
 	viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))           // 绑定debug到viper
 	viper.BindPFlag("mirrors_source", rootCmd.PersistentFlags().Lookup("source")) // 绑定debug到viper
 	viper.BindPFlag("offline", rootCmd.PersistentFlags().Lookup("offline"))       // 绑定debug到viper
+	viper.BindPFlag("host_key_checking", rootCmd.PersistentFlags().Lookup("host-key-checking"))
+	viper.BindPFlag("known_hosts", rootCmd.PersistentFlags().Lookup("known-hosts"))
+	viper.BindPFlag("command_timeout", rootCmd.PersistentFlags().Lookup("command-timeout"))
 }
 
 func initConfig() {
@@ -106,9 +155,11 @@ func initConfig() {
 		if err := viper.Unmarshal(&utils.Config); err != nil {
 			utils.PrintError("Failed to parse config: %v", err)
 		}
+		utils.ApplySSHDefaults(utils.Config.Nodes, utils.Config.SSH)
 
+		// 配置中含有密码、私钥密码等敏感信息，只输出概要
 		if utils.IsDebugMode() {
-			fmt.Printf("Loaded config: %+v\n", utils.Config)
+			fmt.Printf("Loaded config: %d resources, %d nodes\n", len(utils.Config.Resources), len(utils.Config.Nodes))
 		}
 	}
 	verifyProxyConfig()
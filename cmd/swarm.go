@@ -0,0 +1,227 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/structure-projects/somcli/pkg/cluster"
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+var (
+	swarmConfigFile  string
+	swarmForce       bool
+	swarmLabelAdd    []string
+	swarmLabelRm     []string
+	swarmUnlockKey   string
+	swarmRestoreFrom string
+	swarmRestoreNode string
+	swarmNoRejoin    bool
+)
+
+var swarmCmd = &cobra.Command{
+	Use:   "swarm",
+	Short: "Manage Docker Swarm clusters",
+	Long:  `Manage Docker Swarm clusters created by somcli. Commands run on the manager node over SSH.`,
+}
+
+var swarmNodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Manage swarm nodes",
+	Long: `Manage swarm nodes by the hostname defined in the cluster configuration.
+Examples:
+  somcli swarm node promote swarm-wrk-01 -f swarm-cluster.yaml
+  somcli swarm node demote swarm-mgr-02 -f swarm-cluster.yaml
+  somcli swarm node drain swarm-wrk-01 -f swarm-cluster.yaml
+  somcli swarm node label swarm-wrk-01 --add zone=a --rm disk -f swarm-cluster.yaml`,
+}
+
+var swarmNodePromoteCmd = &cobra.Command{
+	Use:   "promote <host>",
+	Short: "Promote a worker node to manager",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if err := cluster.PromoteSwarmNode(config, args[0]); err != nil {
+			return fmt.Errorf("Failed to promote node: %w", err)
+		}
+		utils.PrintSuccess("Node %s promoted to manager", args[0])
+		return nil
+	},
+}
+
+var swarmNodeDemoteCmd = &cobra.Command{
+	Use:   "demote <host>",
+	Short: "Demote a manager node to worker",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if err := cluster.DemoteSwarmNode(config, args[0], swarmForce); err != nil {
+			return fmt.Errorf("Failed to demote node: %w", err)
+		}
+		utils.PrintSuccess("Node %s demoted to worker", args[0])
+		return nil
+	},
+}
+
+var swarmNodeDrainCmd = &cobra.Command{
+	Use:   "drain <host>",
+	Short: "Drain a node so no tasks are scheduled on it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if err := cluster.SetSwarmNodeAvailability(config, args[0], "drain"); err != nil {
+			return fmt.Errorf("Failed to drain node: %w", err)
+		}
+		utils.PrintSuccess("Node %s drained", args[0])
+		return nil
+	},
+}
+
+var swarmNodeActivateCmd = &cobra.Command{
+	Use:   "activate <host>",
+	Short: "Make a drained or paused node schedulable again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if err := cluster.SetSwarmNodeAvailability(config, args[0], "active"); err != nil {
+			return fmt.Errorf("Failed to activate node: %w", err)
+		}
+		utils.PrintSuccess("Node %s activated", args[0])
+		return nil
+	},
+}
+
+var swarmNodeLabelCmd = &cobra.Command{
+	Use:   "label <host>",
+	Short: "Add or remove node labels",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if err := cluster.UpdateSwarmNodeLabels(config, args[0], swarmLabelAdd, swarmLabelRm); err != nil {
+			return fmt.Errorf("Failed to update node labels: %w", err)
+		}
+		utils.PrintSuccess("Node %s labels updated", args[0])
+		return nil
+	},
+}
+
+var swarmBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up swarm raft state",
+	Long: `Back up /var/lib/docker/swarm from a non-leader manager.
+Docker is stopped on that manager only while the archive is created, so quorum holds.
+The archive is copied to <workdir>/backup.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if _, err := cluster.BackupSwarm(config, swarmUnlockKey); err != nil {
+			return fmt.Errorf("Failed to back up swarm: %w", err)
+		}
+		return nil
+	},
+}
+
+var swarmRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a swarm from backup or recover lost quorum",
+	Long: `Restore swarm state on a manager and re-initialize it with --force-new-cluster.
+Without --from, the manager's existing state is used, which recovers a swarm that lost quorum.
+Other managers then leave and rejoin one at a time.
+Examples:
+  somcli swarm restore --node swarm-mgr-01 --from somwork/backup/swarm-backup-my-swarm-20250101-120000.tar.gz -f swarm-cluster.yaml
+  somcli swarm restore --node swarm-mgr-01 -f swarm-cluster.yaml`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadSwarmConfig()
+		if err != nil {
+			return err
+		}
+		if err := cluster.RestoreSwarm(config, swarmRestoreNode, swarmRestoreFrom, swarmUnlockKey, !swarmNoRejoin); err != nil {
+			return fmt.Errorf("Failed to restore swarm: %w", err)
+		}
+		utils.PrintSuccess("Swarm restored successfully")
+		return nil
+	},
+}
+
+// loadSwarmConfig 加载并校验 swarm 集群配置
+func loadSwarmConfig() (*types.ClusterConfig, error) {
+	if !utils.FileExists(swarmConfigFile) {
+		return nil, fmt.Errorf("Config file %s does not exist", swarmConfigFile)
+	}
+
+	config, err := cluster.LoadConfig(swarmConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load config: %w", err)
+	}
+
+	if config.Cluster.Type != cluster.TypeSwarm {
+		return nil, fmt.Errorf("Cluster %s is not a swarm cluster (type: %s)", config.Cluster.Name, config.Cluster.Type)
+	}
+
+	return config, nil
+}
+
+func init() {
+	swarmCmd.PersistentFlags().StringVarP(&swarmConfigFile, "file", "f", "", "Cluster configuration file (required)")
+	_ = swarmCmd.MarkPersistentFlagRequired("file")
+
+	swarmNodeDemoteCmd.Flags().BoolVar(&swarmForce, "force", false, "Allow demoting below the recommended number of managers")
+	swarmNodeLabelCmd.Flags().StringSliceVar(&swarmLabelAdd, "add", nil, "Labels to add (key=value)")
+	swarmNodeLabelCmd.Flags().StringSliceVar(&swarmLabelRm, "rm", nil, "Label keys to remove")
+
+	swarmBackupCmd.Flags().StringVar(&swarmUnlockKey, "unlock-key", "", "Unlock key for swarms with autolock enabled")
+	swarmRestoreCmd.Flags().StringVar(&swarmUnlockKey, "unlock-key", "", "Unlock key for swarms with autolock enabled")
+	swarmRestoreCmd.Flags().StringVar(&swarmRestoreFrom, "from", "", "Backup archive to restore (default: use the node's current state)")
+	swarmRestoreCmd.Flags().StringVar(&swarmRestoreNode, "node", "", "Manager host to restore on (required)")
+	swarmRestoreCmd.Flags().BoolVar(&swarmNoRejoin, "no-rejoin", false, "Do not rejoin the other managers after restore")
+	_ = swarmRestoreCmd.MarkFlagRequired("node")
+
+	swarmNodeCmd.AddCommand(swarmNodePromoteCmd)
+	swarmNodeCmd.AddCommand(swarmNodeDemoteCmd)
+	swarmNodeCmd.AddCommand(swarmNodeDrainCmd)
+	swarmNodeCmd.AddCommand(swarmNodeActivateCmd)
+	swarmNodeCmd.AddCommand(swarmNodeLabelCmd)
+
+	swarmCmd.AddCommand(swarmNodeCmd)
+	swarmCmd.AddCommand(swarmBackupCmd)
+	swarmCmd.AddCommand(swarmRestoreCmd)
+
+	// 添加到根命令
+	rootCmd.AddCommand(swarmCmd)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/structure-projects/somcli/pkg/installer"
+)
+
+var (
+	uninstallConfigFile string
+	uninstallAll        bool
+)
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall [resource]",
+	Short: "Uninstall resources installed from a config file",
+	Long: `Run the remove_scripts of a resource on its hosts, undo the install method (remove binaries,
+packages, containers or manifests) and delete the files listed in its install record.
+Only hosts with an install record are touched; other hosts are skipped with a warning.
+With --all every resource of the config is uninstalled in reverse install order.`,
+	Example: `  # Uninstall a single resource
+  somcli uninstall containerd -f configs/kubernetes-cluster.yaml
+
+  # Uninstall everything defined in the config
+  somcli uninstall --all -f configs/kubernetes-cluster.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runUninstall,
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+	uninstallCmd.Flags().StringVarP(&uninstallConfigFile, "file", "f", "", "Installation config file path (required)")
+	uninstallCmd.Flags().BoolVar(&uninstallAll, "all", false, "Uninstall all resources in the config")
+
+	uninstallCmd.MarkFlagRequired("file")
+}
+
+func runUninstall(cmd *cobra.Command, args []string) error {
+	inst := installer.NewInstaller()
+
+	switch {
+	case uninstallAll && len(args) == 0:
+		if err := inst.UninstallFromFile(uninstallConfigFile); err != nil {
+			return fmt.Errorf("Batch uninstall failed: %w", err)
+		}
+
+	case !uninstallAll && len(args) == 1:
+		if err := inst.UninstallTool(uninstallConfigFile, args[0]); err != nil {
+			return fmt.Errorf("Uninstall failed: %w", err)
+		}
+
+	default:
+		cmd.Help()
+		return fmt.Errorf("specify either a resource name or --all")
+	}
+	return nil
+}
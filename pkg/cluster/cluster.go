@@ -57,3 +57,20 @@ func RemoveCluster(configFile string, force bool) error {
 		return fmt.Errorf("unsupported cluster type: %s", config.Cluster.Type)
 	}
 }
+
+// RotateJoinTokens 轮换集群加入令牌，使已泄露的加入命令失效
+func RotateJoinTokens(configFile, role string) error {
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	switch config.Cluster.Type {
+	case "k8s":
+		return RotateK8sJoinTokens(config)
+	case "swarm":
+		return RotateSwarmJoinTokens(config, role)
+	default:
+		return fmt.Errorf("unsupported cluster type: %s", config.Cluster.Type)
+	}
+}
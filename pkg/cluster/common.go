@@ -25,6 +25,16 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// executor 集群编排使用的执行器，测试时通过 SetExecutor 替换
+var executor utils.Executor = utils.NewNodeExecutor()
+
+// SetExecutor 设置集群编排使用的执行器，返回原执行器以便恢复
+func SetExecutor(e utils.Executor) utils.Executor {
+	previous := executor
+	executor = e
+	return previous
+}
+
 // LoadConfig 加载集群配置文件
 func LoadConfig(configFile string) (*types.ClusterConfig, error) {
 	data, err := os.ReadFile(configFile)
@@ -45,6 +55,9 @@ func LoadConfig(configFile string) (*types.ClusterConfig, error) {
 	if len(config.Cluster.Nodes) == 0 {
 		return nil, fmt.Errorf("at least one node must be specified")
 	}
+	utils.ApplySSHDefaults(config.Cluster.Nodes, config.Cluster.SSH)
+	// 集群节点加入节点清单并替换同名或同 IP 的全局节点，安装资源时 hosts 中的 IP 解析到这些节点
+	utils.AddNodes(config.Cluster.Nodes)
 
 	return &config, nil
 }
@@ -95,7 +108,7 @@ func configureFirewall(node *types.RemoteNode) error {
 	}
 
 	for _, cmd := range commands {
-		if output, err := utils.RunCommandOnNode(node, cmd); err != nil {
+		if output, err := executor.Run(node, cmd); err != nil {
 			utils.PrintWarning("Firewall command failed on node %s: %v\nOutput: %s", node.Host, err, output)
 			return fmt.Errorf("firewall configuration failed")
 		}
@@ -113,7 +126,7 @@ func configureHostsFile(node *types.RemoteNode, entries string) error {
 	hostsContent := fmt.Sprintf("\n%s\n%s\n%s\n", markerStart, entries, markerEnd)
 
 	// 1. 备份原有hosts文件
-	if _, err := utils.RunCommandOnNode(node, "cp /etc/hosts /etc/hosts.bak"); err != nil {
+	if _, err := executor.Run(node, "cp /etc/hosts /etc/hosts.bak"); err != nil {
 		return fmt.Errorf("failed to backup hosts file: %w", err)
 	}
 
@@ -121,19 +134,19 @@ func configureHostsFile(node *types.RemoteNode, entries string) error {
 	cleanCmd := fmt.Sprintf("sed -i '/%s/,/%s/d' /etc/hosts",
 		strings.ReplaceAll(markerStart, "#", `\#`),
 		strings.ReplaceAll(markerEnd, "#", `\#`))
-	if _, err := utils.RunCommandOnNode(node, cleanCmd); err != nil {
+	if _, err := executor.Run(node, cleanCmd); err != nil {
 		return fmt.Errorf("failed to clean old hosts entries: %w", err)
 	}
 
 	// 3. 添加新配置
 	cmd := fmt.Sprintf(`echo "%s" >> /etc/hosts`, strings.ReplaceAll(hostsContent, "\"", "\\\""))
-	if _, err := utils.RunCommandOnNode(node, cmd); err != nil {
+	if _, err := executor.Run(node, cmd); err != nil {
 		return fmt.Errorf("failed to update hosts file: %w", err)
 	}
 
 	// 4. 验证配置
 	verifyCmd := fmt.Sprintf("grep -q '%s' /etc/hosts || echo 'failed'", markerStart)
-	if output, err := utils.RunCommandOnNode(node, verifyCmd); err != nil || strings.TrimSpace(output) == "failed" {
+	if output, err := executor.Run(node, verifyCmd); err != nil || strings.TrimSpace(output) == "failed" {
 		return fmt.Errorf("hosts file verification failed")
 	}
 
@@ -96,7 +96,7 @@ func CreateK8sCluster(config *types.ClusterConfig, force bool, skipPrecheck bool
 
 	// 4. 工作节点加入
 	utils.PrintStage("== 工作节点加入 ==")
-	if err := joinWorkerNodes(config); err != nil {
+	if err := joinWorkerNodes(config, masterNode); err != nil {
 		utils.PrintError("工作节点加入失败: %v", err)
 		return fmt.Errorf("工作节点加入失败: %w", err)
 	}
@@ -166,15 +166,13 @@ func installDocker(config *types.ClusterConfig, hosts []string) error {
 		URLs: []string{
 			"https://download.docker.com/linux/static/stable/x86_64/docker-{{.Version}}.tgz",
 		},
-		PostInstall: []string{
-			" tar xzvf {{.CacheDir}}/{{.Name}}-{{.Version}}.tgz -C /usr/local/bin",
-			" chmod +x /usr/local/bin/docker*",
+		PostInstall: types.NewScripts(
 			" groupadd docker || true",
 			" usermod -aG docker $USER",
 			" mkdir -p /etc/docker",
 			" systemctl enable docker",
 			" systemctl start docker",
-		},
+		),
 		ExtraFiles: map[string]string{
 			"/etc/docker/daemon.json": `{
                 "exec-opts": ["native.cgroupdriver=systemd"],
@@ -187,7 +185,7 @@ func installDocker(config *types.ClusterConfig, hosts []string) error {
 		Target: "{{.Name}}-{{.Version}}.tgz",
 	}
 
-	installer := installer.NewInstaller()
+	installer := installer.NewInstaller().WithExecutor(executor)
 
 	return installer.Install(dockerResource, true)
 }
@@ -196,26 +194,25 @@ func installDocker(config *types.ClusterConfig, hosts []string) error {
 func installContainerd(config *types.ClusterConfig, hosts []string) error {
 	utils.PrintInfo("正在安装Containerd...")
 
-	installer := installer.NewInstaller()
+	installer := installer.NewInstaller().WithExecutor(executor)
 
-	// 定义CNI资源
+	// 定义CNI插件资源，名称与containerd不同，安装记录和下载缓存互不覆盖
 	cniResource := types.Resource{
-		Name:    "containerd",
+		Name:    "cni-plugins",
 		Version: config.Cluster.K8sConfig.CniPluginsVersion,
 		Method:  "binary",
 		URLs: []string{
 			"https://github.com/containernetworking/plugins/releases/download/v{{.Version}}/cni-plugins-linux-amd64-v{{.Version}}.tgz",
 		},
-		PostInstall: []string{
-			" mkdir -p /opt/cni/bin",
-			" tar Cxzvf /opt/cni/bin {{.CacheDir}}/cni-plugins-linux-amd64-v{{.Version}}.tgz",
-		},
+		BinDir: "/opt/cni/bin",
 		Hosts:  hosts,
 		Target: "{{.Filename}}",
 	}
-	installer.Install(cniResource, false)
+	if err := installer.Install(cniResource, false); err != nil {
+		return fmt.Errorf("安装CNI插件失败: %w", err)
+	}
 
-	// 定义Containerd资源
+	// 定义runc资源
 	runcResource := types.Resource{
 		Name:    "runc",
 		Version: config.Cluster.K8sConfig.RuncVersion,
@@ -223,14 +220,13 @@ func installContainerd(config *types.ClusterConfig, hosts []string) error {
 		URLs: []string{
 			"https://github.com/opencontainers/runc/releases/download/v{{.Version}}/runc.amd64",
 		},
-		PostInstall: []string{
-			" install -m 755 {{.CacheDir}}/runc.amd64 /usr/local/sbin/runc",
-		},
+		BinDir: "/usr/local/sbin",
 		Hosts:  hosts,
 		Target: "{{.Filename}}",
 	}
-
-	installer.Install(runcResource, false)
+	if err := installer.Install(runcResource, false); err != nil {
+		return fmt.Errorf("安装runc失败: %w", err)
+	}
 
 	// 定义Containerd资源
 	containerdResource := types.Resource{
@@ -240,16 +236,15 @@ func installContainerd(config *types.ClusterConfig, hosts []string) error {
 		URLs: []string{
 			"https://github.com/containerd/containerd/releases/download/v{{.Version}}/containerd-{{.Version}}-linux-amd64.tar.gz",
 		},
-		PostInstall: []string{
-			"tar Cxzvf /usr/local {{.CacheDir}}/containerd-{{.Version}}-linux-amd64.tar.gz",
+		PostInstall: types.NewScripts(
 			"mkdir -p /etc/containerd",
 			"containerd config default |  tee /etc/containerd/config.toml >/dev/null",
-			"sed -i 's|k8s.gcr.io|" + config.Cluster.K8sConfig.ImageRepository + "|g' /etc/containerd/config.toml",
+			"sed -i 's|k8s.gcr.io|"+config.Cluster.K8sConfig.ImageRepository+"|g' /etc/containerd/config.toml",
 			fmt.Sprintf(" sed -i 's|sandbox_image = \".*\"|sandbox_image = \"%s/pause:%s\"|g' /etc/containerd/config.toml",
 				config.Cluster.K8sConfig.ImageRepository, config.Cluster.K8sConfig.PauseImageVersion),
 			"systemctl daemon-reload",
 			"systemctl enable --now containerd",
-		},
+		),
 		ExtraFiles: map[string]string{
 			"/etc/systemd/system/containerd.service": containerdServiceTemplate,
 		},
@@ -257,7 +252,10 @@ func installContainerd(config *types.ClusterConfig, hosts []string) error {
 		Target: "{{.Filename}}",
 	}
 
-	return installer.Install(containerdResource, false)
+	if err := installer.Install(containerdResource, false); err != nil {
+		return fmt.Errorf("安装Containerd失败: %w", err)
+	}
+	return nil
 }
 
 // installK8sComponents 安装Kubernetes组件
@@ -277,20 +275,17 @@ func installK8sComponents(config *types.ClusterConfig, hosts []string) error {
 			"https://dl.k8s.io/v{{.Version}}/bin/linux/amd64/kubectl",
 			"https://structured.oss-cn-beijing.aliyuncs.com/somwork/service/kubelet.service",
 		},
-		PostInstall: []string{
-			" install -o root -g root -m 0755 {{.CacheDir}}/kubeadm /usr/local/bin/kubeadm",
-			" install -o root -g root -m 0755 {{.CacheDir}}/kubelet /usr/local/bin/kubelet",
-			" install -o root -g root -m 0755 {{.CacheDir}}/kubectl /usr/local/bin/kubectl",
+		PostInstall: types.NewScripts(
 			" mkdir -p /etc/systemd/system/kubelet.service.d",
 			" install -o root -g root -m 0644 {{.CacheDir}}/kubelet.service /etc/systemd/system/kubelet.service",
 			" systemctl daemon-reload",
 			" systemctl enable --now kubelet",
-		},
+		),
 		Hosts:  hosts,
 		Target: "{{.Filename}}",
 	}
 
-	installer := installer.NewInstaller()
+	installer := installer.NewInstaller().WithExecutor(executor)
 	return installer.Install(k8sResource, false)
 }
 
@@ -326,26 +321,20 @@ func initK8sMaster(node *types.RemoteNode, config *types.ClusterConfig) error {
 	utils.PrintInfo("  %s", initCmd)
 
 	startTime := time.Now()
-	output, err := utils.RunCommandOnNode(node, initCmd)
+	result, err := executor.Stream(utils.RootContext(), node, initCmd, utils.StreamOptions{})
 	if err != nil {
 		utils.PrintError("主节点初始化失败: %v", err)
-		utils.PrintDebug("命令输出:\n%s", output)
-		return fmt.Errorf("主节点初始化失败: %w\n输出: %s", err, output)
+		return fmt.Errorf("主节点初始化失败: %w", err)
 	}
 
-	joinCommand := extractJoinCommand(output)
-	if joinCommand == "" {
+	if extractJoinCommand(result.Output) == "" {
 		err := fmt.Errorf("无法从kubeadm init输出中提取加入命令")
 		utils.PrintError("提取加入命令失败: %v", err)
 		return err
 	}
 
-	joinFile := filepath.Join(utils.GetWorkTmpDir(), config.Cluster.Name+"_k8s-join-command.txt")
-	if err := utils.WriteStringToFile(joinFile, joinCommand); err != nil {
-		utils.PrintError("保存加入命令失败: %v", err)
-		return fmt.Errorf("保存加入命令失败: %w", err)
-	}
-	utils.PrintInfo("加入命令已保存到: %s", joinFile)
+	// 加入命令在工作节点加入时从主节点实时获取，不再写入工作目录
+	removeLegacyJoinFile(filepath.Join(utils.GetWorkTmpDir(), config.Cluster.Name+"_k8s-join-command.txt"))
 
 	utils.PrintInfo("正在配置kubectl...")
 	cmds := []string{
@@ -355,7 +344,7 @@ func initK8sMaster(node *types.RemoteNode, config *types.ClusterConfig) error {
 	}
 
 	for _, cmd := range cmds {
-		if _, err := utils.RunCommandOnNode(node, cmd); err != nil {
+		if _, err := executor.Run(node, cmd); err != nil {
 			utils.PrintError("命令执行失败: %s: %v", cmd, err)
 			return fmt.Errorf("kubectl配置失败: %w", err)
 		}
@@ -445,11 +434,11 @@ func installBaseDependencies(config *types.ClusterConfig, hosts []string) error
 		Name:        "base-dependencies",
 		Version:     "",
 		Method:      "package",
-		PostInstall: commands,
+		PostInstall: types.NewScripts(commands...),
 		Hosts:       hosts,
 	}
 
-	installer := installer.NewInstaller()
+	installer := installer.NewInstaller().WithExecutor(executor)
 	return installer.Install(baseDeps, true)
 }
 
@@ -520,7 +509,7 @@ func prepareK8sNodes(config *types.ClusterConfig) error {
 // checkAndConfigureOS 检查并配置操作系统
 func checkAndConfigureOS(node *types.RemoteNode) error {
 	utils.PrintInfo("正在检查操作系统类型...")
-	osType, err := utils.RunCommandOnNode(node, "uname -s")
+	osType, err := executor.Run(node, "uname -s")
 	if err != nil {
 		return fmt.Errorf("检查OS类型失败: %w", err)
 	}
@@ -530,7 +519,7 @@ func checkAndConfigureOS(node *types.RemoteNode) error {
 	utils.PrintInfo("操作系统类型: %s", strings.TrimSpace(osType))
 
 	utils.PrintInfo("正在检查CPU架构...")
-	arch, err := utils.RunCommandOnNode(node, "uname -m")
+	arch, err := executor.Run(node, "uname -m")
 	if err != nil {
 		return fmt.Errorf("检查CPU架构失败: %w", err)
 	}
@@ -540,7 +529,7 @@ func checkAndConfigureOS(node *types.RemoteNode) error {
 	utils.PrintInfo("CPU架构: %s", strings.TrimSpace(arch))
 
 	utils.PrintInfo("正在检查内存大小...")
-	memInfo, err := utils.RunCommandOnNode(node, "free -b")
+	memInfo, err := executor.Run(node, "free -b")
 	if err != nil {
 		return fmt.Errorf("检查内存大小失败: %w", err)
 	}
@@ -567,11 +556,11 @@ func checkAndConfigureOS(node *types.RemoteNode) error {
 	utils.PrintInfo("总内存: %.2fGB", float64(totalMem)/float64(1024*1024*1024))
 
 	utils.PrintInfo("正在禁用交换分区...")
-	if _, err := utils.RunCommandOnNode(node, " swapoff -a"); err != nil {
+	if _, err := executor.Run(node, " swapoff -a"); err != nil {
 		return fmt.Errorf("禁用交换分区失败: %w", err)
 	}
 
-	if _, err := utils.RunCommandOnNode(node, " sed -i '/ swap / s/^/#/' /etc/fstab"); err != nil {
+	if _, err := executor.Run(node, " sed -i '/ swap / s/^/#/' /etc/fstab"); err != nil {
 		return fmt.Errorf("永久禁用交换分区失败: %w", err)
 	}
 
@@ -622,14 +611,7 @@ func joinMaster(node types.RemoteNode, config *types.ClusterConfig) error {
 }
 
 // joinWorkerNodes 加入工作节点
-func joinWorkerNodes(config *types.ClusterConfig) error {
-	joinFile := filepath.Join(utils.GetWorkTmpDir(), config.Cluster.Name+"_k8s-join-command.txt")
-	joinCommand, err := utils.ReadFileToString(joinFile)
-	if err != nil {
-		utils.PrintError("读取加入命令失败: %v", err)
-		return fmt.Errorf("读取加入命令失败: %w", err)
-	}
-
+func joinWorkerNodes(config *types.ClusterConfig, masterNode *types.RemoteNode) error {
 	for _, node := range config.Cluster.Nodes {
 		if node.Role != "worker" {
 			continue
@@ -638,10 +620,15 @@ func joinWorkerNodes(config *types.ClusterConfig) error {
 		utils.PrintStage(fmt.Sprintf("正在加入工作节点: %s", node.Host))
 		startTime := time.Now()
 
-		output, err := utils.RunCommandOnNode(&node, " "+joinCommand)
+		joinCommand, err := fetchK8sJoinCommand(masterNode)
 		if err != nil {
+			utils.PrintError("获取加入命令失败: %v", err)
+			return fmt.Errorf("获取加入命令失败: %w", err)
+		}
+
+		if _, err := executor.Stream(utils.RootContext(), &node, joinCommand, utils.StreamOptions{}); err != nil {
 			utils.PrintError("工作节点加入失败: %v", err)
-			return fmt.Errorf("工作节点%s加入失败: %w\n输出: %s", node.Host, err, output)
+			return fmt.Errorf("工作节点%s加入失败: %w", node.Host, err)
 		}
 
 		duration := time.Since(startTime)
@@ -654,7 +641,7 @@ func joinWorkerNodes(config *types.ClusterConfig) error {
 // printK8sClusterInfo 打印 Kubernetes 集群信息
 func printK8sClusterInfo(config *types.ClusterConfig, masterNode *types.RemoteNode) error {
 	utils.PrintInfo("正在获取集群节点信息...")
-	output, err := utils.RunCommandOnNode(masterNode, "kubectl get nodes")
+	output, err := executor.Run(masterNode, "kubectl get nodes")
 	if err != nil {
 		return fmt.Errorf("获取集群节点失败: %w", err)
 	}
@@ -687,13 +674,53 @@ func printK8sClusterInfo(config *types.ClusterConfig, masterNode *types.RemoteNo
 	return nil
 }
 
-// extractJoinCommand 从 kubeadm init 输出中提取 join 命令
+// fetchK8sJoinCommand 在主节点上创建短期令牌并获取加入命令
+func fetchK8sJoinCommand(masterNode *types.RemoteNode) (string, error) {
+	output, err := executor.Run(masterNode, "kubeadm token create --ttl 1h --print-join-command")
+	if err != nil {
+		return "", fmt.Errorf("创建加入令牌失败: %w", err)
+	}
+	joinCommand := extractJoinCommand(output)
+	if joinCommand == "" {
+		return "", fmt.Errorf("无法从kubeadm token create输出中提取加入命令")
+	}
+	return joinCommand, nil
+}
+
+// RotateK8sJoinTokens 删除主节点上所有引导令牌，后续加入时重新创建
+func RotateK8sJoinTokens(config *types.ClusterConfig) error {
+	masterNode := findFirstMasterNode(config)
+	if masterNode == nil {
+		return fmt.Errorf("配置中没有找到主节点")
+	}
+
+	rotateCmd := "kubeadm token list -o jsonpath='{.token}{\"\\n\"}' | xargs -r -n1 kubeadm token delete"
+	if _, err := executor.Run(masterNode, rotateCmd); err != nil {
+		return fmt.Errorf("删除引导令牌失败: %w", err)
+	}
+	utils.PrintSuccess("已删除主节点 %s 上的所有引导令牌", masterNode.Host)
+	return nil
+}
+
+// extractJoinCommand 从 kubeadm 输出中提取 join 命令
+//
+// kubeadm init 的输出中 join 命令以 \ 续行，续行部分合并为一行。
 func extractJoinCommand(output string) string {
 	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "kubeadm join") {
-			return strings.TrimSpace(line)
+	for i, line := range lines {
+		if !strings.Contains(line, "kubeadm join") {
+			continue
+		}
+		var parts []string
+		for ; i < len(lines); i++ {
+			part := strings.TrimSpace(lines[i])
+			next := strings.HasSuffix(part, "\\")
+			parts = append(parts, strings.TrimSpace(strings.TrimSuffix(part, "\\")))
+			if !next {
+				break
+			}
 		}
+		return strings.Join(parts, " ")
 	}
 	return ""
 }
@@ -737,7 +764,7 @@ func RemoveK8sCluster(config *types.ClusterConfig, force bool) error {
 		startTime := time.Now()
 
 		utils.PrintInfo("正在执行kubeadm reset...")
-		if _, err := utils.RunCommandOnNode(&node, " kubeadm reset -f"); err != nil {
+		if _, err := executor.Run(&node, " kubeadm reset -f"); err != nil {
 			utils.PrintError("节点重置失败: %v", err)
 			return fmt.Errorf("节点%s重置失败: %w", node.Host, err)
 		}
@@ -750,7 +777,7 @@ func RemoveK8sCluster(config *types.ClusterConfig, force bool) error {
 		}
 
 		for _, cmd := range cleanupCmds {
-			if _, err := utils.RunCommandOnNode(&node, cmd); err != nil {
+			if _, err := executor.Run(&node, cmd); err != nil {
 				utils.PrintWarning("清理操作失败: %s: %v", cmd, err)
 			}
 		}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+const testJoinCommand = "kubeadm join 192.168.1.10:6443 --token abcdef.0123456789abcdef " +
+	"--discovery-token-ca-cert-hash sha256:1234567890abcdef"
+
+func TestExtractJoinCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "print join command",
+			output: testJoinCommand + "\n",
+			want:   testJoinCommand,
+		},
+		{
+			name: "kubeadm init output",
+			output: "Your Kubernetes control-plane has initialized successfully!\n\n" +
+				"Then you can join any number of worker nodes by running the following on each as root:\n\n" +
+				"kubeadm join 192.168.1.10:6443 --token abcdef.0123456789abcdef \\\n" +
+				"\t--discovery-token-ca-cert-hash sha256:1234567890abcdef \n",
+			want: testJoinCommand,
+		},
+		{
+			name:   "warnings before command",
+			output: "W1018 10:00:00.000000 12345 version.go:104] could not fetch a Kubernetes version\n" + testJoinCommand,
+			want:   testJoinCommand,
+		},
+		{
+			name:   "no join command",
+			output: "error execution phase preflight\n",
+			want:   "",
+		},
+		{
+			name:   "empty output",
+			output: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractJoinCommand(tt.output); got != tt.want {
+				t.Errorf("extractJoinCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchK8sJoinCommand(t *testing.T) {
+	master := &types.RemoteNode{Host: "master-01", IP: "192.168.1.10", Role: "master"}
+
+	tests := []struct {
+		name    string
+		output  string
+		err     error
+		want    string
+		wantErr bool
+	}{
+		{name: "ok", output: testJoinCommand + "\n", want: testJoinCommand},
+		{name: "command failed", err: errors.New("connection refused"), wantErr: true},
+		{name: "no join command in output", output: "token created\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := utils.NewFakeExecutor().On("kubeadm token create", tt.output, tt.err)
+			defer SetExecutor(SetExecutor(fake))
+
+			got, err := fetchK8sJoinCommand(master)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchK8sJoinCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("fetchK8sJoinCommand() = %q, want %q", got, tt.want)
+			}
+			want := []string{"kubeadm token create --ttl 1h --print-join-command"}
+			if commands := fake.Commands("master-01"); !reflect.DeepEqual(commands, want) {
+				t.Errorf("commands on master = %q, want %q", commands, want)
+			}
+		})
+	}
+}
+
+func TestJoinWorkerNodes(t *testing.T) {
+	config := &types.ClusterConfig{}
+	config.Cluster.Nodes = []types.RemoteNode{
+		{Host: "master-01", IP: "192.168.1.10", Role: "master"},
+		{Host: "worker-01", IP: "192.168.1.11", Role: "worker"},
+		{Host: "harbor-01", IP: "192.168.1.12", Role: "harbor"},
+		{Host: "worker-02", IP: "192.168.1.13", Role: "worker"},
+	}
+	master := &config.Cluster.Nodes[0]
+
+	fake := utils.NewFakeExecutor().On("kubeadm token create", testJoinCommand+"\n", nil)
+	defer SetExecutor(SetExecutor(fake))
+
+	if err := joinWorkerNodes(config, master); err != nil {
+		t.Fatalf("joinWorkerNodes() error = %v", err)
+	}
+
+	// 每个工作节点加入前获取新的加入命令，非工作节点不执行任何命令
+	var got []string
+	for _, call := range fake.Calls() {
+		got = append(got, call.Host+": "+call.Command)
+	}
+	want := []string{
+		"master-01: kubeadm token create --ttl 1h --print-join-command",
+		"worker-01: " + testJoinCommand,
+		"master-01: kubeadm token create --ttl 1h --print-join-command",
+		"worker-02: " + testJoinCommand,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestJoinWorkerNodesStopsOnFailure(t *testing.T) {
+	config := &types.ClusterConfig{}
+	config.Cluster.Nodes = []types.RemoteNode{
+		{Host: "master-01", IP: "192.168.1.10", Role: "master"},
+		{Host: "worker-01", IP: "192.168.1.11", Role: "worker"},
+		{Host: "worker-02", IP: "192.168.1.13", Role: "worker"},
+	}
+	master := &config.Cluster.Nodes[0]
+
+	joinErr := errors.New("preflight failed")
+	fake := utils.NewFakeExecutor().
+		On("kubeadm token create", testJoinCommand+"\n", nil).
+		OnNode("worker-01", "kubeadm join", "", joinErr)
+	defer SetExecutor(SetExecutor(fake))
+
+	err := joinWorkerNodes(config, master)
+	if !errors.Is(err, joinErr) {
+		t.Fatalf("joinWorkerNodes() error = %v, want %v", err, joinErr)
+	}
+	if commands := fake.Commands("worker-02"); len(commands) != 0 {
+		t.Errorf("worker-02 should not be joined after a failure, got %q", commands)
+	}
+}
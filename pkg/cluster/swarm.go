@@ -17,8 +17,12 @@ package cluster
 
 import (
 	"fmt"
+	"net"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/structure-projects/somcli/pkg/docker"
 	"github.com/structure-projects/somcli/pkg/types"
@@ -79,7 +83,7 @@ func prepareSwarmCluster(config *types.ClusterConfig, skipPrecheck bool) error {
 		return nil
 	}
 
-	installer := docker.NewInstaller(true, true)
+	installer := docker.NewInstaller(true, true).WithExecutor(executor)
 
 	// 生成所有节点的hosts记录
 	var hostsEntries strings.Builder
@@ -95,7 +99,7 @@ func prepareSwarmCluster(config *types.ClusterConfig, skipPrecheck bool) error {
 		}
 
 		// 2. 检查并安装 Docker
-		if _, err := utils.RunCommandOnNode(&node, "docker --version"); err != nil {
+		if _, err := executor.Run(&node, "docker --version"); err != nil {
 			utils.PrintInfo("Installing Docker on node %s...", node.Host)
 			if err := installer.Install("latest", node); err != nil {
 				return fmt.Errorf("failed to install Docker on node %s: %w", node.Host, err)
@@ -103,7 +107,7 @@ func prepareSwarmCluster(config *types.ClusterConfig, skipPrecheck bool) error {
 		}
 
 		// 3. 启动 Docker 服务
-		if _, err := utils.RunCommandOnNode(&node, "systemctl start docker"); err != nil {
+		if _, err := executor.Run(&node, "systemctl start docker"); err != nil {
 			return fmt.Errorf("failed to start Docker on node %s: %w", node.Host, err)
 		}
 
@@ -119,7 +123,7 @@ func prepareSwarmCluster(config *types.ClusterConfig, skipPrecheck bool) error {
 				continue
 			}
 			checkCmd := fmt.Sprintf("ping -c 1 -W 1 %s", peer.IP)
-			if output, err := utils.RunCommandOnNode(&node, checkCmd); err != nil {
+			if output, err := executor.Run(&node, checkCmd); err != nil {
 				utils.PrintWarning("Node %s cannot reach %s (%s)\nOutput: %s",
 					node.Host, peer.Host, peer.IP, output)
 			}
@@ -155,6 +159,61 @@ func validateClusterConfig(config *types.ClusterConfig) error {
 		return fmt.Errorf("at least one manager node is required")
 	}
 
+	if err := validateSwarmConfig(&config.Cluster.SwarmConfig); err != nil {
+		return fmt.Errorf("invalid swarmConfig: %w", err)
+	}
+
+	return nil
+}
+
+// validateSwarmConfig 校验 swarmConfig 中的地址池、子网大小、端口等参数
+func validateSwarmConfig(swarmConfig *types.SwarmConfig) error {
+	minPoolPrefix := 0
+	for _, pool := range swarmConfig.DefaultAddrPool {
+		ip, ipNet, err := net.ParseCIDR(pool)
+		if err != nil {
+			return fmt.Errorf("invalid defaultAddrPool CIDR %q: %v", pool, err)
+		}
+		if ip.To4() == nil {
+			return fmt.Errorf("defaultAddrPool %q must be an IPv4 CIDR", pool)
+		}
+		if !ip.Equal(ipNet.IP) {
+			return fmt.Errorf("defaultAddrPool %q is not a network address, use %s", pool, ipNet.String())
+		}
+		prefix, _ := ipNet.Mask.Size()
+		if prefix > minPoolPrefix {
+			minPoolPrefix = prefix
+		}
+	}
+
+	if swarmConfig.SubnetSize != 0 {
+		if len(swarmConfig.DefaultAddrPool) == 0 {
+			return fmt.Errorf("subnetSize requires defaultAddrPool to be set")
+		}
+		if swarmConfig.SubnetSize < minPoolPrefix || swarmConfig.SubnetSize > 29 {
+			return fmt.Errorf("subnetSize %d must be between %d and 29", swarmConfig.SubnetSize, minPoolPrefix)
+		}
+	}
+
+	// docker 要求数据通道端口在 1024-49151 之间
+	if swarmConfig.DataPathPort != 0 && (swarmConfig.DataPathPort < 1024 || swarmConfig.DataPathPort > 49151) {
+		return fmt.Errorf("dataPathPort %d must be between 1024 and 49151", swarmConfig.DataPathPort)
+	}
+
+	if swarmConfig.CertExpiry != "" {
+		expiry, err := time.ParseDuration(swarmConfig.CertExpiry)
+		if err != nil {
+			return fmt.Errorf("invalid certExpiry %q: %v", swarmConfig.CertExpiry, err)
+		}
+		if expiry < time.Hour {
+			return fmt.Errorf("certExpiry %s must be at least 1h", swarmConfig.CertExpiry)
+		}
+	}
+
+	if limit := swarmConfig.TaskHistoryLimit; limit != nil && *limit < 0 {
+		return fmt.Errorf("taskHistoryLimit %d cannot be negative", *limit)
+	}
+
 	return nil
 }
 
@@ -170,63 +229,104 @@ func findManagerNode(config *types.ClusterConfig) *types.RemoteNode {
 func initSwarm(node *types.RemoteNode, config *types.ClusterConfig) error {
 	utils.PrintInfo("Initializing Swarm on manager node %s...", node.Host)
 
-	initCmd := fmt.Sprintf(
-		"docker swarm init --advertise-addr %s --listen-addr %s",
-		config.Cluster.SwarmConfig.AdvertiseAddr,
-		config.Cluster.SwarmConfig.ListenAddr,
-	)
+	initCmd := buildSwarmInitCmd(node, &config.Cluster.SwarmConfig)
+	utils.PrintDebug("swarm init command -> %s", initCmd)
 
-	output, err := utils.RunCommandOnNode(node, initCmd)
+	output, err := executor.Run(node, initCmd)
 	if err != nil {
 		return fmt.Errorf("failed to initialize swarm: %w\nOutput: %s", err, output)
 	}
 
-	joinTokens, err := extractSwarmJoinTokens(node)
-	if err != nil {
-		return fmt.Errorf("failed to get swarm join tokens: %w", err)
+	// 开启自动锁定后 init 会输出解锁密钥，需提示用户妥善保存
+	if config.Cluster.SwarmConfig.Autolock {
+		if unlockKey := extractUnlockKey(output); unlockKey != "" {
+			path, err := saveUnlockKey(config.Cluster.Name, unlockKey)
+			if err != nil {
+				return fmt.Errorf("swarm initialized but failed to save unlock key: %w", err)
+			}
+			utils.PrintWarning("Swarm autolock enabled, the unlock key was saved in plaintext to %s (mode 0600)", path)
+			utils.PrintWarning("Anyone who can read this file can unlock the swarm managers, move it offline (e.g. a password manager) and delete %s", path)
+		} else {
+			utils.PrintWarning("Swarm autolock enabled, run 'docker swarm unlock-key' on %s to view the unlock key", node.Host)
+		}
 	}
 
-	joinFile := filepath.Join(utils.GetWorkDir(), "swarm-join-command.txt")
-	joinContent := fmt.Sprintf("Manager: %s\nWorker: %s",
-		joinTokens["manager"],
-		joinTokens["worker"])
-
-	if err := utils.WriteStringToFile(joinFile, joinContent); err != nil {
-		return fmt.Errorf("failed to save join command: %w", err)
-	}
+	// 加入令牌在加入节点时从管理节点实时获取，不再写入工作目录
+	removeLegacyJoinFile(filepath.Join(utils.GetWorkDir(), "swarm-join-command.txt"))
 
 	utils.PrintSuccess("Swarm initialized successfully")
 	return nil
 }
 
-func joinSwarmNodes(config *types.ClusterConfig, masterNode *types.RemoteNode) error {
-	joinFile := filepath.Join(utils.GetWorkDir(), "swarm-join-command.txt")
-	joinContent, err := utils.ReadFileToString(joinFile)
-	if err != nil {
-		return fmt.Errorf("failed to read join command: %w", err)
+// buildSwarmInitCmd 根据 swarmConfig 构建 docker swarm init 命令
+func buildSwarmInitCmd(node *types.RemoteNode, swarmConfig *types.SwarmConfig) string {
+	advertiseAddr := swarmConfig.AdvertiseAddr
+	if advertiseAddr == "" {
+		advertiseAddr = node.IP
 	}
 
-	// 确保使用IP地址而非主机名
-	joinContent = strings.ReplaceAll(joinContent, masterNode.Host, masterNode.IP)
+	args := []string{"docker", "swarm", "init", "--advertise-addr", advertiseAddr}
+	if swarmConfig.ListenAddr != "" {
+		args = append(args, "--listen-addr", swarmConfig.ListenAddr)
+	}
+	for _, pool := range swarmConfig.DefaultAddrPool {
+		args = append(args, "--default-addr-pool", pool)
+	}
+	if swarmConfig.SubnetSize != 0 {
+		args = append(args, "--default-addr-pool-mask-length", strconv.Itoa(swarmConfig.SubnetSize))
+	}
+	if swarmConfig.DataPathPort != 0 {
+		args = append(args, "--data-path-port", strconv.Itoa(swarmConfig.DataPathPort))
+	}
+	if swarmConfig.Autolock {
+		args = append(args, "--autolock")
+	}
+	if swarmConfig.CertExpiry != "" {
+		args = append(args, "--cert-expiry", swarmConfig.CertExpiry)
+	}
+	if swarmConfig.TaskHistoryLimit != nil {
+		args = append(args, "--task-history-limit", strconv.Itoa(*swarmConfig.TaskHistoryLimit))
+	}
 
-	joinTokens := make(map[string]string)
-	lines := strings.Split(joinContent, "\n")
-	for _, line := range lines {
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			if key != "" && value != "" {
-				joinTokens[key] = value
-			}
+	return strings.Join(args, " ")
+}
+
+// extractUnlockKey 从 swarm init 输出中提取自动锁定的解锁密钥
+func extractUnlockKey(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "SWMKEY-") {
+			return line
 		}
 	}
+	return ""
+}
+
+// swarmUnlockKeyFile 保存自动锁定解锁密钥的文件
+func swarmUnlockKeyFile(clusterName string) string {
+	if clusterName == "" {
+		clusterName = "swarm"
+	}
+	return filepath.Join(utils.GetDataDir(), "swarm", clusterName+"-unlock-key")
+}
 
-	if joinTokens["Manager"] == "" || joinTokens["Worker"] == "" {
-		return fmt.Errorf("invalid join tokens. Manager: %t, Worker: %t",
-			joinTokens["Manager"] != "", joinTokens["Worker"] != "")
+// saveUnlockKey 将解锁密钥以明文写入只有当前用户可读的文件，避免输出到终端和日志，调用方需提示用户转移到离线位置
+func saveUnlockKey(clusterName, unlockKey string) (string, error) {
+	path := swarmUnlockKeyFile(clusterName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(unlockKey+"\n"), 0600); err != nil {
+		return "", err
 	}
+	// 文件已存在时 WriteFile 不会修改权限
+	if err := os.Chmod(path, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
 
+func joinSwarmNodes(config *types.ClusterConfig, masterNode *types.RemoteNode) error {
 	for _, node := range config.Cluster.Nodes {
 		if node.Host == masterNode.Host {
 			continue
@@ -234,25 +334,24 @@ func joinSwarmNodes(config *types.ClusterConfig, masterNode *types.RemoteNode) e
 
 		utils.PrintInfo("\nJoining node %s (%s) as %s...", node.Host, node.IP, node.Role)
 
-		var joinCmd string
-		switch strings.ToLower(node.Role) {
-		case "manager":
-			joinCmd = joinTokens["Manager"]
-		case "worker":
-			joinCmd = joinTokens["Worker"]
-		default:
+		role := strings.ToLower(node.Role)
+		if role != "manager" && role != "worker" {
 			return fmt.Errorf("unknown node role: %s", node.Role)
 		}
 
-		output, err := utils.RunCommandOnNode(&node, joinCmd)
+		joinCmd, err := fetchSwarmJoinCommand(masterNode, role)
 		if err != nil {
-			return fmt.Errorf("failed to join node %s: %w\nCommand: %s\nOutput: %s",
-				node.Host, err, joinCmd, output)
+			return fmt.Errorf("failed to get %s join command: %w", role, err)
 		}
 
-		if !strings.Contains(output, "This node joined a swarm") {
+		result, err := executor.Stream(utils.RootContext(), &node, joinCmd, utils.StreamOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to join node %s: %w", node.Host, err)
+		}
+
+		if !strings.Contains(result.Output, "This node joined a swarm") {
 			return fmt.Errorf("node %s may not have joined successfully. Output: %s",
-				node.Host, output)
+				node.Host, utils.RedactSecrets(result.Output))
 		}
 
 		utils.PrintSuccess("Node %s joined successfully as %s", node.Host, node.Role)
@@ -261,30 +360,52 @@ func joinSwarmNodes(config *types.ClusterConfig, masterNode *types.RemoteNode) e
 	return nil
 }
 
-func extractSwarmJoinTokens(node *types.RemoteNode) (map[string]string, error) {
-	tokens := make(map[string]string)
-
-	managerOutput, err := utils.RunCommandOnNode(node, "docker swarm join-token manager")
+// fetchSwarmJoinCommand 从管理节点获取指定角色的加入命令，并确保使用IP地址而非主机名
+func fetchSwarmJoinCommand(masterNode *types.RemoteNode, role string) (string, error) {
+	output, err := executor.Run(masterNode, "docker swarm join-token "+role)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get manager token: %w\nOutput: %s", err, managerOutput)
+		return "", fmt.Errorf("failed to get %s token: %w", role, err)
 	}
-	managerToken := extractTokenFromOutput(managerOutput)
-	if managerToken == "" {
-		return nil, fmt.Errorf("empty manager token, output: %s", managerOutput)
+	joinCmd := extractTokenFromOutput(output)
+	if joinCmd == "" {
+		return "", fmt.Errorf("empty %s token in join-token output", role)
 	}
-	tokens["manager"] = managerToken
+	return strings.ReplaceAll(joinCmd, masterNode.Host, masterNode.IP), nil
+}
 
-	workerOutput, err := utils.RunCommandOnNode(node, "docker swarm join-token worker")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get worker token: %w\nOutput: %s", err, workerOutput)
+// RotateSwarmJoinTokens 轮换 swarm 加入令牌，role 为 worker、manager 或 all
+func RotateSwarmJoinTokens(config *types.ClusterConfig, role string) error {
+	masterNode := findManagerNode(config)
+	if masterNode == nil {
+		return fmt.Errorf("no manager node found in configuration")
 	}
-	workerToken := extractTokenFromOutput(workerOutput)
-	if workerToken == "" {
-		return nil, fmt.Errorf("empty worker token, output: %s", workerOutput)
+
+	roles := []string{role}
+	if role == "all" {
+		roles = []string{"worker", "manager"}
+	}
+	for _, r := range roles {
+		if r != "worker" && r != "manager" {
+			return fmt.Errorf("unsupported token role: %s", r)
+		}
+		if _, err := executor.Run(masterNode, "docker swarm join-token --rotate -q "+r); err != nil {
+			return fmt.Errorf("failed to rotate %s token: %w", r, err)
+		}
+		utils.PrintSuccess("Swarm %s join token rotated", r)
 	}
-	tokens["worker"] = workerToken
+	return nil
+}
 
-	return tokens, nil
+// removeLegacyJoinFile 删除旧版本写入工作目录的明文加入命令文件
+func removeLegacyJoinFile(path string) {
+	if !utils.FileExists(path) {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		utils.PrintWarning("Failed to remove plaintext join command file %s: %v", path, err)
+		return
+	}
+	utils.PrintWarning("Removed plaintext join command file %s, rotate the join tokens if it was shared", path)
 }
 
 func extractTokenFromOutput(output string) string {
@@ -298,7 +419,7 @@ func extractTokenFromOutput(output string) string {
 }
 
 func printClusterInfoAndGuide(config *types.ClusterConfig, masterNode *types.RemoteNode) error {
-	output, err := utils.RunCommandOnNode(masterNode, "docker node ls")
+	output, err := executor.Run(masterNode, "docker node ls")
 	if err != nil {
 		return fmt.Errorf("failed to get cluster nodes: %w", err)
 	}
@@ -360,7 +481,7 @@ func RemoveSwarmCluster(config *types.ClusterConfig, force bool) error {
 		}
 	}
 
-	installer := docker.NewInstaller(false, false)
+	installer := docker.NewInstaller(false, false).WithExecutor(executor)
 
 	for _, node := range config.Cluster.Nodes {
 		utils.PrintInfo("Processing node %s...", node.Host)
@@ -374,7 +495,7 @@ func RemoveSwarmCluster(config *types.ClusterConfig, force bool) error {
 			leaveCmd = "docker swarm leave"
 		}
 
-		if _, err := utils.RunCommandOnNode(&node, leaveCmd); err != nil {
+		if _, err := executor.Run(&node, leaveCmd); err != nil {
 			utils.PrintWarning("Failed to leave swarm on node %s: %v", node.Host, err)
 		} else {
 			utils.PrintSuccess("Node %s left swarm successfully", node.Host)
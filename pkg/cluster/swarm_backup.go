@@ -0,0 +1,398 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+const (
+	swarmStateDir     = "/var/lib/docker/swarm"
+	swarmReadyTimeout = 5 * time.Minute
+)
+
+// BackupSwarm 备份 swarm raft 数据
+//
+// 选择一个非 leader 的管理节点，停止 docker 后打包 /var/lib/docker/swarm，
+// 重启 docker 并等待节点重新可达，最后将归档复制回本地工作目录。
+func BackupSwarm(config *types.ClusterConfig, unlockKey string) (string, error) {
+	utils.PrintBanner("Backing up Docker Swarm Cluster: " + config.Cluster.Name)
+
+	manager := findManagerNode(config)
+	if manager == nil {
+		return "", fmt.Errorf("no manager node found in configuration")
+	}
+
+	nodes, err := listSwarmNodes(manager)
+	if err != nil {
+		return "", err
+	}
+
+	target, leader, err := selectBackupManager(config, nodes)
+	if err != nil {
+		return "", err
+	}
+	utils.PrintInfo("Using manager %s (%s) for backup", target.Host, target.IP)
+
+	timestamp := time.Now().Format("20060102-150405")
+	archiveName := fmt.Sprintf("swarm-backup-%s-%s.tar.gz", config.Cluster.Name, timestamp)
+
+	// 归档中包含 swarm 密钥，只写入仅 root 可访问的临时目录，任何情况下都删除
+	remoteDir, err := makePrivateTempDir(target, "somcli-swarm-backup")
+	if err != nil {
+		return "", err
+	}
+	defer removeRemoteDir(target, remoteDir)
+	remoteArchive := filepath.Join(remoteDir, archiveName)
+
+	// 停止 docker 后打包，无论打包是否成功都要重启 docker
+	utils.PrintInfo("Stopping docker on %s...", target.Host)
+	if _, err := executor.Run(target, "systemctl stop docker"); err != nil {
+		return "", fmt.Errorf("failed to stop docker on %s: %w", target.Host, err)
+	}
+
+	tarCmd := fmt.Sprintf("umask 077; tar -czf %s -C %s %s%s", utils.ShellQuote(remoteArchive),
+		utils.ShellQuote(filepath.Dir(swarmStateDir)), utils.ShellQuote(filepath.Base(swarmStateDir)),
+		chownToLoginUser(target, utils.ShellQuote(remoteArchive)))
+	_, tarErr := executor.Run(target, tarCmd)
+
+	utils.PrintInfo("Starting docker on %s...", target.Host)
+	if _, err := executor.Run(target, "systemctl start docker"); err != nil {
+		return "", fmt.Errorf("failed to restart docker on %s: %w", target.Host, err)
+	}
+	if tarErr != nil {
+		return "", fmt.Errorf("failed to archive swarm state on %s: %w", target.Host, tarErr)
+	}
+
+	if err := unlockSwarmNode(config, target, unlockKey); err != nil {
+		return "", err
+	}
+	if leader != nil {
+		if err := waitManagerReachable(leader, target); err != nil {
+			return "", err
+		}
+	}
+
+	localArchive := filepath.Join(utils.GetWorkDir(), "backup", archiveName)
+	if err := os.MkdirAll(filepath.Dir(localArchive), 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := executor.Fetch(target, remoteArchive, localArchive); err != nil {
+		return "", fmt.Errorf("failed to copy backup archive: %w", err)
+	}
+	if err := os.Chmod(localArchive, 0600); err != nil {
+		return "", fmt.Errorf("failed to restrict backup archive permissions: %w", err)
+	}
+
+	utils.PrintSuccess("Swarm backup saved to %s", localArchive)
+	return localArchive, nil
+}
+
+// RestoreSwarm 恢复 swarm 集群
+//
+// 在指定管理节点上使用 --force-new-cluster 重建单管理节点集群。指定了归档时先用归档替换
+// 节点上的 swarm 数据；未指定时使用节点现有数据，用于集群失去仲裁后的恢复。
+// 替换数据后到重建集群成功前的任一步骤失败时，移回原有数据并启动 docker。
+// 随后其余管理节点逐个离开并重新加入，保证任一时刻仲裁成立。
+func RestoreSwarm(config *types.ClusterConfig, hostname, archive, unlockKey string, rejoinManagers bool) (err error) {
+	utils.PrintBanner("Restoring Docker Swarm Cluster: " + config.Cluster.Name)
+
+	target := findConfigNode(config, hostname)
+	if target == nil {
+		return fmt.Errorf("node %s not found in cluster configuration", hostname)
+	}
+	if strings.ToLower(target.Role) != "manager" {
+		return fmt.Errorf("node %s is not a manager", hostname)
+	}
+
+	if archive != "" && !utils.FileExists(archive) {
+		return fmt.Errorf("backup archive %s does not exist", archive)
+	}
+
+	utils.PrintInfo("Stopping docker on %s...", target.Host)
+	if _, err := executor.Run(target, "systemctl stop docker"); err != nil {
+		return fmt.Errorf("failed to stop docker on %s: %w", target.Host, err)
+	}
+
+	// savedDir 非空时表示原有数据已移走，重建集群成功前出错需要回退
+	savedDir := ""
+	defer func() {
+		if err != nil && savedDir != "" {
+			rollbackSwarmState(target, savedDir)
+		}
+	}()
+
+	if archive != "" {
+		remoteDir, err := makePrivateTempDir(target, "somcli-swarm-restore")
+		if err != nil {
+			return err
+		}
+		defer removeRemoteDir(target, remoteDir)
+		remoteArchive := filepath.Join(remoteDir, filepath.Base(archive))
+		if err := executor.Copy(target, archive, remoteArchive); err != nil {
+			return fmt.Errorf("failed to copy backup archive to %s: %w", target.Host, err)
+		}
+
+		// 保留原有数据，便于恢复失败时回退
+		backupDir := swarmStateDir + ".bak-" + time.Now().Format("20060102-150405")
+		moveCmd := fmt.Sprintf("if [ -d %s ]; then mv %s %s; fi", utils.ShellQuote(swarmStateDir),
+			utils.ShellQuote(swarmStateDir), utils.ShellQuote(backupDir))
+		if output, err := executor.Run(target, moveCmd); err != nil {
+			return fmt.Errorf("failed to move swarm state aside on %s: %w\nOutput: %s", target.Host, err, output)
+		}
+		savedDir = backupDir
+
+		extractCmd := fmt.Sprintf("tar -xzf %s -C %s", utils.ShellQuote(remoteArchive), utils.ShellQuote(filepath.Dir(swarmStateDir)))
+		if output, err := executor.Run(target, extractCmd); err != nil {
+			return fmt.Errorf("failed to restore swarm state on %s: %w\nOutput: %s", target.Host, err, output)
+		}
+	}
+
+	utils.PrintInfo("Starting docker on %s...", target.Host)
+	if _, err := executor.Run(target, "systemctl start docker"); err != nil {
+		return fmt.Errorf("failed to start docker on %s: %w", target.Host, err)
+	}
+	if err := unlockSwarmNode(config, target, unlockKey); err != nil {
+		return err
+	}
+
+	initCmd := fmt.Sprintf("docker swarm init --force-new-cluster --advertise-addr %s", target.IP)
+	if output, err := executor.Run(target, initCmd); err != nil {
+		return fmt.Errorf("failed to force new cluster on %s: %w\nOutput: %s", target.Host, err, output)
+	}
+	savedDir = ""
+	utils.PrintSuccess("Swarm recovered on %s as the only manager", target.Host)
+
+	if rejoinManagers {
+		if err := rejoinSwarmManagers(config, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollbackSwarmState 恢复失败时删除解压的数据，移回原有 swarm 数据并启动 docker，失败时只输出警告
+func rollbackSwarmState(node *types.RemoteNode, savedDir string) {
+	utils.PrintWarning("Restore failed, moving the previous swarm state back on %s", node.Host)
+	stateDir := utils.ShellQuote(swarmStateDir)
+	rollbackCmds := []string{
+		"systemctl stop docker",
+		fmt.Sprintf("rm -rf %s && if [ -d %s ]; then mv %s %s; fi", stateDir, utils.ShellQuote(savedDir),
+			utils.ShellQuote(savedDir), stateDir),
+		"systemctl start docker",
+	}
+	for _, cmd := range rollbackCmds {
+		if _, err := executor.Run(node, cmd); err != nil {
+			utils.PrintWarning("Rollback step %q failed on %s: %v", cmd, node.Host, err)
+		}
+	}
+}
+
+// makePrivateTempDir 在节点上创建仅 SSH 登录用户可访问的临时目录
+//
+// 节点开启 become 时命令以 root 执行，目录需交给登录用户，文件传输（SFTP）才能读写。
+func makePrivateTempDir(node *types.RemoteNode, prefix string) (string, error) {
+	command := fmt.Sprintf("umask 077; d=$(mktemp -d %s)%s && echo \"$d\"",
+		utils.ShellQuote(filepath.Join(utils.GetTmpDir(), prefix+".XXXXXX")), chownToLoginUser(node, `"$d"`))
+	output, err := executor.Run(node, command)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory on %s: %w", node.Host, err)
+	}
+	dir := strings.TrimSpace(output)
+	if dir == "" {
+		return "", fmt.Errorf("failed to create temp directory on %s: empty mktemp output", node.Host)
+	}
+	return dir, nil
+}
+
+// chownToLoginUser 返回将 path 交给登录用户的命令后缀，未开启 become 时为空
+func chownToLoginUser(node *types.RemoteNode, quotedPath string) string {
+	if !node.UseBecome() || node.User == "" || node.User == "root" {
+		return ""
+	}
+	return fmt.Sprintf(" && chown %s %s", utils.ShellQuote(node.User), quotedPath)
+}
+
+// removeRemoteDir 删除节点上的临时目录，失败时只输出警告
+func removeRemoteDir(node *types.RemoteNode, dir string) {
+	if _, err := executor.Run(node, "rm -rf "+utils.ShellQuote(dir)); err != nil {
+		utils.PrintWarning("Failed to remove %s on %s: %v", dir, node.Host, err)
+	}
+}
+
+// selectBackupManager 选择执行备份的管理节点，优先非 leader 节点，并确保停止该节点后仍满足仲裁
+func selectBackupManager(config *types.ClusterConfig, nodes []swarmNodeInfo) (*types.RemoteNode, *types.RemoteNode, error) {
+	var leader *types.RemoteNode
+	var candidates []*types.RemoteNode
+	total, reachable := 0, 0
+
+	for i := range nodes {
+		if nodes[i].Role != "manager" {
+			continue
+		}
+		total++
+		if nodes[i].Reachability == "reachable" {
+			reachable++
+		}
+
+		configNode := findConfigNodeForSwarmNode(config, &nodes[i])
+		if configNode == nil {
+			continue
+		}
+		if nodes[i].Leader {
+			leader = configNode
+		} else if nodes[i].Reachability == "reachable" {
+			candidates = append(candidates, configNode)
+		}
+	}
+
+	if len(candidates) == 0 {
+		if total == 1 && leader != nil {
+			utils.PrintWarning("Only one manager in the swarm, the cluster will be unavailable during backup")
+			return leader, nil, nil
+		}
+		return nil, nil, fmt.Errorf("no reachable non-leader manager found in cluster configuration")
+	}
+
+	// 停止一个管理节点后剩余可达节点仍需构成多数派
+	if quorum := total/2 + 1; reachable-1 < quorum {
+		return nil, nil, fmt.Errorf("refusing to stop a manager: %d of %d managers reachable, quorum needs %d",
+			reachable, total, quorum)
+	}
+
+	return candidates[0], leader, nil
+}
+
+// rejoinSwarmManagers 其他管理节点逐个离开旧集群并重新加入恢复后的集群
+func rejoinSwarmManagers(config *types.ClusterConfig, restored *types.RemoteNode) error {
+	for i := range config.Cluster.Nodes {
+		node := &config.Cluster.Nodes[i]
+		if node.Host == restored.Host || strings.ToLower(node.Role) != "manager" {
+			continue
+		}
+
+		utils.PrintInfo("Rejoining manager %s (%s)...", node.Host, node.IP)
+		if _, err := executor.Run(node, "docker swarm leave --force"); err != nil {
+			utils.PrintWarning("Failed to leave swarm on %s: %v", node.Host, err)
+		}
+		if err := removeStaleSwarmNodes(restored, node); err != nil {
+			return err
+		}
+
+		joinCmd, err := fetchSwarmJoinCommand(restored, "manager")
+		if err != nil {
+			return fmt.Errorf("failed to get join command from %s: %w", restored.Host, err)
+		}
+		if output, err := executor.Run(node, joinCmd); err != nil {
+			return fmt.Errorf("failed to rejoin manager %s: %w\nOutput: %s", node.Host, err, utils.RedactSecrets(output))
+		}
+
+		// 等待节点可达后再处理下一个，保证仲裁
+		if err := waitManagerReachable(restored, node); err != nil {
+			return err
+		}
+		utils.PrintSuccess("Manager %s rejoined", node.Host)
+	}
+	return nil
+}
+
+// removeStaleSwarmNodes 删除 --force-new-cluster 后残留的节点旧记录，节点重新加入时会使用新的 ID
+func removeStaleSwarmNodes(manager, node *types.RemoteNode) error {
+	nodes, err := listSwarmNodes(manager)
+	if err != nil {
+		return err
+	}
+	for i := range nodes {
+		info := &nodes[i]
+		if info.Leader || (!strings.EqualFold(info.Hostname, node.Host) && info.Addr != node.IP) {
+			continue
+		}
+		removeCmd := "docker node rm --force " + utils.ShellQuote(info.ID)
+		if info.Role == "manager" {
+			removeCmd = "docker node demote " + utils.ShellQuote(info.ID) + " && " + removeCmd
+		}
+		if output, err := executor.Run(manager, removeCmd); err != nil {
+			return fmt.Errorf("failed to remove stale node %s (%s): %w\nOutput: %s", info.Hostname, info.ID, err, output)
+		}
+	}
+	return nil
+}
+
+// unlockSwarmNode 开启自动锁定时，docker 重启后需要解锁管理节点
+func unlockSwarmNode(config *types.ClusterConfig, node *types.RemoteNode, unlockKey string) error {
+	if !config.Cluster.SwarmConfig.Autolock {
+		return nil
+	}
+	if unlockKey == "" {
+		utils.PrintWarning("Swarm autolock is enabled, run 'docker swarm unlock' on %s", node.Host)
+		return nil
+	}
+
+	unlockCmd := fmt.Sprintf("printf '%%s\\n' %s | docker swarm unlock", utils.ShellQuote(unlockKey))
+	if _, err := executor.Run(node, unlockCmd); err != nil {
+		return fmt.Errorf("failed to unlock swarm on %s: %w", node.Host, err)
+	}
+	return nil
+}
+
+// waitManagerReachable 等待管理节点在集群中重新可达
+func waitManagerReachable(observer, node *types.RemoteNode) error {
+	deadline := time.Now().Add(swarmReadyTimeout)
+	for time.Now().Before(deadline) {
+		nodes, err := listSwarmNodes(observer)
+		if err == nil {
+			for i := range nodes {
+				if nodes[i].Role != "manager" || nodes[i].Reachability != "reachable" {
+					continue
+				}
+				if strings.EqualFold(nodes[i].Hostname, node.Host) || nodes[i].Addr == node.IP {
+					return nil
+				}
+			}
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return fmt.Errorf("manager %s did not become reachable within %v", node.Host, swarmReadyTimeout)
+}
+
+// findConfigNode 根据主机名查找配置中的节点
+func findConfigNode(config *types.ClusterConfig, hostname string) *types.RemoteNode {
+	for i := range config.Cluster.Nodes {
+		if config.Cluster.Nodes[i].Host == hostname {
+			return &config.Cluster.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// findConfigNodeForSwarmNode 查找 swarm 节点对应的配置节点
+func findConfigNodeForSwarmNode(config *types.ClusterConfig, info *swarmNodeInfo) *types.RemoteNode {
+	for i := range config.Cluster.Nodes {
+		node := &config.Cluster.Nodes[i]
+		if strings.EqualFold(node.Host, info.Hostname) || node.IP == info.Addr {
+			return node
+		}
+	}
+	return nil
+}
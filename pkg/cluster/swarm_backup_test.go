@@ -0,0 +1,132 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// swarmTestConfig 两个管理节点的 swarm 集群配置
+func swarmTestConfig() *types.ClusterConfig {
+	config := &types.ClusterConfig{}
+	config.Cluster.Name = "demo"
+	config.Cluster.Nodes = []types.RemoteNode{
+		{Host: "swarm-mgr-01", IP: "192.168.1.10", Role: "manager"},
+		{Host: "swarm-mgr-02", IP: "192.168.1.11", Role: "manager"},
+	}
+	return config
+}
+
+// writeTestArchive 写入本地备份归档
+func writeTestArchive(t *testing.T) string {
+	t.Helper()
+	archive := filepath.Join(t.TempDir(), "swarm-backup-demo.tar.gz")
+	if err := os.WriteFile(archive, []byte("archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+// commandIndex 返回第一条包含 match 的命令的位置，未找到时为 -1
+func commandIndex(commands []string, match string) int {
+	for i, command := range commands {
+		if strings.Contains(command, match) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRestoreSwarmRollsBack(t *testing.T) {
+	tests := []struct {
+		name   string
+		failOn string
+	}{
+		{name: "extract fails", failOn: "tar -xzf"},
+		{name: "docker start fails", failOn: "systemctl start docker"},
+		{name: "force new cluster fails", failOn: "--force-new-cluster"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := swarmTestConfig()
+			fake := utils.NewFakeExecutor().
+				On("mktemp", "/tmp/somcli-swarm-restore.abc\n", nil).
+				On(tt.failOn, "boom", errors.New("exit status 1"))
+			defer SetExecutor(SetExecutor(fake))
+
+			if err := RestoreSwarm(config, "swarm-mgr-01", writeTestArchive(t), "", false); err == nil {
+				t.Fatal("RestoreSwarm() should fail")
+			}
+
+			commands := fake.Commands("swarm-mgr-01")
+			move := commandIndex(commands, "then mv '/var/lib/docker/swarm' '/var/lib/docker/swarm.bak-")
+			rollback := commandIndex(commands, "rm -rf '/var/lib/docker/swarm' && if [ -d '/var/lib/docker/swarm.bak-")
+			if move < 0 || rollback < move {
+				t.Fatalf("state should be moved back after the failure, commands:\n%s", strings.Join(commands, "\n"))
+			}
+			if commandIndex(commands, "rm -rf '/tmp/somcli-swarm-restore.abc'") < 0 {
+				t.Errorf("temp dir should be removed, commands:\n%s", strings.Join(commands, "\n"))
+			}
+			if commandIndex(commands[rollback:], "systemctl start docker") < 0 {
+				t.Errorf("docker should be started after rollback, commands:\n%s", strings.Join(commands, "\n"))
+			}
+		})
+	}
+}
+
+func TestRestoreSwarmKeepsStateOnSuccess(t *testing.T) {
+	config := swarmTestConfig()
+	fake := utils.NewFakeExecutor().On("mktemp", "/tmp/somcli-swarm-restore.abc\n", nil)
+	defer SetExecutor(SetExecutor(fake))
+
+	if err := RestoreSwarm(config, "swarm-mgr-01", writeTestArchive(t), "", false); err != nil {
+		t.Fatalf("RestoreSwarm() error = %v", err)
+	}
+	if commandIndex(fake.Commands("swarm-mgr-01"), "rm -rf '/var/lib/docker/swarm'") >= 0 {
+		t.Error("restored state should not be rolled back")
+	}
+}
+
+func TestRemoveStaleSwarmNodes(t *testing.T) {
+	config := swarmTestConfig()
+	restored, node := &config.Cluster.Nodes[0], &config.Cluster.Nodes[1]
+	nodeList := strings.Join([]string{
+		"id1|swarm-mgr-01|192.168.1.10|manager|active|reachable|true",
+		"id2|swarm-mgr-02|192.168.1.11|manager|active|unreachable|false",
+		"id3|swarm-wrk-01|192.168.1.12|worker|active||false",
+	}, "\n")
+
+	fake := utils.NewFakeExecutor().On("docker node inspect", nodeList, nil)
+	defer SetExecutor(SetExecutor(fake))
+
+	if err := removeStaleSwarmNodes(restored, node); err != nil {
+		t.Fatalf("removeStaleSwarmNodes() error = %v", err)
+	}
+	commands := fake.Commands("swarm-mgr-01")
+	want := "docker node demote 'id2' && docker node rm --force 'id2'"
+	if !reflect.DeepEqual(commands[1:], []string{want}) {
+		t.Errorf("commands = %q, want only %q after listing nodes", commands, want)
+	}
+}
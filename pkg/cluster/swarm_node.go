@@ -0,0 +1,227 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// minSafeManagers 容忍一个管理节点故障所需的最少管理节点数
+const minSafeManagers = 3
+
+// swarmNodeInfo swarm 节点信息（通过管理节点查询）
+type swarmNodeInfo struct {
+	ID           string
+	Hostname     string
+	Addr         string
+	Role         string
+	Availability string
+	Reachability string
+	Leader       bool
+}
+
+// PromoteSwarmNode 将工作节点提升为管理节点
+func PromoteSwarmNode(config *types.ClusterConfig, hostname string) error {
+	manager, target, err := resolveSwarmNode(config, hostname)
+	if err != nil {
+		return err
+	}
+
+	if target.Role == "manager" {
+		utils.PrintWarning("Node %s is already a manager", hostname)
+		return nil
+	}
+
+	return runSwarmNodeCmd(manager, fmt.Sprintf("docker node promote %s", target.ID))
+}
+
+// DemoteSwarmNode 将管理节点降级为工作节点，降级后管理节点不满足仲裁要求时拒绝执行
+func DemoteSwarmNode(config *types.ClusterConfig, hostname string, force bool) error {
+	manager, target, err := resolveSwarmNode(config, hostname)
+	if err != nil {
+		return err
+	}
+
+	if target.Role != "manager" {
+		utils.PrintWarning("Node %s is already a worker", hostname)
+		return nil
+	}
+
+	nodes, err := listSwarmNodes(manager)
+	if err != nil {
+		return err
+	}
+	if err := checkDemoteQuorum(nodes, target, force); err != nil {
+		return err
+	}
+
+	return runSwarmNodeCmd(manager, fmt.Sprintf("docker node demote %s", target.ID))
+}
+
+// SetSwarmNodeAvailability 设置节点调度状态（active/pause/drain）
+func SetSwarmNodeAvailability(config *types.ClusterConfig, hostname, availability string) error {
+	switch availability {
+	case "active", "pause", "drain":
+	default:
+		return fmt.Errorf("unsupported node availability: %s", availability)
+	}
+
+	manager, target, err := resolveSwarmNode(config, hostname)
+	if err != nil {
+		return err
+	}
+
+	return runSwarmNodeCmd(manager, fmt.Sprintf("docker node update --availability %s %s", availability, target.ID))
+}
+
+// UpdateSwarmNodeLabels 添加或删除节点标签
+func UpdateSwarmNodeLabels(config *types.ClusterConfig, hostname string, addLabels, rmLabels []string) error {
+	if len(addLabels) == 0 && len(rmLabels) == 0 {
+		return fmt.Errorf("no labels specified")
+	}
+
+	manager, target, err := resolveSwarmNode(config, hostname)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"docker", "node", "update"}
+	for _, label := range addLabels {
+		if !strings.Contains(label, "=") {
+			return fmt.Errorf("invalid label %q, expected key=value", label)
+		}
+		args = append(args, "--label-add", utils.ShellQuote(label))
+	}
+	for _, label := range rmLabels {
+		args = append(args, "--label-rm", utils.ShellQuote(label))
+	}
+	args = append(args, target.ID)
+
+	return runSwarmNodeCmd(manager, strings.Join(args, " "))
+}
+
+// resolveSwarmNode 根据配置中的主机名找到管理节点和目标 swarm 节点
+func resolveSwarmNode(config *types.ClusterConfig, hostname string) (*types.RemoteNode, *swarmNodeInfo, error) {
+	configNode := findConfigNode(config, hostname)
+	if configNode == nil {
+		return nil, nil, fmt.Errorf("node %s not found in cluster configuration", hostname)
+	}
+
+	manager := findManagerNode(config)
+	if manager == nil {
+		return nil, nil, fmt.Errorf("no manager node found in configuration")
+	}
+
+	nodes, err := listSwarmNodes(manager)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 优先按主机名匹配，其次按节点地址匹配
+	for i := range nodes {
+		if strings.EqualFold(nodes[i].Hostname, configNode.Host) {
+			return manager, &nodes[i], nil
+		}
+	}
+	for i := range nodes {
+		if nodes[i].Addr == configNode.IP {
+			return manager, &nodes[i], nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("node %s (%s) is not a member of the swarm", configNode.Host, configNode.IP)
+}
+
+// listSwarmNodes 通过管理节点查询 swarm 中的所有节点
+func listSwarmNodes(manager *types.RemoteNode) ([]swarmNodeInfo, error) {
+	listCmd := "docker node inspect --format " +
+		"'{{.ID}}|{{.Description.Hostname}}|{{.Status.Addr}}|{{.Spec.Role}}|{{.Spec.Availability}}|{{if .ManagerStatus}}{{.ManagerStatus.Reachability}}|{{.ManagerStatus.Leader}}{{else}}|false{{end}}' " +
+		"$(docker node ls -q)"
+
+	output, err := executor.Run(manager, listCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list swarm nodes on %s: %w", manager.Host, err)
+	}
+
+	return parseSwarmNodes(output), nil
+}
+
+// parseSwarmNodes 解析 listSwarmNodes 的输出
+func parseSwarmNodes(output string) []swarmNodeInfo {
+	var nodes []swarmNodeInfo
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 7 {
+			continue
+		}
+		nodes = append(nodes, swarmNodeInfo{
+			ID:           fields[0],
+			Hostname:     fields[1],
+			Addr:         fields[2],
+			Role:         fields[3],
+			Availability: fields[4],
+			Reachability: fields[5],
+			Leader:       fields[6] == "true",
+		})
+	}
+	return nodes
+}
+
+// checkDemoteQuorum 检查降级目标节点后管理节点是否仍满足仲裁
+func checkDemoteQuorum(nodes []swarmNodeInfo, target *swarmNodeInfo, force bool) error {
+	total, reachable := 0, 0
+	for _, node := range nodes {
+		if node.Role != "manager" || node.ID == target.ID {
+			continue
+		}
+		total++
+		if node.Reachability == "reachable" {
+			reachable++
+		}
+	}
+
+	if total == 0 {
+		return fmt.Errorf("refusing to demote %s: it is the last manager", target.Hostname)
+	}
+
+	// 剩余可达管理节点必须构成多数派，否则集群会失去仲裁
+	if quorum := total/2 + 1; reachable < quorum {
+		return fmt.Errorf("refusing to demote %s: %d of %d remaining managers reachable, quorum needs %d",
+			target.Hostname, reachable, total, quorum)
+	}
+
+	if total < minSafeManagers && !force {
+		return fmt.Errorf("refusing to demote %s: only %d managers would remain (at least %d needed to tolerate a failure), use --force to override",
+			target.Hostname, total, minSafeManagers)
+	}
+
+	return nil
+}
+
+// runSwarmNodeCmd 在管理节点上执行 docker node 命令
+func runSwarmNodeCmd(manager *types.RemoteNode, command string) error {
+	utils.PrintInfo("Running on manager %s: %s", manager.Host, command)
+	output, err := executor.Run(manager, command)
+	if err != nil {
+		return fmt.Errorf("command failed on manager %s: %w\nOutput: %s", manager.Host, err, output)
+	}
+	utils.PrintDebug("output -> %s", output)
+	return nil
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+const (
+	testWorkerToken  = "SWMTKN-1-3pu6hszjas19xyp7ghgosyx9k8atbfcr8p2is99znpy26u2lkl-1awxwuwd3z9j1z3puu7rcgdbx"
+	testManagerToken = "SWMTKN-1-3pu6hszjas19xyp7ghgosyx9k8atbfcr8p2is99znpy26u2lkl-7p73s1dx5in4tatdymyhg9hu2"
+)
+
+// joinTokenOutput docker swarm join-token 的输出
+func joinTokenOutput(role, token, addr string) string {
+	return "To add a " + role + " to this swarm, run the following command:\n\n" +
+		"    docker swarm join --token " + token + " " + addr + "\n\n"
+}
+
+func TestExtractTokenFromOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "worker",
+			output: joinTokenOutput("worker", testWorkerToken, "192.168.1.10:2377"),
+			want:   "docker swarm join --token " + testWorkerToken + " 192.168.1.10:2377",
+		},
+		{
+			name:   "manager",
+			output: joinTokenOutput("manager", testManagerToken, "192.168.1.10:2377"),
+			want:   "docker swarm join --token " + testManagerToken + " 192.168.1.10:2377",
+		},
+		{
+			name:   "not a swarm manager",
+			output: "Error response from daemon: This node is not a swarm manager.\n",
+			want:   "",
+		},
+		{
+			name:   "empty output",
+			output: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractTokenFromOutput(tt.output); got != tt.want {
+				t.Errorf("extractTokenFromOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractUnlockKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name: "autolock enabled",
+			output: "Swarm initialized: current node (dxn1zf6l61qsb1josjja83ngz) is now a manager.\n\n" +
+				"To unlock a swarm manager after it restarts, run the `docker swarm unlock`\n" +
+				"command and provide the following key:\n\n" +
+				"    SWMKEY-1-WuYH/IX284+lRcXuoVf38viIDK3HJEKY13MIHX+tTt8\n\n",
+			want: "SWMKEY-1-WuYH/IX284+lRcXuoVf38viIDK3HJEKY13MIHX+tTt8",
+		},
+		{
+			name:   "autolock disabled",
+			output: "Swarm initialized: current node (dxn1zf6l61qsb1josjja83ngz) is now a manager.\n",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractUnlockKey(tt.output); got != tt.want {
+				t.Errorf("extractUnlockKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSwarmInitCmd(t *testing.T) {
+	zero, five := 0, 5
+	node := &types.RemoteNode{Host: "swarm-mgr-01", IP: "192.168.1.10"}
+	tests := []struct {
+		name   string
+		config types.SwarmConfig
+		want   string
+	}{
+		{
+			name: "defaults",
+			want: "docker swarm init --advertise-addr 192.168.1.10",
+		},
+		{
+			name:   "task history limit",
+			config: types.SwarmConfig{TaskHistoryLimit: &five},
+			want:   "docker swarm init --advertise-addr 192.168.1.10 --task-history-limit 5",
+		},
+		{
+			name:   "zero task history limit",
+			config: types.SwarmConfig{TaskHistoryLimit: &zero},
+			want:   "docker swarm init --advertise-addr 192.168.1.10 --task-history-limit 0",
+		},
+		{
+			name: "all options",
+			config: types.SwarmConfig{
+				AdvertiseAddr:   "10.0.0.1",
+				ListenAddr:      "0.0.0.0:2377",
+				DefaultAddrPool: []string{"10.20.0.0/16"},
+				SubnetSize:      24,
+				DataPathPort:    7789,
+				Autolock:        true,
+				CertExpiry:      "2160h",
+			},
+			want: "docker swarm init --advertise-addr 10.0.0.1 --listen-addr 0.0.0.0:2377 --default-addr-pool 10.20.0.0/16 " +
+				"--default-addr-pool-mask-length 24 --data-path-port 7789 --autolock --cert-expiry 2160h",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildSwarmInitCmd(node, &tt.config); got != tt.want {
+				t.Errorf("buildSwarmInitCmd() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSwarmConfigTaskHistoryLimit(t *testing.T) {
+	for _, limit := range []int{-1, 0, 5} {
+		limit := limit
+		err := validateSwarmConfig(&types.SwarmConfig{TaskHistoryLimit: &limit})
+		if (err != nil) != (limit < 0) {
+			t.Errorf("validateSwarmConfig(taskHistoryLimit: %d) error = %v", limit, err)
+		}
+	}
+	if err := validateSwarmConfig(&types.SwarmConfig{}); err != nil {
+		t.Errorf("validateSwarmConfig() without taskHistoryLimit error = %v", err)
+	}
+}
+
+func TestFetchSwarmJoinCommand(t *testing.T) {
+	manager := &types.RemoteNode{Host: "swarm-mgr-01", IP: "192.168.1.10", Role: "manager"}
+
+	tests := []struct {
+		name    string
+		role    string
+		output  string
+		err     error
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "worker",
+			role:   "worker",
+			output: joinTokenOutput("worker", testWorkerToken, "192.168.1.10:2377"),
+			want:   "docker swarm join --token " + testWorkerToken + " 192.168.1.10:2377",
+		},
+		{
+			name:   "advertised by hostname",
+			role:   "manager",
+			output: joinTokenOutput("manager", testManagerToken, "swarm-mgr-01:2377"),
+			want:   "docker swarm join --token " + testManagerToken + " 192.168.1.10:2377",
+		},
+		{
+			name:    "command failed",
+			role:    "worker",
+			err:     errors.New("This node is not a swarm manager."),
+			wantErr: true,
+		},
+		{
+			name:    "no join command in output",
+			role:    "worker",
+			output:  "\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := utils.NewFakeExecutor().On("docker swarm join-token "+tt.role, tt.output, tt.err)
+			defer SetExecutor(SetExecutor(fake))
+
+			got, err := fetchSwarmJoinCommand(manager, tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchSwarmJoinCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("fetchSwarmJoinCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinSwarmNodes(t *testing.T) {
+	config := &types.ClusterConfig{}
+	config.Cluster.Nodes = []types.RemoteNode{
+		{Host: "swarm-mgr-01", IP: "192.168.1.10", Role: "manager"},
+		{Host: "swarm-mgr-02", IP: "192.168.1.11", Role: "manager"},
+		{Host: "swarm-wrk-01", IP: "192.168.1.12", Role: "worker"},
+	}
+	manager := &config.Cluster.Nodes[0]
+
+	fake := utils.NewFakeExecutor().
+		On("docker swarm join-token worker", joinTokenOutput("worker", testWorkerToken, "192.168.1.10:2377"), nil).
+		On("docker swarm join-token manager", joinTokenOutput("manager", testManagerToken, "192.168.1.10:2377"), nil).
+		On("docker swarm join --token", "This node joined a swarm as a worker.\n", nil)
+	defer SetExecutor(SetExecutor(fake))
+
+	if err := joinSwarmNodes(config, manager); err != nil {
+		t.Fatalf("joinSwarmNodes() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{
+			host: "swarm-mgr-01",
+			want: []string{"docker swarm join-token manager", "docker swarm join-token worker"},
+		},
+		{
+			host: "swarm-mgr-02",
+			want: []string{"docker swarm join --token " + testManagerToken + " 192.168.1.10:2377"},
+		},
+		{
+			host: "swarm-wrk-01",
+			want: []string{"docker swarm join --token " + testWorkerToken + " 192.168.1.10:2377"},
+		},
+	}
+	for _, tt := range tests {
+		if got := fake.Commands(tt.host); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("commands on %s = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestJoinSwarmNodesRejectsUnknownRole(t *testing.T) {
+	config := &types.ClusterConfig{}
+	config.Cluster.Nodes = []types.RemoteNode{
+		{Host: "swarm-mgr-01", IP: "192.168.1.10", Role: "manager"},
+		{Host: "swarm-db-01", IP: "192.168.1.12", Role: "database"},
+	}
+
+	fake := utils.NewFakeExecutor()
+	defer SetExecutor(SetExecutor(fake))
+
+	if err := joinSwarmNodes(config, &config.Cluster.Nodes[0]); err == nil {
+		t.Fatal("joinSwarmNodes() should fail for unknown role")
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("no command should run for unknown role, got %v", calls)
+	}
+}
@@ -81,14 +81,15 @@ func (i *Installer) Install(version string) error {
 		Version:     defaultVersion,
 		URLs:        []string{downloadTemplateUrl},
 		Target:      "{{.Name}}",
-		PreInstall:  []string{"chmod +x {{}}"},
-		PostInstall: []string{"chmod +x {{}}"},
+		PostInstall: types.NewScripts("install -m 0755 {{.CacheDir}}/{{.Name}} " + utils.ShellQuote(i.installPath)),
 	}
 
 	// result := installer.DownloadSingleFile(downloader, dockerComposeResource, downloadTemplateUrl)
 
 	installer := installer.NewInstaller()
-	installer.Install(dockerComposeResource, i.silent)
+	if err := installer.Install(dockerComposeResource, i.silent); err != nil {
+		return fmt.Errorf("failed to install docker-compose: %w", err)
+	}
 
 	// if err := utils.CopyFile(result.LocalPath, i.installPath); err != nil {
 	// 	utils.PrintError("安装 Docker Compose 失败: %v", err)
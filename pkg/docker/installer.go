@@ -23,6 +23,7 @@ type Installer struct {
 	silent     bool
 	offline    bool
 	scriptPath string
+	executor   utils.Executor
 }
 
 func NewInstaller(silent, offline bool) *Installer {
@@ -31,9 +32,16 @@ func NewInstaller(silent, offline bool) *Installer {
 		silent:     silent,
 		offline:    offline,
 		scriptPath: scriptPath,
+		executor:   utils.NewNodeExecutor(),
 	}
 }
 
+// WithExecutor 设置访问远程节点使用的执行器
+func (i *Installer) WithExecutor(executor utils.Executor) *Installer {
+	i.executor = executor
+	return i
+}
+
 // ensureScript 确保脚本存在
 func (i *Installer) ensureScript() error {
 	if err := os.MkdirAll(filepath.Dir(i.scriptPath), 0755); err != nil {
@@ -80,140 +88,33 @@ func (i *Installer) runScriptCommand(args ...string) error {
 	return cmd.Run()
 }
 
-// runRemoteCommand 在远程节点执行命令
+// runRemoteCommand 在远程节点执行命令，输出逐行带节点前缀显示
 func (i *Installer) runRemoteCommand(node types.RemoteNode, command string) error {
-	sshCmd := fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no %s@%s \"%s\"",
-		node.SSHKey, node.User, node.IP, command)
-
-	cmd := exec.Command("bash", "-c", sshCmd)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
 	if !i.silent {
 		fmt.Printf("🔧 Executing on %s: %s\n", node.IP, command)
 	}
-	return cmd.Run()
+
+	opts := utils.StreamOptions{}
+	if i.silent {
+		opts.Stdout = io.Discard
+	}
+	_, err := i.executor.Stream(utils.RootContext(), &node, command, opts)
+	return err
 }
 
 // remoteFileExists 检查远程文件是否存在
 func (i *Installer) remoteFileExists(node types.RemoteNode, remotePath string) (bool, error) {
-	checkCmd := fmt.Sprintf("test -f %s && echo exists || echo not_exists", remotePath)
-	output, err := exec.Command("bash", "-c",
-		fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no %s@%s \"%s\"",
-			node.SSHKey, node.User, node.IP, checkCmd)).Output()
-
-	if err != nil {
-		return false, fmt.Errorf("failed to check remote file: %v", err)
-	}
-
-	return strings.TrimSpace(string(output)) == "exists", nil
+	return i.executor.FileExists(&node, remotePath)
 }
 
-// copyToRemote 复制文件到远程节点（如果不存在）
+// copyToRemote 复制文件到远程节点，内容一致时跳过
 func (i *Installer) copyToRemote(node types.RemoteNode, localPath, remotePath string) error {
-	// 检查远程文件是否已存在
-	exists, err := i.remoteFileExists(node, remotePath)
-	if err != nil {
-		return err
-	}
-	if exists {
-		if !i.silent {
-			fmt.Printf("ℹ️ File already exists on %s:%s, skipping copy\n", node.IP, remotePath)
-		}
-		return nil
-	}
-
-	scpCmd := fmt.Sprintf("scp -i %s -o StrictHostKeyChecking=no %s %s@%s:%s",
-		node.SSHKey, localPath, node.User, node.IP, remotePath)
-
-	cmd := exec.Command("bash", "-c", scpCmd)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if !i.silent {
-		fmt.Printf("📤 Copying %s to %s:%s\n", localPath, node.IP, remotePath)
-	}
-	return cmd.Run()
+	return i.executor.Copy(&node, localPath, remotePath)
 }
 
-// checkRsyncVersion 检查远程rsync版本
-func (i *Installer) checkRsyncVersion(node types.RemoteNode) (bool, error) {
-	cmd := "rsync --version | head -1 | grep -oE '[0-9]+\\.[0-9]+\\.[0-9]+' || echo '1.0.0'"
-	output, err := exec.Command("bash", "-c",
-		fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no %s@%s \"%s\"",
-			node.SSHKey, node.User, node.IP, cmd)).CombinedOutput()
-
-	if err != nil {
-		return false, fmt.Errorf("failed to check rsync version: %v", err)
-	}
-
-	version := strings.TrimSpace(string(output))
-	parts := strings.Split(version, ".")
-	if len(parts) < 3 {
-		return false, nil
-	}
-
-	// 简单判断版本是否>=2.6.0
-	if parts[0] > "2" || (parts[0] == "2" && parts[1] >= "6") {
-		return true, nil
-	}
-	return false, nil
-}
-
-// copyDirectoryToRemote 兼容低版本的目录复制方法
+// copyDirectoryToRemote 递归复制目录到远程节点，只上传有变化的文件
 func (i *Installer) copyDirectoryToRemote(node types.RemoteNode, localDir, remoteDir string) error {
-	if !i.silent {
-		fmt.Printf("📦 Copying directory %s to %s:%s\n", localDir, node.IP, remoteDir)
-	}
-
-	// 1. 确保远程目录存在
-	if err := i.runRemoteCommand(node, fmt.Sprintf("mkdir -p %s", remoteDir)); err != nil {
-		return fmt.Errorf("failed to create remote directory: %v", err)
-	}
-
-	// 2. 尝试使用rsync（如果可用）
-	hasModernRsync, err := i.checkRsyncVersion(node)
-	if err != nil && !i.silent {
-		fmt.Printf("⚠️ Rsync version check failed: %v\n", err)
-	}
-
-	if hasModernRsync {
-		// 使用rsync的兼容模式（避免使用可能不支持的参数）
-		rsyncCmd := fmt.Sprintf("rsync -rlptD -e \"ssh -i %s -o StrictHostKeyChecking=no\" %s/ %s@%s:%s/",
-			node.SSHKey,
-			localDir,
-			node.User,
-			node.IP,
-			remoteDir)
-
-		cmd := exec.Command("bash", "-c", rsyncCmd)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err == nil {
-			return nil
-		} else if !i.silent {
-			fmt.Printf("⚠️ Rsync failed, falling back to tar: %v\n", err)
-		}
-	}
-
-	// 3. 回退到tar方法
-	if !i.silent {
-		fmt.Println("ℹ️ Using compatible tar-based directory copy")
-	}
-
-	tarCmd := fmt.Sprintf("tar -czf - -C %s . | ssh -i %s -o StrictHostKeyChecking=no %s@%s \"tar -xzf - -C %s\"",
-		localDir,
-		node.SSHKey,
-		node.User,
-		node.IP,
-		remoteDir)
-
-	cmd := exec.Command("bash", "-c", tarCmd)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+	return i.executor.Copy(&node, localDir, remoteDir)
 }
 
 // prepareLocalInstallArgs 准备本地安装参数
@@ -459,9 +360,8 @@ func (i *Installer) getDockerStatus(node types.RemoteNode) ([]byte, error) {
 	}
 
 	statusCmd := fmt.Sprintf("chmod +x %s && %s -c", remoteScriptPath, remoteScriptPath)
-	return exec.Command("bash", "-c",
-		fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no %s@%s \"%s\"",
-			node.SSHKey, node.User, node.IP, statusCmd)).CombinedOutput()
+	output, err := i.executor.Run(&node, statusCmd)
+	return []byte(output), err
 }
 
 // Passthrough 透传命令给Docker
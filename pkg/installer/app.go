@@ -0,0 +1,288 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// 流程执行状态
+const (
+	flowSucceeded = "succeeded"
+	flowFailed    = "failed"
+	flowSkipped   = "skipped" // 没有匹配的节点
+	flowBlocked   = "blocked" // 依赖的流程失败或已取消
+)
+
+// flowNode 流程依赖图中的一个节点
+type flowNode struct {
+	name     string
+	flow     types.Flow
+	resource types.Resource
+	deps     []int
+	done     chan struct{} // 流程结束（无论成功与否）时关闭
+	status   string
+	err      error
+}
+
+// InstallApp 按依赖关系执行应用的安装流程
+//
+// 流程之间构成有向无环图，依赖都完成后流程才开始执行，互不依赖的流程并行执行。
+// 流程失败时依赖它的流程不再执行，其余流程继续执行完毕。
+func (i *Installer) InstallApp(manifest *types.Manifest, app types.App, quiet bool) error {
+	utils.PrintStage("安装应用 -> %s", app.Name)
+	graph, err := buildFlowGraph(manifest, app, appNodes(app))
+	if err != nil {
+		return err
+	}
+	i.runFlowGraph(graph, quiet)
+	return flowSummary(app, graph)
+}
+
+// runFlowGraph 并行执行所有流程，返回时每个流程都已结束
+func (i *Installer) runFlowGraph(graph []*flowNode, quiet bool) {
+	var wg sync.WaitGroup
+	for _, node := range graph {
+		wg.Add(1)
+		go func(node *flowNode) {
+			defer wg.Done()
+			defer close(node.done)
+			i.runFlow(graph, node, quiet)
+		}(node)
+	}
+	wg.Wait()
+}
+
+// runFlow 等待依赖完成后执行流程
+func (i *Installer) runFlow(graph []*flowNode, node *flowNode, quiet bool) {
+	for _, dep := range node.deps {
+		<-graph[dep].done
+		if status := graph[dep].status; status == flowFailed || status == flowBlocked {
+			node.status = flowBlocked
+			node.err = fmt.Errorf("dependency %s %s", graph[dep].name, status)
+			return
+		}
+	}
+	if err := utils.RootContext().Err(); err != nil {
+		node.status = flowBlocked
+		node.err = err
+		return
+	}
+	if node.resource.Hosts != nil && len(node.resource.Hosts) == 0 {
+		utils.PrintWarning("流程 %s 没有匹配 %s 的节点，跳过", node.name, node.flow.Nodes)
+		node.status = flowSkipped
+		return
+	}
+
+	utils.PrintStage("执行流程 %s -> %s %v", node.name, node.resource.Name, node.resource.Hosts)
+	if err := i.Install(node.resource, quiet); err != nil {
+		utils.PrintError("流程 %s 失败: %v", node.name, err)
+		node.status = flowFailed
+		node.err = err
+		return
+	}
+	node.status = flowSucceeded
+}
+
+// buildFlowGraph 解析流程的资源、节点和依赖，并检查循环依赖
+//
+// 未设置 depends_on 的流程依赖上一个流程；depends_on 可以引用流程名称或资源名称，
+// 引用资源名称时依赖安装该资源的所有流程。
+func buildFlowGraph(manifest *types.Manifest, app types.App, nodes []types.RemoteNode) ([]*flowNode, error) {
+	graph := make([]*flowNode, len(app.Flows))
+	byName := make(map[string][]int)
+	for idx, flow := range app.Flows {
+		name := flow.Name
+		if name == "" {
+			name = flow.Resource
+		}
+		res, ok := utils.FindManifestResource(manifest, flow.Resource)
+		if !ok {
+			return nil, fmt.Errorf("flow %s: unknown resource %s", name, flow.Resource)
+		}
+		hosts, err := selectFlowHosts(flow, res, nodes)
+		if err != nil {
+			return nil, fmt.Errorf("flow %s: %w", name, err)
+		}
+		if hosts != nil {
+			res.Hosts = hosts
+		}
+
+		graph[idx] = &flowNode{name: name, flow: flow, resource: res, done: make(chan struct{})}
+		byName[name] = append(byName[name], idx)
+		if flow.Resource != name {
+			byName[flow.Resource] = append(byName[flow.Resource], idx)
+		}
+	}
+
+	for idx, node := range graph {
+		if node.flow.DependsOn == nil {
+			if idx > 0 {
+				node.deps = []int{idx - 1}
+			}
+			continue
+		}
+		for _, dep := range *node.flow.DependsOn {
+			targets, ok := byName[dep]
+			if !ok {
+				return nil, fmt.Errorf("flow %s: depends on unknown flow %s", node.name, dep)
+			}
+			for _, target := range targets {
+				if target == idx {
+					return nil, fmt.Errorf("flow %s: depends on itself", node.name)
+				}
+				node.deps = append(node.deps, target)
+			}
+		}
+	}
+
+	if cycle := findFlowCycle(graph); cycle != nil {
+		return nil, fmt.Errorf("app %s: dependency cycle %s", app.Name, strings.Join(cycle, " -> "))
+	}
+	return graph, nil
+}
+
+// findFlowCycle 深度优先查找循环依赖，返回环上的流程名称
+func findFlowCycle(graph []*flowNode) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(graph))
+	var stack []int
+	var cycle []string
+
+	var visit func(idx int) bool
+	visit = func(idx int) bool {
+		state[idx] = visiting
+		stack = append(stack, idx)
+		for _, dep := range graph[idx].deps {
+			switch state[dep] {
+			case visiting:
+				for j := len(stack) - 1; j >= 0; j-- {
+					if stack[j] == dep {
+						for _, k := range stack[j:] {
+							cycle = append(cycle, graph[k].name)
+						}
+						break
+					}
+				}
+				cycle = append(cycle, graph[dep].name)
+				return true
+			case unvisited:
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[idx] = visited
+		return false
+	}
+
+	for idx := range graph {
+		if state[idx] == unvisited && visit(idx) {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// flowSummary 输出各流程的执行结果，存在失败或未执行的流程时返回错误
+func flowSummary(app types.App, graph []*flowNode) error {
+	fmt.Printf("\nApp %s flows:\n", app.Name)
+	var failed []string
+	for _, node := range graph {
+		switch node.status {
+		case flowSucceeded:
+			fmt.Printf("  ✓ %s\n", node.name)
+		case flowSkipped:
+			fmt.Printf("  - %s: no matching nodes\n", node.name)
+		default:
+			fmt.Printf("  ✗ %s: %s (%v)\n", node.name, node.status, node.err)
+			failed = append(failed, node.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d flows did not complete: %s", len(failed), len(graph), strings.Join(failed, ", "))
+	}
+	utils.PrintSuccess("应用 %s 安装完成", app.Name)
+	return nil
+}
+
+// appNodes 返回已注册的节点，并合并应用 hosts 中声明的角色；合并结果和未注册的节点写入全局节点列表
+func appNodes(app types.App) []types.RemoteNode {
+	nodes := append([]types.RemoteNode(nil), utils.GetNodes()...)
+	registered := len(nodes)
+	for _, host := range app.Hosts {
+		found := false
+		for j := range nodes {
+			if (host.Host != "" && nodes[j].Host == host.Host) || (host.IP != "" && nodes[j].IP == host.IP) {
+				for _, role := range host.Roles {
+					if !utils.NodeHasRole(nodes[j], role) {
+						nodes[j].Roles = append(nodes[j].Roles, role)
+					}
+				}
+				found = true
+			}
+		}
+		if !found {
+			nodes = append(nodes, types.RemoteNode{Host: host.Host, IP: host.IP, Roles: host.Roles})
+		}
+	}
+	// 应用中的角色同时写入全局节点列表，资源 hosts 中的 role:<角色> 也能选择到
+	utils.ApplySSHDefaults(nodes[registered:], utils.Config.SSH)
+	utils.SetNode(nodes)
+	return nodes
+}
+
+// selectFlowHosts 根据流程的 nodes 选择安装节点，nodes 的写法与资源 hosts 的选择器相同
+//
+// 返回 nil 表示沿用资源自身的 hosts；nodes 为空时资源声明了 roles 则按角色选择。
+func selectFlowHosts(flow types.Flow, res types.Resource, nodes []types.RemoteNode) ([]string, error) {
+	selector := strings.TrimSpace(flow.Nodes)
+	if selector != "" {
+		selected, err := utils.SelectNodes(selector, nodes)
+		if err != nil {
+			return nil, err
+		}
+		hosts := []string{}
+		for _, node := range selected {
+			hosts = append(hosts, utils.NodeName(node))
+		}
+		return hosts, nil
+	}
+	if len(res.Roles) == 0 {
+		return nil, nil
+	}
+
+	hosts := []string{}
+	for _, node := range nodes {
+		for _, role := range res.Roles {
+			if utils.NodeHasRole(node, role) {
+				hosts = append(hosts, utils.NodeName(node))
+				break
+			}
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// dependsOn 构造 depends_on，不传参数时为 []
+func dependsOn(names ...string) *types.StringList {
+	list := types.StringList(names)
+	return &list
+}
+
+// flowManifest 包含 a、b、c、d 四个资源的配置
+func flowManifest() *types.Manifest {
+	manifest := &types.Manifest{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		manifest.Resources = append(manifest.Resources, types.Resource{Name: name, Version: "1.0.0"})
+	}
+	return manifest
+}
+
+func TestBuildFlowGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		flows    []types.Flow
+		wantDeps [][]int
+		wantErr  string
+	}{
+		{
+			name:     "implicit dependency on previous flow",
+			flows:    []types.Flow{{Resource: "a"}, {Resource: "b"}, {Resource: "c"}},
+			wantDeps: [][]int{nil, {0}, {1}},
+		},
+		{
+			name:     "empty depends_on runs in parallel",
+			flows:    []types.Flow{{Resource: "a"}, {Resource: "b", DependsOn: dependsOn()}, {Resource: "c"}},
+			wantDeps: [][]int{nil, nil, {1}},
+		},
+		{
+			name: "depends on flow name",
+			flows: []types.Flow{
+				{Name: "init", Resource: "a"},
+				{Resource: "b", DependsOn: dependsOn()},
+				{Resource: "c", DependsOn: dependsOn("init", "b")},
+			},
+			wantDeps: [][]int{nil, nil, {0, 1}},
+		},
+		{
+			name: "depends on resource installed by several flows",
+			flows: []types.Flow{
+				{Name: "a-masters", Resource: "a"},
+				{Name: "a-workers", Resource: "a", DependsOn: dependsOn()},
+				{Resource: "b", DependsOn: dependsOn("a")},
+			},
+			wantDeps: [][]int{nil, nil, {0, 1}},
+		},
+		{
+			name:    "unknown dependency",
+			flows:   []types.Flow{{Resource: "a"}, {Resource: "b", DependsOn: dependsOn("missing")}},
+			wantErr: "flow b: depends on unknown flow missing",
+		},
+		{
+			name:    "unknown resource",
+			flows:   []types.Flow{{Resource: "missing"}},
+			wantErr: "flow missing: unknown resource missing",
+		},
+		{
+			name:    "self dependency",
+			flows:   []types.Flow{{Resource: "a", DependsOn: dependsOn("a")}},
+			wantErr: "flow a: depends on itself",
+		},
+		{
+			name: "cycle through implicit dependency",
+			flows: []types.Flow{
+				{Resource: "a", DependsOn: dependsOn("c")},
+				{Resource: "b"},
+				{Resource: "c"},
+			},
+			wantErr: "dependency cycle a -> c -> b -> a",
+		},
+		{
+			name: "cycle between explicit dependencies",
+			flows: []types.Flow{
+				{Resource: "a"},
+				{Resource: "b", DependsOn: dependsOn("d")},
+				{Resource: "c", DependsOn: dependsOn("b")},
+				{Resource: "d", DependsOn: dependsOn("c")},
+			},
+			wantErr: "dependency cycle b -> d -> c -> b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := types.App{Name: "demo", Flows: tt.flows}
+			graph, err := buildFlowGraph(flowManifest(), app, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildFlowGraph() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildFlowGraph() error = %v", err)
+			}
+			var deps [][]int
+			for _, node := range graph {
+				deps = append(deps, node.deps)
+			}
+			if !reflect.DeepEqual(deps, tt.wantDeps) {
+				t.Errorf("deps = %v, want %v", deps, tt.wantDeps)
+			}
+		})
+	}
+}
+
+func TestFindFlowCycle(t *testing.T) {
+	graph := func(deps ...[]int) []*flowNode {
+		nodes := make([]*flowNode, len(deps))
+		for idx := range deps {
+			nodes[idx] = &flowNode{name: string(rune('a' + idx)), deps: deps[idx]}
+		}
+		return nodes
+	}
+
+	tests := []struct {
+		name  string
+		graph []*flowNode
+		want  []string
+	}{
+		{name: "empty", graph: graph(), want: nil},
+		{name: "chain", graph: graph(nil, []int{0}, []int{1}), want: nil},
+		{name: "diamond", graph: graph(nil, []int{0}, []int{0}, []int{1, 2}), want: nil},
+		{name: "two nodes", graph: graph([]int{1}, []int{0}), want: []string{"a", "b", "a"}},
+		{name: "cycle after acyclic part", graph: graph(nil, []int{0, 2}, []int{3}, []int{1}), want: []string{"b", "c", "d", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findFlowCycle(tt.graph); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findFlowCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFlowGraphBlocksDependents(t *testing.T) {
+	setupTestEnv(t, testNodes)
+
+	manifest := &types.Manifest{}
+	for _, name := range []string{"base", "mid", "top", "other"} {
+		manifest.Resources = append(manifest.Resources, types.Resource{
+			Name:        name,
+			Version:     "1.0.0",
+			Hosts:       []string{"node-01"},
+			PostInstall: types.NewScripts("setup " + name),
+		})
+	}
+	app := types.App{Name: "demo", Flows: []types.Flow{
+		{Resource: "base"},
+		{Resource: "mid"},
+		{Resource: "top", DependsOn: dependsOn("mid")},
+		{Resource: "other", DependsOn: dependsOn()},
+	}}
+
+	fake := newTestExecutor().On("setup base", "", errors.New("exit status 1"))
+	graph, err := buildFlowGraph(manifest, app, testNodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewInstaller().WithExecutor(fake).runFlowGraph(graph, true)
+
+	want := map[string]string{"base": flowFailed, "mid": flowBlocked, "top": flowBlocked, "other": flowSucceeded}
+	for _, node := range graph {
+		if node.status != want[node.name] {
+			t.Errorf("flow %s status = %s (%v), want %s", node.name, node.status, node.err, want[node.name])
+		}
+	}
+	if err := flowSummary(app, graph); err == nil || !strings.Contains(err.Error(), "3 of 4 flows did not complete: base, mid, top") {
+		t.Errorf("flowSummary() error = %v", err)
+	}
+
+	commands := fake.Commands("node-01")
+	for _, want := range []string{"setup base", "setup other"} {
+		if !utils.StringInSlice(want, commands) {
+			t.Errorf("%q should run, commands: %q", want, commands)
+		}
+	}
+	for _, blocked := range []string{"setup mid", "setup top"} {
+		if utils.StringInSlice(blocked, commands) {
+			t.Errorf("%q should be blocked by the failed dependency, commands: %q", blocked, commands)
+		}
+	}
+
+	state, err := LoadInstallState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Nodes["node-01"]["other"]; !ok {
+		t.Error("independent flow should be recorded as installed")
+	}
+	if _, ok := state.Nodes["node-01"]["base"]; ok {
+		t.Error("failed flow should not be recorded as installed")
+	}
+}
@@ -22,22 +22,25 @@ import (
 
 	"github.com/structure-projects/somcli/pkg/types"
 	"github.com/structure-projects/somcli/pkg/utils"
-	"gopkg.in/yaml.v2"
 )
 
 // LoadDownloadConfig 加载下载配置文件
 func LoadDownloadConfig(configPath string) (*types.ResourceConfig, error) {
-	data, err := os.ReadFile(configPath)
+	manifest, err := utils.LoadManifest(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
 	}
 
-	var config types.ResourceConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	// 下载 kind: Download 中的资源以及 kind: Resource 中声明了 urls 的资源
+	config := utils.ManifestResourceConfig(manifest)
+	resources := config.Resources[:0]
+	for _, res := range config.Resources {
+		if len(res.URLs) > 0 {
+			resources = append(resources, res)
+		}
 	}
-
-	return &config, nil
+	config.Resources = resources
+	return config, nil
 }
 
 // DownloadSingleFile 下载单个文件
@@ -66,11 +69,16 @@ func DownloadSingleFile(downloader *utils.Downloader, res types.Resource, url st
 		}
 	}
 
+	return DownloadFile(downloader, res, parsedURL, targetPath)
+}
+
+// DownloadFile 下载已渲染的地址到资源缓存目录中的目标路径，并校验 checksum
+func DownloadFile(downloader *utils.Downloader, res types.Resource, parsedURL, targetPath string) types.DownloadResult {
 	cacheDir := filepath.Join(utils.GetDownloadDir(), res.Name, res.Version)
-	fullPath := filepath.Join(cacheDir, targetPath)
+	fullPath := downloadPath(res, targetPath)
 	utils.PrintInfo("输出文件信息 -> 缓存目录： %s, 目标文件: %s , 下载地址: %s ", cacheDir, targetPath, parsedURL)
 
-	err = downloader.Download(parsedURL, targetPath, cacheDir)
+	err := downloader.Download(parsedURL, targetPath, cacheDir)
 	result := types.DownloadResult{
 		Name:      res.Name,
 		Version:   res.Version,
@@ -91,6 +99,14 @@ func DownloadSingleFile(downloader *utils.Downloader, res types.Resource, url st
 	return result
 }
 
+// downloadPath 下载目标在本地的路径，绝对路径直接使用，相对路径位于资源的缓存目录
+func downloadPath(res types.Resource, target string) string {
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(utils.GetDownloadDir(), res.Name, res.Version, target)
+}
+
 // DownloadResources 执行批量下载
 func DownloadResources(config *types.ResourceConfig, quiet bool) ([]types.DownloadResult, error) {
 	// 初始化下载器
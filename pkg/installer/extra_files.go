@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// writeExtraFiles 按节点渲染 ExtraFiles 并写入每个安装节点
+//
+// 目标文件内容一致时跳过；内容变化时输出差异，并将原文件备份为 <path>.<时间>.bak 后覆盖。
+// 返回每个节点写入的路径及其 sha256，键为节点名称。
+func (i *Installer) writeExtraFiles(tool types.Resource, nodes []*types.RemoteNode) (map[string]map[string]string, error) {
+	written := make(map[string]map[string]string, len(nodes))
+	if len(tool.ExtraFiles) == 0 {
+		return written, nil
+	}
+
+	paths := make([]string, 0, len(tool.ExtraFiles))
+	for path := range tool.ExtraFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tmpDir, err := os.MkdirTemp(utils.GetTmpDir(), "extra-files-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir failed: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for n, node := range nodes {
+		data, err := utils.NodeTemplateData(i.executor, node, tool)
+		if err != nil {
+			return nil, err
+		}
+		sums := make(map[string]string, len(paths))
+		for idx, tmplPath := range paths {
+			path, err := data.Render(tmplPath)
+			if err != nil {
+				return nil, fmt.Errorf("parse extra file path %s failed: %w", tmplPath, err)
+			}
+			content, err := data.Render(tool.ExtraFiles[tmplPath])
+			if err != nil {
+				return nil, fmt.Errorf("parse extra file %s for %s failed: %w", path, node.Host, err)
+			}
+			local := filepath.Join(tmpDir, fmt.Sprintf("%d-%d-%s", n, idx, filepath.Base(path)))
+			if err := os.WriteFile(local, []byte(content), 0644); err != nil {
+				return nil, fmt.Errorf("write extra file %s failed: %w", path, err)
+			}
+			if err := i.writeExtraFile(node, local, path, content); err != nil {
+				return nil, fmt.Errorf("write %s on %s failed: %w", path, node.Host, err)
+			}
+			sum := sha256.Sum256([]byte(content))
+			sums[path] = hex.EncodeToString(sum[:])
+		}
+		written[stateNodeName(node)] = sums
+	}
+	return written, nil
+}
+
+// writeExtraFile 将渲染后的文件写入节点，内容变化时备份原文件
+func (i *Installer) writeExtraFile(node *types.RemoteNode, local, path, content string) error {
+	exists, err := i.executor.FileExists(node, path)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		current, err := i.fetchContent(node, path)
+		if err != nil {
+			return err
+		}
+		if current == content {
+			utils.PrintInfo("[%s] %s 未变化", node.Host, path)
+			return nil
+		}
+
+		utils.PrintInfo("[%s] 更新 %s:", node.Host, path)
+		for _, line := range utils.DiffLines(current, content) {
+			fmt.Printf("    %s\n", line)
+		}
+		backup := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+		if _, err := i.executor.Run(node, fmt.Sprintf("cp -p %s %s", utils.ShellQuote(path), utils.ShellQuote(backup))); err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+		utils.PrintInfo("[%s] 已备份到 %s", node.Host, backup)
+	} else {
+		utils.PrintInfo("[%s] 写入 %s", node.Host, path)
+	}
+
+	return i.executor.Copy(node, local, path)
+}
+
+// fetchContent 读取节点上的文件内容
+func (i *Installer) fetchContent(node *types.RemoteNode, path string) (string, error) {
+	tmp, err := os.CreateTemp(utils.GetTmpDir(), "extra-file-")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := i.executor.Fetch(node, path, tmp.Name()); err != nil {
+		return "", fmt.Errorf("read %s failed: %w", path, err)
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
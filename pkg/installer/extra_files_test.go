@@ -0,0 +1,184 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// extraFilesResource ExtraFiles 的路径和内容都按节点渲染
+func extraFilesResource() types.Resource {
+	return types.Resource{
+		Name:       "demo",
+		Version:    "1.0.0",
+		ExtraFiles: map[string]string{"/etc/demo/{{ .Host }}.conf": "listen: {{ .IP }}:8080\narch: {{ .Arch }}\n"},
+	}
+}
+
+// sha256Hex 内容的 sha256
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestWriteExtraFiles(t *testing.T) {
+	node01 := "listen: 10.255.0.11:8080\narch: amd64\n"
+	node02 := "listen: 10.255.0.12:8080\narch: amd64\n"
+	backup := regexp.MustCompile(`^cp -p '/etc/demo/node-0\d\.conf' '/etc/demo/node-0\d\.conf\.\d{8}-\d{6}\.bak'$`)
+
+	tests := []struct {
+		name    string
+		files   map[string]string // 节点上已有的文件，键为 <节点>:<路径>
+		want    []string
+		backups []string // 需要备份的节点
+	}{
+		{
+			name: "new files",
+			want: []string{
+				"node-01: exists /etc/demo/node-01.conf",
+				"node-01: copy /etc/demo/node-01.conf",
+				"node-02: exists /etc/demo/node-02.conf",
+				"node-02: copy /etc/demo/node-02.conf",
+			},
+		},
+		{
+			name: "unchanged files",
+			files: map[string]string{
+				"node-01:/etc/demo/node-01.conf": node01,
+				"node-02:/etc/demo/node-02.conf": node02,
+			},
+			want: []string{
+				"node-01: exists /etc/demo/node-01.conf",
+				"node-01: fetch /etc/demo/node-01.conf",
+				"node-02: exists /etc/demo/node-02.conf",
+				"node-02: fetch /etc/demo/node-02.conf",
+			},
+		},
+		{
+			name: "changed file on one node",
+			files: map[string]string{
+				"node-01:/etc/demo/node-01.conf": "listen: 0.0.0.0:8080\narch: amd64\n",
+				"node-02:/etc/demo/node-02.conf": node02,
+			},
+			want: []string{
+				"node-01: exists /etc/demo/node-01.conf",
+				"node-01: fetch /etc/demo/node-01.conf",
+				"node-01: backup",
+				"node-01: copy /etc/demo/node-01.conf",
+				"node-02: exists /etc/demo/node-02.conf",
+				"node-02: fetch /etc/demo/node-02.conf",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t, testNodes)
+			fake := newTestExecutor()
+			for key, content := range tt.files {
+				host, path, _ := strings.Cut(key, ":")
+				fake.SetFile(host, path, content)
+			}
+			nodes, err := utils.ResolveHosts([]string{"node-01", "node-02"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := NewInstaller().WithExecutor(fake).writeExtraFiles(extraFilesResource(), nodes)
+			if err != nil {
+				t.Fatalf("writeExtraFiles() error = %v", err)
+			}
+
+			var got []string
+			for _, call := range fake.Calls() {
+				switch {
+				case call.Op == utils.CallRun && strings.HasPrefix(call.Command, "uname -s"):
+				case call.Op == utils.CallRun && backup.MatchString(call.Command):
+					got = append(got, call.Host+": backup")
+				case call.Op == utils.CallFetch:
+					got = append(got, call.Host+": fetch "+call.RemotePath)
+				default:
+					got = append(got, describeCalls([]utils.ExecutorCall{call})...)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+
+			wantWritten := map[string]map[string]string{
+				"node-01": {"/etc/demo/node-01.conf": sha256Hex(node01)},
+				"node-02": {"/etc/demo/node-02.conf": sha256Hex(node02)},
+			}
+			if !reflect.DeepEqual(written, wantWritten) {
+				t.Errorf("written = %v, want %v", written, wantWritten)
+			}
+		})
+	}
+}
+
+func TestWriteExtraFilesRendersPerNode(t *testing.T) {
+	setupTestEnv(t, testNodes)
+	fake := utils.NewFakeExecutor().
+		OnNode("node-01", "uname -s", "Linux\nx86_64\nubuntu\n", nil).
+		OnNode("node-02", "uname -s", "Linux\naarch64\ncentos\n", nil)
+	nodes := []*types.RemoteNode{
+		{Host: "node-01", IP: "10.255.1.11"},
+		{Host: "node-02", IP: "10.255.1.12"},
+	}
+
+	if _, err := NewInstaller().WithExecutor(fake).writeExtraFiles(extraFilesResource(), nodes); err != nil {
+		t.Fatalf("writeExtraFiles() error = %v", err)
+	}
+
+	// Copy 记录的文件内容可以通过 Fetch 读回
+	for host, want := range map[string]string{
+		"node-01": "listen: 10.255.1.11:8080\narch: amd64\n",
+		"node-02": "listen: 10.255.1.12:8080\narch: arm64\n",
+	} {
+		got, err := NewInstaller().WithExecutor(fake).fetchContent(&types.RemoteNode{Host: host}, "/etc/demo/"+host+".conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s content = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestWriteExtraFilesUndefinedVariable(t *testing.T) {
+	setupTestEnv(t, testNodes)
+	fake := newTestExecutor()
+	res := extraFilesResource()
+	res.ExtraFiles = map[string]string{"/etc/demo/demo.conf": "token: {{ .Vars.token }}\n"}
+
+	nodes := []*types.RemoteNode{{Host: "node-01", IP: "10.255.0.11"}}
+	if _, err := NewInstaller().WithExecutor(fake).writeExtraFiles(res, nodes); err == nil {
+		t.Fatal("writeExtraFiles() should fail for an undefined variable")
+	}
+	for _, call := range fake.Calls() {
+		if call.Op == utils.CallCopy {
+			t.Errorf("nothing should be written, got %s", call)
+		}
+	}
+}
@@ -25,19 +25,44 @@ import (
 
 type Installer struct {
 	DownloadDir string
+	executor    utils.Executor
+	force       bool // 忽略安装记录，重新安装已安装的资源
 }
 
 func NewInstaller() *Installer {
-	return &Installer{}
+	return &Installer{executor: utils.NewNodeExecutor()}
 }
 
-// 加载配置
+// WithExecutor 设置访问节点使用的执行器
+func (i *Installer) WithExecutor(executor utils.Executor) *Installer {
+	i.executor = executor
+	return i
+}
+
+// WithForce 设置是否重新安装已安装相同版本的资源
+func (i *Installer) WithForce(force bool) *Installer {
+	i.force = force
+	return i
+}
+
+// 加载配置，定义了应用时按应用流程安装，否则按顺序安装 kind: Resource 中的资源
 func (i *Installer) InstallFromFile(configPath string, quiet bool) error {
-	config, err := utils.LoadConfig(configPath)
+	manifest, err := utils.LoadManifest(configPath)
 	if err != nil {
 		return fmt.Errorf("load config failed: %w", err)
 	}
-	for _, tool := range config.Resources {
+	utils.ApplyManifest(manifest)
+
+	if len(manifest.Apps) > 0 {
+		for _, app := range manifest.Apps {
+			if err := i.InstallApp(manifest, app, quiet); err != nil {
+				return fmt.Errorf("app %s install failed: %w", app.Name, err)
+			}
+		}
+		return nil
+	}
+
+	for _, tool := range manifest.Resources {
 		if err := i.Install(tool, quiet); err != nil {
 			return fmt.Errorf("%s install failed: %w", tool.Name, err)
 		}
@@ -65,8 +90,32 @@ func (i *Installer) InstallTool(configPath string, name string, quiet bool) erro
 	return nil
 }
 
-// 安装
+// 安装：准备文件、执行前置脚本、写入扩展文件、按 method 安装、执行后置脚本
 func (i *Installer) Install(tool types.Resource, quiet bool) error {
+	handler, err := methodHandler(tool.Method)
+	if err != nil {
+		return err
+	}
+
+	// 跳过已安装相同版本和定义的节点，以及 check、when 条件不需要安装的节点
+	nodes, err := installNodes(tool)
+	if err != nil {
+		return err
+	}
+	if nodes, err = i.pendingNodes(tool, nodes); err != nil {
+		return err
+	}
+	if nodes, err = i.conditionNodes(tool, nodes); err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		utils.PrintSuccess("%s %s 已安装", tool.Name, tool.Version)
+		return nil
+	}
+	if len(tool.Hosts) > 0 {
+		tool.Hosts = nodeHosts(nodes)
+	}
+
 	utils.PrintStage("开始安装 -> %s", tool.Name)
 	//判断是否需要下载
 	proxy := viper.GetString("github_proxy")
@@ -74,33 +123,199 @@ func (i *Installer) Install(tool types.Resource, quiet bool) error {
 	downloader.SetQuiet(quiet)
 	utils.PrintStage("安装前文件准备工作")
 	utils.PrintDebug("输出资源信息 -> %v , ", tool)
-	for _, url := range tool.URLs {
-		res := DownloadSingleFile(downloader, tool, fmt.Sprint(url))
-		// 拷贝文件
-		for _, hostname := range tool.Hosts {
-			node := utils.GetNode(hostname)
-			if node.IP == "127.0.0.1" {
-				utils.PrintWarning("loacl install not copy file .")
-			} else {
-				utils.PrintInfo("拷贝文件 %s 到远程主机-> %s", res.LocalPath, node.IP)
-				utils.CopyToRemote(node.User, node.IP, node.SSHKey, res.LocalPath, res.LocalPath)
+	// URLs 和 Files 按节点渲染，不同架构等渲染结果不同的节点分组安装
+	groups, err := i.groupNodeFiles(tool, nodes)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for _, d := range group.downloads {
+			res := DownloadFile(downloader, tool, d.url, d.target)
+			if res.Error != nil {
+				return fmt.Errorf("download %s failed: %w", res.URL, res.Error)
+			}
+			if err := i.copyToNodes(group.nodes, res.LocalPath); err != nil {
+				return err
+			}
+		}
+		for _, path := range group.localFiles {
+			if !utils.FileExists(path) {
+				return fmt.Errorf("file %s not found, run somcli download first", path)
+			}
+			if err := i.copyToNodes(group.nodes, path); err != nil {
+				return err
 			}
-
 		}
 	}
+
 	utils.PrintStage("执行安装前置处理脚本")
 	// 前置脚本
-	if err := utils.RunScripts(tool.PreInstall, tool); err != nil {
+	if err := utils.RunScriptsWith(i.executor, tool.PreInstall, tool); err != nil {
 		return fmt.Errorf("pre-install failed: %w", err)
 	}
 
+	if len(tool.ExtraFiles) > 0 {
+		utils.PrintStage("写入扩展文件")
+	}
+	extraFiles, err := i.writeExtraFiles(tool, nodes)
+	if err != nil {
+		return fmt.Errorf("extra files failed: %w", err)
+	}
+
+	method := tool.Method
+	if method == "" {
+		method = MethodScript
+	}
+	if method != MethodScript {
+		utils.PrintStage("执行 %s 方式安装", method)
+	}
+	for _, group := range groups {
+		ctx := &MethodContext{Executor: i.executor, Resource: tool, Nodes: group.nodes, Files: group.files()}
+		if err := handler.Install(ctx); err != nil {
+			return fmt.Errorf("%s install failed: %w", method, err)
+		}
+	}
+
 	//运行后置脚本
 	utils.PrintStage("执行安装后置处理脚本")
-	if err := utils.RunScripts(tool.PostInstall, tool); err != nil {
+	if err := utils.RunScriptsWith(i.executor, tool.PostInstall, tool); err != nil {
 		return fmt.Errorf("post-install failed: %w", err)
 	}
 
+	for _, group := range groups {
+		installed, err := installedFiles(tool, group.files())
+		if err != nil {
+			return fmt.Errorf("checksum installed files failed: %w", err)
+		}
+		if err := i.recordInstall(tool, group.nodes, installed, extraFiles); err != nil {
+			return fmt.Errorf("record install state failed: %w", err)
+		}
+	}
+
 	utils.PrintSuccess("%s %s 成功安装!", tool.Name, tool.Version)
 	return nil
 
 }
+
+// copyToNodes 复制本地文件到远程节点，路径与本地相同
+func (i *Installer) copyToNodes(nodes []*types.RemoteNode, localPath string) error {
+	for _, node := range nodes {
+		if utils.IsLocalNode(node) {
+			utils.PrintDebug("%s 为本机节点，跳过拷贝文件", node.Host)
+			continue
+		}
+		// 远程文件校验和一致时跳过上传
+		utils.PrintInfo("拷贝文件 %s 到远程主机-> %s", localPath, node.IP)
+		if err := i.executor.Copy(node, localPath, localPath); err != nil {
+			return fmt.Errorf("copy %s to %s failed: %w", localPath, node.Host, err)
+		}
+	}
+	return nil
+}
+
+// fileDownload 渲染后的下载地址和目标路径
+type fileDownload struct {
+	url    string
+	target string
+	path   string // 本地缓存路径
+}
+
+// fileGroup URLs 和 Files 渲染结果相同的一组节点
+type fileGroup struct {
+	nodes      []*types.RemoteNode
+	downloads  []fileDownload
+	localFiles []string // Files 渲染后的路径
+}
+
+// files 组内节点需要的全部文件，顺序为 URLs 在前、Files 在后，未设置 target 的下载没有确定的文件路径
+func (g *fileGroup) files() []string {
+	files := make([]string, 0, len(g.downloads)+len(g.localFiles))
+	for _, d := range g.downloads {
+		if d.target != "" {
+			files = append(files, d.path)
+		}
+	}
+	return append(files, g.localFiles...)
+}
+
+// groupNodeFiles 按节点渲染资源的 URLs、Target 和 Files，并将结果相同的节点分为一组
+func (i *Installer) groupNodeFiles(tool types.Resource, nodes []*types.RemoteNode) ([]*fileGroup, error) {
+	var groups []*fileGroup
+	index := make(map[string]*fileGroup)
+	for _, node := range nodes {
+		data, err := utils.NodeTemplateData(i.executor, node, tool)
+		if err != nil {
+			return nil, err
+		}
+		group := &fileGroup{}
+		for _, url := range tool.URLs {
+			parsedURL, err := data.Render(url)
+			if err != nil {
+				return nil, fmt.Errorf("parse url %s for %s failed: %w", url, node.Host, err)
+			}
+			target, err := data.WithURL(parsedURL).Render(tool.Target)
+			if err != nil {
+				return nil, fmt.Errorf("parse target path for %s failed: %w", node.Host, err)
+			}
+			group.downloads = append(group.downloads, fileDownload{url: parsedURL, target: target, path: downloadPath(tool, target)})
+		}
+		for _, file := range tool.Files {
+			path, err := data.Render(file)
+			if err != nil {
+				return nil, fmt.Errorf("parse file %s for %s failed: %w", file, node.Host, err)
+			}
+			group.localFiles = append(group.localFiles, path)
+		}
+
+		key := fmt.Sprint(group.downloads, group.localFiles)
+		if existing, ok := index[key]; ok {
+			existing.nodes = append(existing.nodes, node)
+			continue
+		}
+		group.nodes = []*types.RemoteNode{node}
+		index[key] = group
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// conditionNodes 过滤掉资源的 check 已满足或 when 不满足的节点
+func (i *Installer) conditionNodes(tool types.Resource, nodes []*types.RemoteNode) ([]*types.RemoteNode, error) {
+	if tool.Check == "" && tool.When == "" {
+		return nodes, nil
+	}
+	var pending []*types.RemoteNode
+	for _, node := range nodes {
+		skip, reason, err := utils.SkipStep(i.executor, node, tool.Check, tool.When, tool)
+		if err != nil {
+			return nil, fmt.Errorf("%s on %s: %w", tool.Name, node.Host, err)
+		}
+		if skip {
+			utils.PrintInfo("[%s] 跳过 %s (%s)", node.Host, tool.Name, reason)
+			continue
+		}
+		pending = append(pending, node)
+	}
+	return pending, nil
+}
+
+// nodeHosts 返回仍需安装的节点对应的 hosts，选择器展开为节点名称
+func nodeHosts(nodes []*types.RemoteNode) []string {
+	hosts := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		hosts = append(hosts, utils.NodeName(*node))
+	}
+	return hosts
+}
+
+// installNodes 资源的安装节点，hosts 中的选择器按节点清单展开，未指定 hosts 时为本机
+func installNodes(tool types.Resource) ([]*types.RemoteNode, error) {
+	if len(tool.Hosts) == 0 {
+		return []*types.RemoteNode{utils.LocalNode()}, nil
+	}
+	nodes, err := utils.ResolveHosts(tool.Hosts)
+	if err != nil {
+		return nil, fmt.Errorf("%s hosts: %w", tool.Name, err)
+	}
+	return nodes, nil
+}
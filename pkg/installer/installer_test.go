@@ -0,0 +1,198 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// testNodes 测试使用的远程节点，IP 不属于本机
+var testNodes = []types.RemoteNode{
+	{Host: "node-01", IP: "10.255.0.11", User: "root"},
+	{Host: "node-02", IP: "10.255.0.12", User: "root"},
+}
+
+// setupTestEnv 使用临时工作目录和测试节点清单，测试结束后恢复
+func setupTestEnv(t *testing.T, nodes []types.RemoteNode) string {
+	t.Helper()
+	workDir := t.TempDir()
+	previousWorkDir := viper.Get("workdir")
+	previousNodes := utils.Config.Nodes
+	viper.Set("workdir", workDir)
+	utils.Config.Nodes = append([]types.RemoteNode(nil), nodes...)
+	t.Cleanup(func() {
+		viper.Set("workdir", previousWorkDir)
+		utils.Config.Nodes = previousNodes
+	})
+	return workDir
+}
+
+// newTestExecutor 返回节点信息为 linux/amd64 的 FakeExecutor
+func newTestExecutor() *utils.FakeExecutor {
+	return utils.NewFakeExecutor().On("uname -s", "Linux\nx86_64\nubuntu\n", nil)
+}
+
+// describeCalls 将调用记录转换为便于比较的描述，忽略获取节点信息的命令和本地临时文件路径
+func describeCalls(calls []utils.ExecutorCall) []string {
+	var described []string
+	for _, call := range calls {
+		switch call.Op {
+		case utils.CallRun:
+			if strings.HasPrefix(call.Command, "uname -s") {
+				continue
+			}
+			described = append(described, call.Host+": "+call.Command)
+		case utils.CallCopy:
+			described = append(described, call.Host+": copy "+call.RemotePath)
+		default:
+			described = append(described, call.String())
+		}
+	}
+	return described
+}
+
+// testBinaryResource 以 binary 方式安装到测试节点的资源
+func testBinaryResource(t *testing.T, workDir string) types.Resource {
+	t.Helper()
+	file := filepath.Join(workDir, "download", "demo", "1.0.0", "demo")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("#!/bin/sh\necho demo\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return types.Resource{
+		Name:        "demo",
+		Version:     "1.0.0",
+		Method:      MethodBinary,
+		Hosts:       []string{"node-01", "node-02"},
+		Files:       []string{file},
+		PreInstall:  types.NewScripts("systemctl stop demo || true"),
+		PostInstall: types.NewScripts("systemctl restart demo"),
+		ExtraFiles:  map[string]string{"/etc/demo/demo.conf": "listen: {{ .IP }}:8080\n"},
+	}
+}
+
+func TestInstallPhaseOrder(t *testing.T) {
+	workDir := setupTestEnv(t, testNodes)
+	tool := testBinaryResource(t, workDir)
+	file := tool.Files[0]
+
+	fake := newTestExecutor()
+	if err := NewInstaller().WithExecutor(fake).Install(tool, true); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	install := "mkdir -p '/usr/local/bin' && install -m 0755 " + utils.ShellQuote(file) + " '/usr/local/bin/demo'"
+	want := []string{
+		// 复制安装文件
+		"node-01: copy " + file,
+		"node-02: copy " + file,
+		// 前置脚本
+		"node-01: systemctl stop demo || true",
+		"node-02: systemctl stop demo || true",
+		// 扩展文件
+		"node-01: exists /etc/demo/demo.conf",
+		"node-01: copy /etc/demo/demo.conf",
+		"node-02: exists /etc/demo/demo.conf",
+		"node-02: copy /etc/demo/demo.conf",
+		// 安装方式
+		"node-01: " + install,
+		"node-02: " + install,
+		// 后置脚本
+		"node-01: systemctl restart demo",
+		"node-02: systemctl restart demo",
+		// 标记文件
+		"node-01: copy " + markerPath("demo"),
+		"node-02: copy " + markerPath("demo"),
+	}
+	if got := describeCalls(fake.Calls()); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	state, err := LoadInstallState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range testNodes {
+		record, ok := state.Nodes[node.Host]["demo"]
+		if !ok {
+			t.Fatalf("no install record for %s", node.Host)
+		}
+		for _, path := range []string{file, "/usr/local/bin/demo", "/etc/demo/demo.conf"} {
+			if _, ok := record.Files[path]; !ok {
+				t.Errorf("record on %s missing file %s: %v", node.Host, path, record.Files)
+			}
+		}
+	}
+}
+
+func TestInstallStopsOnPreInstallFailure(t *testing.T) {
+	workDir := setupTestEnv(t, testNodes)
+	tool := testBinaryResource(t, workDir)
+
+	scriptErr := errors.New("exit status 1")
+	fake := newTestExecutor().OnNode("node-02", "systemctl stop demo", "", scriptErr)
+	err := NewInstaller().WithExecutor(fake).Install(tool, true)
+	if !errors.Is(err, scriptErr) {
+		t.Fatalf("Install() error = %v, want %v", err, scriptErr)
+	}
+
+	// 前置脚本失败后不再写入扩展文件、执行安装和记录状态
+	got := describeCalls(fake.Calls())
+	last := got[len(got)-1]
+	if last != "node-02: systemctl stop demo || true" {
+		t.Errorf("last call = %q, calls:\n%s", last, strings.Join(got, "\n"))
+	}
+	state, err := LoadInstallState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Nodes) != 0 {
+		t.Errorf("install state should be empty, got %v", state.Nodes)
+	}
+}
+
+func TestInstallSkipsNodesByCheck(t *testing.T) {
+	workDir := setupTestEnv(t, testNodes)
+	tool := testBinaryResource(t, workDir)
+	tool.Check = "test -x /usr/local/bin/demo"
+
+	fake := newTestExecutor().
+		OnNode("node-01", "test -x /usr/local/bin/demo", "", nil).
+		OnNode("node-02", "test -x /usr/local/bin/demo", "", errors.New("exit status 1"))
+	if err := NewInstaller().WithExecutor(fake).Install(tool, true); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	for _, call := range fake.Calls() {
+		if call.Host == "node-01" && !strings.HasPrefix(call.Command, "test -x") && !strings.HasPrefix(call.Command, "uname -s") {
+			t.Errorf("node-01 passed check and should be skipped, got %s", call)
+		}
+	}
+	if commands := fake.Commands("node-02"); !utils.StringInSlice("systemctl restart demo", commands) {
+		t.Errorf("node-02 should be installed, got %q", commands)
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// 资源安装方式
+const (
+	MethodBinary    = "binary"    // 安装可执行文件到 bin 目录
+	MethodPackage   = "package"   // 使用节点的包管理器安装
+	MethodContainer = "container" // 以容器方式运行 Image
+	MethodManifest  = "manifest"  // kubectl apply Files 中的清单
+	MethodScript    = "script"    // 只执行安装脚本
+)
+
+// MethodContext 安装方式执行时的上下文
+type MethodContext struct {
+	Executor utils.Executor
+	Resource types.Resource
+	Nodes    []*types.RemoteNode // 安装节点，未指定 hosts 时为本机
+	Files    []string            // 已下载并复制到节点的文件（URLs 和 Files），节点上的路径与本地相同
+}
+
+// MethodHandler 资源安装方式，在 PreInstall 之后、PostInstall 之前执行
+type MethodHandler interface {
+	Install(ctx *MethodContext) error
+}
+
+// MethodHandlerFunc 将函数转换为 MethodHandler
+type MethodHandlerFunc func(ctx *MethodContext) error
+
+func (f MethodHandlerFunc) Install(ctx *MethodContext) error {
+	return f(ctx)
+}
+
+// MethodUninstaller 支持卸载的安装方式实现该接口，在 RemoveScripts 之后执行
+type MethodUninstaller interface {
+	Uninstall(ctx *MethodContext) error
+}
+
+// builtinMethod 内置安装方式
+type builtinMethod struct {
+	install   func(ctx *MethodContext) error
+	uninstall func(ctx *MethodContext) error
+}
+
+func (m builtinMethod) Install(ctx *MethodContext) error {
+	return m.install(ctx)
+}
+
+func (m builtinMethod) Uninstall(ctx *MethodContext) error {
+	return m.uninstall(ctx)
+}
+
+func noop(ctx *MethodContext) error {
+	return nil
+}
+
+var methodHandlers = map[string]MethodHandler{
+	MethodBinary:    builtinMethod{install: installBinary, uninstall: uninstallBinary},
+	MethodPackage:   builtinMethod{install: installPackage, uninstall: uninstallPackage},
+	MethodContainer: builtinMethod{install: installContainer, uninstall: uninstallContainer},
+	MethodManifest:  builtinMethod{install: installManifest, uninstall: uninstallManifest},
+	MethodScript:    builtinMethod{install: noop, uninstall: noop},
+}
+
+// RegisterMethod 注册或替换安装方式
+func RegisterMethod(method string, handler MethodHandler) {
+	methodHandlers[method] = handler
+}
+
+// methodHandler 获取资源的安装方式，未设置 method 时只执行脚本
+func methodHandler(method string) (MethodHandler, error) {
+	if method == "" {
+		method = MethodScript
+	}
+	handler, ok := methodHandlers[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported install method %q", method)
+	}
+	return handler, nil
+}
+
+// runOnNodes 在所有安装节点上执行命令
+func (ctx *MethodContext) runOnNodes(command string) error {
+	for _, node := range ctx.Nodes {
+		if _, err := ctx.Executor.Stream(utils.RootContext(), node, command, utils.StreamOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 归档文件后缀，安装时解压并安装其中的可执行文件
+var archiveSuffixes = []string{".tar.gz", ".tgz", ".tar.xz", ".tar.bz2", ".zip"}
+
+// 不作为可执行文件安装的文件后缀
+var nonBinarySuffixes = []string{".service", ".yml", ".yaml", ".json", ".conf", ".toml", ".tar", ".txt", ".md"}
+
+// installBinary 将文件以指定权限安装到 bin 目录，归档文件解压后安装其中的可执行文件
+func installBinary(ctx *MethodContext) error {
+	res := ctx.Resource
+	binDir := binaryDir(res)
+	mode := res.Mode
+	if mode == "" {
+		mode = "0755"
+	}
+
+	var commands []string
+	for _, file := range ctx.Files {
+		base := filepath.Base(file)
+		switch {
+		case hasAnySuffix(base, archiveSuffixes):
+			extract := fmt.Sprintf("tar -xf %s -C \"$tmp\"", utils.ShellQuote(file))
+			if strings.HasSuffix(base, ".zip") {
+				extract = fmt.Sprintf("unzip -q %s -d \"$tmp\"", utils.ShellQuote(file))
+			}
+			filter := ""
+			if len(res.Binaries) > 0 {
+				names := make([]string, len(res.Binaries))
+				for j, name := range res.Binaries {
+					names[j] = "-name " + utils.ShellQuote(name)
+				}
+				filter = `\( ` + strings.Join(names, " -o ") + ` \) `
+			}
+			commands = append(commands, fmt.Sprintf(
+				"tmp=$(mktemp -d) && %s && find \"$tmp\" -type f -perm -u+x %s-exec install -m %s -t %s {} + ; rc=$?; rm -rf \"$tmp\"; [ $rc -eq 0 ]",
+				extract, filter, mode, utils.ShellQuote(binDir)))
+		case hasAnySuffix(base, nonBinarySuffixes):
+			utils.PrintDebug("%s 不是可执行文件，跳过", file)
+		default:
+			if target, ok := binaryTarget(res, file); ok {
+				commands = append(commands, fmt.Sprintf("install -m %s %s %s",
+					mode, utils.ShellQuote(file), utils.ShellQuote(target)))
+			}
+		}
+	}
+	if len(commands) == 0 {
+		utils.PrintWarning("%s 没有需要安装的可执行文件", res.Name)
+		return nil
+	}
+
+	utils.PrintInfo("安装 %s 到 %s", res.Name, binDir)
+	script := fmt.Sprintf("mkdir -p %s && %s", utils.ShellQuote(binDir), strings.Join(commands, " && "))
+	return ctx.runOnNodes(script)
+}
+
+// uninstallBinary 删除安装到 bin 目录的文件，归档文件中的可执行文件只有声明了 binaries 时才能删除
+func uninstallBinary(ctx *MethodContext) error {
+	res := ctx.Resource
+	binDir := binaryDir(res)
+	names := append([]string(nil), res.Binaries...)
+	for _, file := range ctx.Files {
+		base := filepath.Base(file)
+		switch {
+		case hasAnySuffix(base, archiveSuffixes):
+			if len(res.Binaries) == 0 {
+				utils.PrintWarning("%s 未声明 binaries，无法确定 %s 中安装的文件", res.Name, base)
+			}
+		case hasAnySuffix(base, nonBinarySuffixes):
+		default:
+			if name := binaryName(base); !utils.StringInSlice(name, names) && len(res.Binaries) == 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	paths := make([]string, len(names))
+	for j, name := range names {
+		paths[j] = utils.ShellQuote(filepath.Join(binDir, name))
+	}
+	utils.PrintInfo("删除 %s 中的 %s", binDir, strings.Join(names, " "))
+	return ctx.runOnNodes("rm -f " + strings.Join(paths, " "))
+}
+
+// binaryTarget 非归档文件在 bin 目录中的安装路径，不需要安装时返回 false
+func binaryTarget(res types.Resource, file string) (string, bool) {
+	base := filepath.Base(file)
+	if hasAnySuffix(base, archiveSuffixes) || hasAnySuffix(base, nonBinarySuffixes) {
+		return "", false
+	}
+	name := binaryName(base)
+	if len(res.Binaries) > 0 && !utils.StringInSlice(name, res.Binaries) {
+		return "", false
+	}
+	return filepath.Join(binaryDir(res), name), true
+}
+
+// binaryDir 可执行文件安装目录
+func binaryDir(res types.Resource) string {
+	if res.BinDir == "" {
+		return "/usr/local/bin"
+	}
+	return res.BinDir
+}
+
+// binaryName 去掉文件名中的平台后缀，如 runc.amd64 -> runc
+func binaryName(base string) string {
+	for _, suffix := range []string{".amd64", ".arm64", "-linux-amd64", "-linux-arm64", "_linux_amd64", "_linux_arm64"} {
+		if strings.HasSuffix(base, suffix) && len(base) > len(suffix) {
+			return strings.TrimSuffix(base, suffix)
+		}
+	}
+	return base
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageList 资源声明的软件包，已转义
+func packageList(res types.Resource) string {
+	packages := append([]string(nil), res.Packages...)
+	if res.Package != "" {
+		packages = append(packages, strings.Fields(res.Package)...)
+	}
+	for j, pkg := range packages {
+		packages[j] = utils.ShellQuote(pkg)
+	}
+	return strings.Join(packages, " ")
+}
+
+// installPackage 使用节点上的包管理器（apt-get、dnf、yum、zypper、apk）安装软件包
+func installPackage(ctx *MethodContext) error {
+	list := packageList(ctx.Resource)
+	if list == "" {
+		utils.PrintDebug("%s 没有声明 package，跳过包管理器安装", ctx.Resource.Name)
+		return nil
+	}
+
+	script := fmt.Sprintf(`if command -v apt-get >/dev/null 2>&1; then DEBIAN_FRONTEND=noninteractive apt-get install -y %[1]s || { apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get install -y %[1]s; }
+elif command -v dnf >/dev/null 2>&1; then dnf install -y %[1]s
+elif command -v yum >/dev/null 2>&1; then yum install -y %[1]s
+elif command -v zypper >/dev/null 2>&1; then zypper --non-interactive install %[1]s
+elif command -v apk >/dev/null 2>&1; then apk add --no-cache %[1]s
+else echo "no supported package manager found" >&2; exit 127; fi`, list)
+
+	utils.PrintInfo("使用包管理器安装 %s", list)
+	return ctx.runOnNodes(script)
+}
+
+// uninstallPackage 使用节点上的包管理器卸载软件包
+func uninstallPackage(ctx *MethodContext) error {
+	list := packageList(ctx.Resource)
+	if list == "" {
+		return nil
+	}
+
+	script := fmt.Sprintf(`if command -v apt-get >/dev/null 2>&1; then DEBIAN_FRONTEND=noninteractive apt-get remove -y %[1]s
+elif command -v dnf >/dev/null 2>&1; then dnf remove -y %[1]s
+elif command -v yum >/dev/null 2>&1; then yum remove -y %[1]s
+elif command -v zypper >/dev/null 2>&1; then zypper --non-interactive remove %[1]s
+elif command -v apk >/dev/null 2>&1; then apk del %[1]s
+else echo "no supported package manager found" >&2; exit 127; fi`, list)
+
+	utils.PrintInfo("使用包管理器卸载 %s", list)
+	return ctx.runOnNodes(script)
+}
+
+// installContainer 以容器方式运行资源的 Image，镜像一致时只确保容器已启动
+//
+// Image 和 Args 按节点渲染。
+func installContainer(ctx *MethodContext) error {
+	res := ctx.Resource
+	if res.Image == "" {
+		return fmt.Errorf("method container requires image")
+	}
+	name := utils.ShellQuote(res.Name)
+	for _, node := range ctx.Nodes {
+		data, err := utils.NodeTemplateData(ctx.Executor, node, res)
+		if err != nil {
+			return err
+		}
+		image, err := data.Render(res.Image)
+		if err != nil {
+			return fmt.Errorf("parse image failed: %w", err)
+		}
+		args := make([]string, 0, len(res.Args))
+		for _, arg := range res.Args {
+			parsed, err := data.Render(arg)
+			if err != nil {
+				return fmt.Errorf("parse args failed: %w", err)
+			}
+			args = append(args, utils.ShellQuote(parsed))
+		}
+
+		script := fmt.Sprintf(`rt=$(command -v docker || command -v nerdctl || command -v podman) || { echo "no container runtime found" >&2; exit 127; }
+if [ "$("$rt" inspect -f '{{.Config.Image}}' %[1]s 2>/dev/null)" = %[2]s ]; then "$rt" start %[1]s >/dev/null
+else "$rt" rm -f %[1]s >/dev/null 2>&1; "$rt" run -d --name %[1]s --restart unless-stopped %[3]s %[2]s; fi`,
+			name, utils.ShellQuote(image), strings.Join(args, " "))
+
+		utils.PrintInfo("[%s] 运行容器 %s (%s)", node.Host, res.Name, image)
+		if _, err := ctx.Executor.Stream(utils.RootContext(), node, script, utils.StreamOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstallContainer 删除资源的容器
+func uninstallContainer(ctx *MethodContext) error {
+	script := fmt.Sprintf(`rt=$(command -v docker || command -v nerdctl || command -v podman) || exit 0
+"$rt" rm -f %s >/dev/null 2>&1 || true`, utils.ShellQuote(ctx.Resource.Name))
+	utils.PrintInfo("删除容器 %s", ctx.Resource.Name)
+	return ctx.runOnNodes(script)
+}
+
+// kubeconfigProbe 节点上存在 kubectl 可用的 kubeconfig 时退出码为 0
+const kubeconfigProbe = `command -v kubectl >/dev/null 2>&1 && { [ -n "$KUBECONFIG" ] || [ -f "$HOME/.kube/config" ] || [ -f /etc/kubernetes/admin.conf ]; }`
+
+// manifestNode 选择执行 kubectl 的节点：master 角色的节点优先，返回第一个有 kubeconfig 的节点
+//
+// 清单作用于整个集群，只需部署一次；hosts 中的 worker 节点通常没有 kubeconfig。
+func (ctx *MethodContext) manifestNode() (*types.RemoteNode, error) {
+	var masters, others []*types.RemoteNode
+	for _, node := range ctx.Nodes {
+		if utils.NodeHasRole(*node, "master") {
+			masters = append(masters, node)
+		} else {
+			others = append(others, node)
+		}
+	}
+	for _, node := range append(masters, others...) {
+		if _, err := ctx.Executor.Run(node, kubeconfigProbe); err == nil {
+			return node, nil
+		}
+		utils.PrintDebug("[%s] 没有 kubeconfig，不在该节点执行 kubectl", node.Host)
+	}
+	return nil, fmt.Errorf("no node of %s has kubectl and a kubeconfig", ctx.Resource.Name)
+}
+
+// runKubectl 在 manifestNode 选择的节点上执行一次 kubectl 命令
+func (ctx *MethodContext) runKubectl(command string) error {
+	node, err := ctx.manifestNode()
+	if err != nil {
+		return err
+	}
+	_, err = ctx.Executor.Stream(utils.RootContext(), node, command, utils.StreamOptions{})
+	return err
+}
+
+// installManifest 使用 kubectl apply 部署 Files 中的清单，只在一个有 kubeconfig 的节点上执行
+func installManifest(ctx *MethodContext) error {
+	var commands []string
+	for _, file := range ctx.Files {
+		if hasAnySuffix(file, []string{".yml", ".yaml", ".json"}) {
+			commands = append(commands, "kubectl apply -f "+utils.ShellQuote(file))
+		}
+	}
+	if len(commands) == 0 {
+		return fmt.Errorf("method manifest requires yaml or json files")
+	}
+	utils.PrintInfo("部署 %s 清单", ctx.Resource.Name)
+	return ctx.runKubectl(strings.Join(commands, " && "))
+}
+
+// uninstallManifest 使用 kubectl delete 删除 Files 中的清单，只在一个有 kubeconfig 的节点上执行
+func uninstallManifest(ctx *MethodContext) error {
+	var commands []string
+	for j := len(ctx.Files) - 1; j >= 0; j-- {
+		if file := ctx.Files[j]; hasAnySuffix(file, []string{".yml", ".yaml", ".json"}) {
+			commands = append(commands, "kubectl delete --ignore-not-found -f "+utils.ShellQuote(file))
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	utils.PrintInfo("删除 %s 清单", ctx.Resource.Name)
+	return ctx.runKubectl(strings.Join(commands, " && "))
+}
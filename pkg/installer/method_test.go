@@ -0,0 +1,274 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// clusterNodes worker 在前的 k8s 节点，用于验证 master 优先
+func clusterNodes() []*types.RemoteNode {
+	return []*types.RemoteNode{
+		{Host: "worker-01", IP: "10.255.0.21", Role: "worker"},
+		{Host: "master-01", IP: "10.255.0.11", Role: "master"},
+		{Host: "master-02", IP: "10.255.0.12", Roles: []string{"master", "etcd"}},
+	}
+}
+
+// runCommands 返回执行的命令，忽略 kubeconfig 探测
+func runCommands(fake *utils.FakeExecutor) []string {
+	var commands []string
+	for _, call := range fake.Calls() {
+		if call.Op == utils.CallRun && call.Command != kubeconfigProbe {
+			commands = append(commands, call.Host+": "+call.Command)
+		}
+	}
+	return commands
+}
+
+func TestManifestMethodRunsOnce(t *testing.T) {
+	noKubeconfig := errors.New("exit status 1")
+	files := []string{"/tmp/somcli/crd.yaml", "/tmp/somcli/README.md", "/tmp/somcli/app.yaml"}
+
+	tests := []struct {
+		name      string
+		uninstall bool
+		fake      *utils.FakeExecutor
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name: "first master",
+			fake: utils.NewFakeExecutor(),
+			want: []string{"master-01: kubectl apply -f '/tmp/somcli/crd.yaml' && kubectl apply -f '/tmp/somcli/app.yaml'"},
+		},
+		{
+			name: "next master when the first has no kubeconfig",
+			fake: utils.NewFakeExecutor().OnNode("master-01", kubeconfigProbe, "", noKubeconfig),
+			want: []string{"master-02: kubectl apply -f '/tmp/somcli/crd.yaml' && kubectl apply -f '/tmp/somcli/app.yaml'"},
+		},
+		{
+			name: "worker with kubeconfig when no master has one",
+			fake: utils.NewFakeExecutor().
+				OnNode("master-01", kubeconfigProbe, "", noKubeconfig).
+				OnNode("master-02", kubeconfigProbe, "", noKubeconfig),
+			want: []string{"worker-01: kubectl apply -f '/tmp/somcli/crd.yaml' && kubectl apply -f '/tmp/somcli/app.yaml'"},
+		},
+		{
+			name:    "no kubeconfig anywhere",
+			fake:    utils.NewFakeExecutor().On(kubeconfigProbe, "", noKubeconfig),
+			wantErr: true,
+		},
+		{
+			name:      "delete in reverse order",
+			uninstall: true,
+			fake:      utils.NewFakeExecutor(),
+			want:      []string{"master-01: kubectl delete --ignore-not-found -f '/tmp/somcli/app.yaml' && kubectl delete --ignore-not-found -f '/tmp/somcli/crd.yaml'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &MethodContext{
+				Executor: tt.fake,
+				Resource: types.Resource{Name: "demo", Method: MethodManifest},
+				Nodes:    clusterNodes(),
+				Files:    files,
+			}
+			var err error
+			if tt.uninstall {
+				err = uninstallManifest(ctx)
+			} else {
+				err = installManifest(ctx)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := runCommands(tt.fake); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestMethodRequiresManifests(t *testing.T) {
+	ctx := &MethodContext{
+		Executor: utils.NewFakeExecutor(),
+		Resource: types.Resource{Name: "demo", Method: MethodManifest},
+		Nodes:    clusterNodes(),
+		Files:    []string{"/tmp/somcli/README.md"},
+	}
+	if err := installManifest(ctx); err == nil {
+		t.Error("installManifest() should fail without yaml or json files")
+	}
+}
+
+func TestPackageMethod(t *testing.T) {
+	tests := []struct {
+		name      string
+		res       types.Resource
+		uninstall bool
+		want      []string // 脚本中应包含的内容
+	}{
+		{
+			name: "install",
+			res:  types.Resource{Name: "tools", Package: "curl socat", Packages: []string{"conntrack"}},
+			want: []string{
+				"apt-get install -y 'conntrack' 'curl' 'socat' || { apt-get update -q",
+				"elif command -v dnf >/dev/null 2>&1; then dnf install -y 'conntrack' 'curl' 'socat'",
+				"elif command -v yum >/dev/null 2>&1; then yum install -y",
+				"elif command -v zypper >/dev/null 2>&1; then zypper --non-interactive install",
+				"elif command -v apk >/dev/null 2>&1; then apk add --no-cache",
+				"exit 127",
+			},
+		},
+		{
+			name:      "uninstall",
+			res:       types.Resource{Name: "tools", Packages: []string{"conntrack"}},
+			uninstall: true,
+			want: []string{
+				"apt-get remove -y 'conntrack'",
+				"dnf remove -y 'conntrack'",
+				"apk del 'conntrack'",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := utils.NewFakeExecutor()
+			ctx := &MethodContext{Executor: fake, Resource: tt.res, Nodes: clusterNodes()[:2]}
+			var err error
+			if tt.uninstall {
+				err = uninstallPackage(ctx)
+			} else {
+				err = installPackage(ctx)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := fake.Calls()
+			if len(calls) != 2 || calls[0].Host != "worker-01" || calls[1].Host != "master-01" {
+				t.Fatalf("package method should run on every node, got %v", calls)
+			}
+			script := calls[0].Command
+			for _, want := range tt.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("script should contain %q:\n%s", want, script)
+				}
+			}
+		})
+	}
+}
+
+func TestPackageMethodWithoutPackages(t *testing.T) {
+	fake := utils.NewFakeExecutor()
+	ctx := &MethodContext{Executor: fake, Resource: types.Resource{Name: "tools"}, Nodes: clusterNodes()}
+	if err := installPackage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := uninstallPackage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("no command should run without packages, got %v", calls)
+	}
+}
+
+func TestBinaryMethod(t *testing.T) {
+	tests := []struct {
+		name      string
+		res       types.Resource
+		files     []string
+		uninstall bool
+		want      string
+	}{
+		{
+			name:  "default bin dir and mode",
+			res:   types.Resource{Name: "runc"},
+			files: []string{"/tmp/somcli/runc.amd64", "/tmp/somcli/runc.service"},
+			want:  "mkdir -p '/usr/local/bin' && install -m 0755 '/tmp/somcli/runc.amd64' '/usr/local/bin/runc'",
+		},
+		{
+			name:  "custom bin dir and mode",
+			res:   types.Resource{Name: "tool", BinDir: "/opt/tool/bin", Mode: "0700"},
+			files: []string{"/tmp/somcli/tool-linux-amd64"},
+			want:  "mkdir -p '/opt/tool/bin' && install -m 0700 '/tmp/somcli/tool-linux-amd64' '/opt/tool/bin/tool'",
+		},
+		{
+			name:  "binaries filter",
+			res:   types.Resource{Name: "tools", Binaries: []string{"a"}},
+			files: []string{"/tmp/somcli/a", "/tmp/somcli/b"},
+			want:  "mkdir -p '/usr/local/bin' && install -m 0755 '/tmp/somcli/a' '/usr/local/bin/a'",
+		},
+		{
+			name:  "archive",
+			res:   types.Resource{Name: "cni-plugins", BinDir: "/opt/cni/bin", Binaries: []string{"bridge", "loopback"}},
+			files: []string{"/tmp/somcli/cni-plugins.tgz"},
+			want: "mkdir -p '/opt/cni/bin' && tmp=$(mktemp -d) && tar -xf '/tmp/somcli/cni-plugins.tgz' -C \"$tmp\" && " +
+				"find \"$tmp\" -type f -perm -u+x \\( -name 'bridge' -o -name 'loopback' \\) -exec install -m 0755 -t '/opt/cni/bin' {} + ; rc=$?; rm -rf \"$tmp\"; [ $rc -eq 0 ]",
+		},
+		{
+			name:      "uninstall",
+			res:       types.Resource{Name: "tool", BinDir: "/opt/tool/bin"},
+			files:     []string{"/tmp/somcli/tool-linux-amd64", "/tmp/somcli/tool.yaml"},
+			uninstall: true,
+			want:      "rm -f '/opt/tool/bin/tool'",
+		},
+		{
+			name:      "uninstall archive binaries",
+			res:       types.Resource{Name: "cni-plugins", BinDir: "/opt/cni/bin", Binaries: []string{"bridge", "loopback"}},
+			files:     []string{"/tmp/somcli/cni-plugins.tgz"},
+			uninstall: true,
+			want:      "rm -f '/opt/cni/bin/bridge' '/opt/cni/bin/loopback'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := utils.NewFakeExecutor()
+			ctx := &MethodContext{Executor: fake, Resource: tt.res, Nodes: clusterNodes()[:1], Files: tt.files}
+			var err error
+			if tt.uninstall {
+				err = uninstallBinary(ctx)
+			} else {
+				err = installBinary(ctx)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.Commands("worker-01"); !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("commands =\n%q\nwant\n%q", got, []string{tt.want})
+			}
+		})
+	}
+}
+
+func TestMethodHandler(t *testing.T) {
+	if _, err := methodHandler(""); err != nil {
+		t.Errorf("empty method should default to script, got %v", err)
+	}
+	if _, err := methodHandler("rpm"); err == nil {
+		t.Error("unknown method should fail")
+	}
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// 资源状态
+const (
+	StatusInstalled     = "installed"
+	StatusNotInstalled  = "not-installed"
+	StatusOutdated      = "outdated"       // 已安装的版本与配置不同，再次安装即升级
+	StatusChanged       = "changed"        // 版本相同但资源定义已修改
+	StatusDrifted       = "drifted"        // 节点上安装的文件被修改或删除
+	StatusMarkerMissing = "marker-missing" // 本地有记录但节点上没有标记文件
+	StatusUnreachable   = "unreachable"
+)
+
+// NodeMarkerDir 节点上记录已安装资源的目录
+var NodeMarkerDir = "/var/lib/somcli/installed"
+
+// stateMu 保护本地状态文件，应用流程并行安装时会同时更新
+var stateMu sync.Mutex
+
+// StateFile 本地状态文件路径
+func StateFile() string {
+	return filepath.Join(utils.GetDataDir(), "install-state.json")
+}
+
+// LoadInstallState 读取本地状态文件，不存在时返回空状态
+func LoadInstallState() (*types.InstallState, error) {
+	state := &types.InstallState{Nodes: make(map[string]map[string]types.ResourceState)}
+	data, err := os.ReadFile(StateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("read install state failed: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %w", StateFile(), err)
+	}
+	if state.Nodes == nil {
+		state.Nodes = make(map[string]map[string]types.ResourceState)
+	}
+	return state, nil
+}
+
+// updateInstallState 在锁内读取、修改并保存本地状态文件
+func updateInstallState(update func(state *types.InstallState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	state, err := LoadInstallState()
+	if err != nil {
+		return err
+	}
+	update(state)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.CreateDir(filepath.Dir(StateFile())); err != nil {
+		return err
+	}
+	tmp := StateFile() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write install state failed: %w", err)
+	}
+	return os.Rename(tmp, StateFile())
+}
+
+// stateNodeName 节点在状态文件中的名称
+func stateNodeName(node *types.RemoteNode) string {
+	if node.Host != "" {
+		return node.Host
+	}
+	return node.IP
+}
+
+// markerPath 节点上资源标记文件的路径
+func markerPath(name string) string {
+	return path.Join(NodeMarkerDir, name+".json")
+}
+
+// resourceFingerprint 资源定义（不含安装节点）的摘要
+func resourceFingerprint(tool types.Resource) string {
+	tool.Hosts = nil
+	data, _ := json.Marshal(tool)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readMarker 读取节点上的标记文件，不存在时返回 nil
+func (i *Installer) readMarker(node *types.RemoteNode, name string) (*types.ResourceState, error) {
+	exists, err := i.executor.FileExists(node, markerPath(name))
+	if err != nil || !exists {
+		return nil, err
+	}
+	output, err := i.executor.Run(node, "cat "+utils.ShellQuote(markerPath(name)))
+	if err != nil {
+		return nil, err
+	}
+	var marker types.ResourceState
+	if err := json.Unmarshal([]byte(output), &marker); err != nil {
+		return nil, fmt.Errorf("parse marker %s failed: %w", markerPath(name), err)
+	}
+	return &marker, nil
+}
+
+// upToDate 节点上已安装相同版本和定义的资源
+func (i *Installer) upToDate(state *types.InstallState, node *types.RemoteNode, tool types.Resource, fingerprint string) bool {
+	record, ok := state.Nodes[stateNodeName(node)][tool.Name]
+	if !ok || record.Version != tool.Version || record.Fingerprint != fingerprint {
+		return false
+	}
+	marker, err := i.readMarker(node, tool.Name)
+	if err != nil {
+		utils.PrintDebug("read marker on %s failed: %v", stateNodeName(node), err)
+		return false
+	}
+	return marker != nil && marker.Version == tool.Version && marker.Fingerprint == fingerprint
+}
+
+// pendingNodes 过滤掉已安装相同版本的节点
+func (i *Installer) pendingNodes(tool types.Resource, nodes []*types.RemoteNode) ([]*types.RemoteNode, error) {
+	if i.force {
+		return nodes, nil
+	}
+	state, err := LoadInstallState()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := resourceFingerprint(tool)
+	var pending []*types.RemoteNode
+	for _, node := range nodes {
+		if i.upToDate(state, node, tool, fingerprint) {
+			utils.PrintInfo("[%s] %s %s 已安装，跳过", stateNodeName(node), tool.Name, tool.Version)
+			continue
+		}
+		if record, ok := state.Nodes[stateNodeName(node)][tool.Name]; ok && record.Version != tool.Version {
+			utils.PrintInfo("[%s] 升级 %s %s -> %s", stateNodeName(node), tool.Name, record.Version, tool.Version)
+		}
+		pending = append(pending, node)
+	}
+	return pending, nil
+}
+
+// recordInstall 记录安装结果到本地状态文件和节点标记文件，extraFiles 的键为节点名称
+func (i *Installer) recordInstall(tool types.Resource, nodes []*types.RemoteNode, files map[string]string, extraFiles map[string]map[string]string) error {
+	record := types.ResourceState{
+		Name:        tool.Name,
+		Version:     tool.Version,
+		Method:      tool.Method,
+		Fingerprint: resourceFingerprint(tool),
+		InstalledAt: time.Now().UTC(),
+		RunID:       utils.CurrentRunID(),
+	}
+
+	tmp, err := os.CreateTemp(utils.GetTmpDir(), "marker-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	records := make(map[string]types.ResourceState, len(nodes))
+	for _, node := range nodes {
+		nodeRecord := record
+		nodeRecord.Files = make(map[string]string)
+		for path, sum := range extraFiles[stateNodeName(node)] {
+			nodeRecord.Files[path] = sum
+		}
+		// 本机上复制的文件即下载缓存，不作为安装的文件
+		for path, sum := range files {
+			if !utils.IsLocalNode(node) || !strings.HasPrefix(path, utils.GetDownloadDir()) {
+				nodeRecord.Files[path] = sum
+			}
+		}
+
+		data, err := json.MarshalIndent(nodeRecord, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(tmp.Name(), data, 0644); err != nil {
+			return err
+		}
+		if err := i.executor.Copy(node, tmp.Name(), markerPath(tool.Name)); err != nil {
+			return fmt.Errorf("write marker on %s failed: %w", stateNodeName(node), err)
+		}
+		records[stateNodeName(node)] = nodeRecord
+	}
+
+	return updateInstallState(func(state *types.InstallState) {
+		for name, nodeRecord := range records {
+			if state.Nodes[name] == nil {
+				state.Nodes[name] = make(map[string]types.ResourceState)
+			}
+			state.Nodes[name][tool.Name] = nodeRecord
+		}
+	})
+}
+
+// forgetInstall 删除资源的本地记录和节点标记文件
+func (i *Installer) forgetInstall(tool types.Resource, nodes []*types.RemoteNode) error {
+	for _, node := range nodes {
+		if _, err := i.executor.Run(node, "rm -f "+utils.ShellQuote(markerPath(tool.Name))); err != nil {
+			return fmt.Errorf("remove marker on %s failed: %w", stateNodeName(node), err)
+		}
+	}
+	return updateInstallState(func(state *types.InstallState) {
+		for _, node := range nodes {
+			name := stateNodeName(node)
+			delete(state.Nodes[name], tool.Name)
+			if len(state.Nodes[name]) == 0 {
+				delete(state.Nodes, name)
+			}
+		}
+	})
+}
+
+// installedFiles 计算安装到节点上的文件及其 sha256：复制的文件和 binary 方式安装的文件
+func installedFiles(tool types.Resource, files []string) (map[string]string, error) {
+	installed := make(map[string]string)
+	for _, file := range files {
+		sum, err := utils.CalculateLocalHash(file, sha256.New)
+		if err != nil {
+			return nil, err
+		}
+		installed[file] = sum
+		if tool.Method == MethodBinary {
+			if target, ok := binaryTarget(tool, file); ok {
+				installed[target] = sum
+			}
+		}
+	}
+	return installed, nil
+}
+
+// Status 对比配置与本地记录、节点标记文件和节点上文件的校验和
+func (i *Installer) Status(configPath string) ([]types.ResourceStatus, error) {
+	resources, err := loadInstalledResources(configPath)
+	if err != nil {
+		return nil, err
+	}
+	state, err := LoadInstallState()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []types.ResourceStatus
+	for _, tool := range resources {
+		fingerprint := resourceFingerprint(tool)
+		nodes, err := installNodes(tool)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			status := types.ResourceStatus{Node: stateNodeName(node), Resource: tool.Name, Desired: tool.Version}
+			record, ok := state.Nodes[status.Node][tool.Name]
+			if !ok {
+				status.Status = StatusNotInstalled
+				statuses = append(statuses, status)
+				continue
+			}
+			status.Installed = record.Version
+			i.checkNode(&status, node, tool, record, fingerprint)
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// checkNode 检查节点上的标记文件和已安装文件
+func (i *Installer) checkNode(status *types.ResourceStatus, node *types.RemoteNode, tool types.Resource, record types.ResourceState, fingerprint string) {
+	marker, err := i.readMarker(node, tool.Name)
+	if err != nil {
+		status.Status = StatusUnreachable
+		status.Detail = err.Error()
+		return
+	}
+	if marker == nil {
+		status.Status = StatusMarkerMissing
+		status.Detail = markerPath(tool.Name) + " not found"
+		return
+	}
+
+	if record.Version != tool.Version {
+		status.Status = StatusOutdated
+		status.Detail = fmt.Sprintf("upgrade %s -> %s", record.Version, tool.Version)
+		return
+	}
+	if drift := i.fileDrift(node, record.Files); len(drift) > 0 {
+		status.Status = StatusDrifted
+		status.Detail = strings.Join(drift, ", ")
+		return
+	}
+	switch {
+	case record.Fingerprint != fingerprint:
+		status.Status = StatusChanged
+		status.Detail = "resource definition changed"
+	default:
+		status.Status = StatusInstalled
+		status.Detail = "installed " + record.InstalledAt.Local().Format("2006-01-02 15:04:05")
+	}
+}
+
+// fileDrift 返回节点上校验和不一致或已删除的文件
+func (i *Installer) fileDrift(node *types.RemoteNode, files map[string]string) []string {
+	if len(files) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	quoted := make([]string, len(paths))
+	for j, path := range paths {
+		quoted[j] = utils.ShellQuote(path)
+	}
+	output, err := i.executor.Run(node, "sha256sum "+strings.Join(quoted, " ")+" 2>/dev/null; true")
+	if err != nil {
+		return []string{err.Error()}
+	}
+	current := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			current[fields[1]] = fields[0]
+		}
+	}
+
+	var drift []string
+	for _, path := range paths {
+		switch sum, ok := current[path]; {
+		case !ok:
+			drift = append(drift, path+" missing")
+		case sum != files[path]:
+			drift = append(drift, path+" modified")
+		}
+	}
+	return drift
+}
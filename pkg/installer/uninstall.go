@@ -0,0 +1,183 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+// UninstallFromFile 按安装的逆序卸载配置中的所有资源
+func (i *Installer) UninstallFromFile(configPath string) error {
+	resources, err := loadInstalledResources(configPath)
+	if err != nil {
+		return err
+	}
+	for j := len(resources) - 1; j >= 0; j-- {
+		if err := i.Uninstall(resources[j]); err != nil {
+			return fmt.Errorf("%s uninstall failed: %w", resources[j].Name, err)
+		}
+	}
+	return nil
+}
+
+// UninstallTool 根据名称卸载资源
+func (i *Installer) UninstallTool(configPath string, name string) error {
+	resources, err := loadInstalledResources(configPath)
+	if err != nil {
+		return err
+	}
+	found := false
+	for j := len(resources) - 1; j >= 0; j-- {
+		if resources[j].Name != name {
+			continue
+		}
+		found = true
+		if err := i.Uninstall(resources[j]); err != nil {
+			return fmt.Errorf("%s uninstall failed: %w", name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("resource %s not found in %s", name, configPath)
+	}
+	return nil
+}
+
+// loadInstalledResources 加载配置中会被安装的资源，定义了应用时按流程解析安装节点
+func loadInstalledResources(configPath string) ([]types.Resource, error) {
+	manifest, err := utils.LoadManifest(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("load config failed: %w", err)
+	}
+	utils.ApplyManifest(manifest)
+
+	if len(manifest.Apps) == 0 {
+		return manifest.Resources, nil
+	}
+	var resources []types.Resource
+	for _, app := range manifest.Apps {
+		graph, err := buildFlowGraph(manifest, app, appNodes(app))
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range graph {
+			if node.resource.Hosts != nil && len(node.resource.Hosts) == 0 {
+				continue
+			}
+			resources = append(resources, node.resource)
+		}
+	}
+	return resources, nil
+}
+
+// Uninstall 卸载资源：执行 RemoveScripts，按 method 卸载，删除安装记录中的文件和安装记录
+//
+// 只处理本地状态文件中有该资源安装记录的节点，没有记录的节点输出警告后跳过。
+func (i *Installer) Uninstall(tool types.Resource) error {
+	handler, err := methodHandler(tool.Method)
+	if err != nil {
+		return err
+	}
+
+	utils.PrintStage("开始卸载 -> %s", tool.Name)
+	nodes, err := installNodes(tool)
+	if err != nil {
+		return err
+	}
+	state, err := LoadInstallState()
+	if err != nil {
+		return err
+	}
+	var installed []*types.RemoteNode
+	records := make(map[*types.RemoteNode]types.ResourceState, len(nodes))
+	for _, node := range nodes {
+		record, ok := state.Nodes[stateNodeName(node)][tool.Name]
+		if !ok {
+			utils.PrintWarning("[%s] 没有 %s 的安装记录，跳过", stateNodeName(node), tool.Name)
+			continue
+		}
+		installed = append(installed, node)
+		records[node] = record
+	}
+	if len(installed) == 0 {
+		utils.PrintWarning("%s 没有安装记录，无需卸载", tool.Name)
+		return nil
+	}
+	if len(tool.Hosts) > 0 {
+		tool.Hosts = nodeHosts(installed)
+	}
+
+	groups, err := i.groupNodeFiles(tool, installed)
+	if err != nil {
+		return err
+	}
+
+	utils.PrintStage("执行卸载脚本")
+	if err := utils.RunScriptsWith(i.executor, tool.RemoveScripts, tool); err != nil {
+		return fmt.Errorf("remove scripts failed: %w", err)
+	}
+
+	if uninstaller, ok := handler.(MethodUninstaller); ok {
+		for _, group := range groups {
+			ctx := &MethodContext{Executor: i.executor, Resource: tool, Nodes: group.nodes, Files: group.files()}
+			if err := uninstaller.Uninstall(ctx); err != nil {
+				return fmt.Errorf("%s uninstall failed: %w", tool.Method, err)
+			}
+		}
+	}
+
+	// 安装记录中的文件：扩展文件、复制到远程节点的文件和 binary 安装的文件，本机的下载缓存不在记录中
+	utils.PrintStage("删除安装的文件")
+	for _, node := range installed {
+		paths := make([]string, 0, len(records[node].Files))
+		for path := range records[node].Files {
+			paths = append(paths, path)
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		sort.Strings(paths)
+		for j, path := range paths {
+			paths[j] = utils.ShellQuote(path)
+		}
+		if err := i.removeOnNodes([]*types.RemoteNode{node}, paths); err != nil {
+			return err
+		}
+	}
+
+	if err := i.forgetInstall(tool, installed); err != nil {
+		return fmt.Errorf("update install state failed: %w", err)
+	}
+
+	utils.PrintSuccess("%s %s 已卸载", tool.Name, tool.Version)
+	return nil
+}
+
+// removeOnNodes 在节点上删除文件
+func (i *Installer) removeOnNodes(nodes []*types.RemoteNode, quotedPaths []string) error {
+	command := "rm -f " + strings.Join(quotedPaths, " ")
+	for _, node := range nodes {
+		utils.PrintInfo("[%s] %s", node.Host, command)
+		if _, err := i.executor.Run(node, command); err != nil {
+			return fmt.Errorf("remove files on %s failed: %w", node.Host, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package installer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/utils"
+)
+
+func TestUninstallUsesInstallRecord(t *testing.T) {
+	workDir := setupTestEnv(t, testNodes)
+	tool := testBinaryResource(t, workDir)
+	tool.RemoveScripts = append(tool.RemoveScripts, tool.PreInstall...)
+	file := tool.Files[0]
+
+	// 只在 node-01 上安装
+	installed := tool
+	installed.Hosts = []string{"node-01"}
+	fake := newTestExecutor()
+	if err := NewInstaller().WithExecutor(fake).Install(installed, true); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	fake.Reset()
+	if err := NewInstaller().WithExecutor(fake).Uninstall(tool); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+
+	if calls := describeCalls(fake.Calls()); len(calls) == 0 {
+		t.Fatal("Uninstall() did nothing")
+	}
+	for _, call := range fake.Calls() {
+		if call.Host == "node-02" {
+			t.Errorf("node-02 has no install record and should be skipped, got %s", call)
+		}
+	}
+
+	want := []string{
+		"node-01: systemctl stop demo || true",
+		"node-01: rm -f '/usr/local/bin/demo'",
+		"node-01: rm -f '/etc/demo/demo.conf' " + utils.ShellQuote(file) + " '/usr/local/bin/demo'",
+		"node-01: rm -f " + utils.ShellQuote(markerPath("demo")),
+	}
+	if got := describeCalls(fake.Calls()); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	state, err := LoadInstallState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Nodes) != 0 {
+		t.Errorf("install state should be empty after uninstall, got %v", state.Nodes)
+	}
+}
+
+func TestUninstallWithoutRecord(t *testing.T) {
+	workDir := setupTestEnv(t, testNodes)
+	tool := testBinaryResource(t, workDir)
+	tool.RemoveScripts = tool.PreInstall
+
+	fake := newTestExecutor()
+	if err := NewInstaller().WithExecutor(fake).Uninstall(tool); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("no command should run without an install record, got %v", calls)
+	}
+}
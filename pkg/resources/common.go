@@ -48,6 +48,16 @@ var ResourceMapper = map[string]string{
 	"ct":         "containers",
 	"stack":      "stacks",
 	"stacks":     "stacks",
+	"secret":     "secrets",
+	"secrets":    "secrets",
+	"config":     "configs",
+	"configs":    "configs",
+	"network":    "networks",
+	"networks":   "networks",
+	"net":        "networks",
+	"volume":     "volumes",
+	"volumes":    "volumes",
+	"vol":        "volumes",
 }
 
 // DetectResourceType 检测并规范化资源类型
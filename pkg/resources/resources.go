@@ -43,16 +43,7 @@ func GetResources(clusterType cluster.ClusterType, resourceType, namespace strin
 		return utils.RunCommandWithOutput("kubectl", args...)
 
 	case cluster.TypeSwarm:
-		switch normalizedType {
-		case "services":
-			return utils.RunCommandWithOutput("docker", "service", "ls")
-		case "nodes":
-			return utils.RunCommandWithOutput("docker", "node", "ls")
-		case "stacks":
-			return utils.RunCommandWithOutput("docker", "stack", "ls")
-		default:
-			return "", fmt.Errorf("unsupported Swarm resource type: %s", resourceType)
-		}
+		return GetSwarmResources(normalizedType, namespace)
 
 	case cluster.TypeDocker:
 		switch normalizedType {
@@ -76,11 +67,10 @@ func ApplyResources(clusterType cluster.ClusterType, file string) error {
 		return utils.RunCommand("kubectl", "apply", "-f", file)
 
 	case cluster.TypeSwarm:
-		stackName, composeFile, err := convertToStackFormat(file)
-		if err != nil {
-			return fmt.Errorf("failed to prepare Swarm stack: %w", err)
+		if err := ApplySwarmResources(file); err != nil {
+			return fmt.Errorf("failed to deploy Swarm stack: %w", err)
 		}
-		return utils.RunCommand("docker", "stack", "deploy", "-c", composeFile, stackName)
+		return nil
 
 	case cluster.TypeDocker:
 		return utils.RunCommand("docker-compose", "-f", file, "up", "-d")
@@ -106,14 +96,7 @@ func DeleteResource(clusterType cluster.ClusterType, resourceType, resourceName,
 		return utils.RunCommand("kubectl", args...)
 
 	case cluster.TypeSwarm:
-		switch normalizedType {
-		case "services":
-			return utils.RunCommand("docker", "service", "rm", resourceName)
-		case "stacks":
-			return utils.RunCommand("docker", "stack", "rm", resourceName)
-		default:
-			return fmt.Errorf("unsupported Swarm resource type for deletion: %s", resourceType)
-		}
+		return DeleteSwarmResource(normalizedType, resourceName)
 
 	case cluster.TypeDocker:
 		switch normalizedType {
@@ -146,16 +129,7 @@ func DescribeResource(clusterType cluster.ClusterType, resourceType, resourceNam
 		return utils.RunCommandWithOutput("kubectl", args...)
 
 	case cluster.TypeSwarm:
-		switch normalizedType {
-		case "services":
-			return utils.RunCommandWithOutput("docker", "service", "inspect", "--pretty", resourceName)
-		case "nodes":
-			return utils.RunCommandWithOutput("docker", "node", "inspect", "--pretty", resourceName)
-		case "stacks":
-			return utils.RunCommandWithOutput("docker", "stack", "ps", resourceName)
-		default:
-			return "", fmt.Errorf("unsupported Swarm resource type for describe: %s", resourceType)
-		}
+		return DescribeSwarmResource(normalizedType, resourceName)
 
 	case cluster.TypeDocker:
 		switch normalizedType {
@@ -171,3 +145,18 @@ func DescribeResource(clusterType cluster.ClusterType, resourceType, resourceNam
 		return "", fmt.Errorf("unsupported cluster type: %s", clusterType)
 	}
 }
+
+// CreateResource 创建资源（目前仅支持 Swarm 的 secret/config/network/volume）
+func CreateResource(clusterType cluster.ClusterType, resourceType, resourceName string, opts SwarmCreateOptions) error {
+	normalizedType, err := DetectResourceType(resourceType)
+	if err != nil {
+		return fmt.Errorf("invalid resource type: %w", err)
+	}
+
+	switch clusterType {
+	case cluster.TypeSwarm:
+		return CreateSwarmResource(normalizedType, resourceName, opts)
+	default:
+		return fmt.Errorf("create is not supported for cluster type: %s", clusterType)
+	}
+}
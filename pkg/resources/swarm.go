@@ -19,11 +19,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/structure-projects/somcli/pkg/utils"
 	"gopkg.in/yaml.v2"
 )
 
+// SwarmCreateOptions 创建 Swarm secret/config/network/volume 的参数
+type SwarmCreateOptions struct {
+	FromFile    string   // secret/config 内容来源文件
+	FromLiteral string   // secret/config 字面量内容
+	Labels      []string // 标签 key=value
+	Driver      string   // network/volume 驱动
+	Attachable  bool     // overlay 网络是否允许独立容器接入
+	Subnets     []string // network 子网
+}
+
 // GetSwarmResources 获取Swarm资源
 func GetSwarmResources(resourceType, namespace string) (string, error) {
 	switch resourceType {
@@ -33,6 +44,14 @@ func GetSwarmResources(resourceType, namespace string) (string, error) {
 		return utils.RunCommandWithOutput("docker", "node", "ls")
 	case "stacks":
 		return utils.RunCommandWithOutput("docker", "stack", "ls")
+	case "secrets":
+		return utils.RunCommandWithOutput("docker", "secret", "ls")
+	case "configs":
+		return utils.RunCommandWithOutput("docker", "config", "ls")
+	case "networks":
+		return utils.RunCommandWithOutput("docker", "network", "ls", "--filter", "driver=overlay")
+	case "volumes":
+		return utils.RunCommandWithOutput("docker", "volume", "ls")
 	default:
 		return "", fmt.Errorf("unsupported Swarm resource type: %s", resourceType)
 	}
@@ -46,7 +65,73 @@ func ApplySwarmResources(file string) error {
 		return err
 	}
 
-	return utils.RunCommand("docker", "stack", "deploy", "-c", composeFile, stackName)
+	if err := utils.RunCommand("docker", "stack", "deploy", "-c", composeFile, stackName); err != nil {
+		return err
+	}
+
+	// 部署完成后清理不再被引用的旧版本 secret/config
+	pruneStackObjects(stackName, composeFile)
+	return nil
+}
+
+// CreateSwarmResource 创建Swarm资源
+func CreateSwarmResource(resourceType, name string, opts SwarmCreateOptions) error {
+	switch resourceType {
+	case "secrets", "configs":
+		return createSwarmObject(strings.TrimSuffix(resourceType, "s"), name, opts)
+	case "networks":
+		driver := opts.Driver
+		if driver == "" {
+			driver = "overlay"
+		}
+		args := []string{"network", "create", "--driver", driver}
+		if opts.Attachable {
+			args = append(args, "--attachable")
+		}
+		for _, subnet := range opts.Subnets {
+			args = append(args, "--subnet", subnet)
+		}
+		for _, label := range opts.Labels {
+			args = append(args, "--label", label)
+		}
+		args = append(args, name)
+		return utils.RunCommand("docker", args...)
+	case "volumes":
+		args := []string{"volume", "create"}
+		if opts.Driver != "" {
+			args = append(args, "--driver", opts.Driver)
+		}
+		for _, label := range opts.Labels {
+			args = append(args, "--label", label)
+		}
+		args = append(args, name)
+		return utils.RunCommand("docker", args...)
+	default:
+		return fmt.Errorf("unsupported Swarm resource type for create: %s", resourceType)
+	}
+}
+
+// createSwarmObject 从文件或字面量创建 secret/config
+func createSwarmObject(kind, name string, opts SwarmCreateOptions) error {
+	if (opts.FromFile == "") == (opts.FromLiteral == "") {
+		return fmt.Errorf("exactly one of --from-file or --from-literal is required for %s", kind)
+	}
+
+	args := []string{kind, "create"}
+	for _, label := range opts.Labels {
+		args = append(args, "--label", label)
+	}
+
+	if opts.FromFile != "" {
+		args = append(args, name, opts.FromFile)
+		_, err := utils.RunCommandWithOutput("docker", args...)
+		return err
+	}
+
+	// 字面量通过标准输入传递，避免出现在进程列表中
+	args = append(args, name, "-")
+	_, err := utils.RunCommandWithStdin(opts.FromLiteral, "docker", args...)
+	return err
 }
 
 // DeleteSwarmResource 删除Swarm资源
@@ -56,6 +141,14 @@ func DeleteSwarmResource(resourceType, name string) error {
 		return utils.RunCommand("docker", "service", "rm", name)
 	case "stacks":
 		return utils.RunCommand("docker", "stack", "rm", name)
+	case "secrets":
+		return utils.RunCommand("docker", "secret", "rm", name)
+	case "configs":
+		return utils.RunCommand("docker", "config", "rm", name)
+	case "networks":
+		return utils.RunCommand("docker", "network", "rm", name)
+	case "volumes":
+		return utils.RunCommand("docker", "volume", "rm", name)
 	default:
 		return fmt.Errorf("unsupported Swarm resource type for deletion: %s", resourceType)
 	}
@@ -81,6 +174,12 @@ func convertToStackFormat(inputFile string) (string, string, error) {
 		manifest.Stack = filepath.Base(inputFile[:len(inputFile)-len(filepath.Ext(inputFile))])
 	}
 
+	// 预先创建或轮换文件中声明的 secret/config
+	data, err = prepareStackObjects(manifest.Stack, filepath.Dir(inputFile), data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to prepare secrets/configs: %w", err)
+	}
+
 	// 保存为临时文件
 	tempFile := filepath.Join(utils.GetWorkDir(), "docker-stack-"+manifest.Stack+".yaml")
 	if err := os.WriteFile(tempFile, data, 0644); err != nil {
@@ -100,6 +199,14 @@ func DescribeSwarmResource(resourceType, name string) (string, error) {
 	case "stacks":
 		// Docker stack没有直接describe命令，获取所有服务
 		return utils.RunCommandWithOutput("docker", "stack", "services", name)
+	case "secrets":
+		return utils.RunCommandWithOutput("docker", "secret", "inspect", "--pretty", name)
+	case "configs":
+		return utils.RunCommandWithOutput("docker", "config", "inspect", "--pretty", name)
+	case "networks":
+		return utils.RunCommandWithOutput("docker", "network", "inspect", name)
+	case "volumes":
+		return utils.RunCommandWithOutput("docker", "volume", "inspect", name)
 	default:
 		return "", fmt.Errorf("unsupported Swarm resource type for describe: %s", resourceType)
 	}
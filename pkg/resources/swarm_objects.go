@@ -0,0 +1,272 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package resources
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	stackLabel      = "com.structure-projects.somcli.stack"
+	keyLabel        = "com.structure-projects.somcli.key"
+	versionKeyLabel = "com.structure-projects.somcli.version-key" // 标记保存 stack 版本密钥的 config
+)
+
+// prepareStackObjects 创建或轮换 stack 文件中声明的 secret/config
+//
+// swarm 中 secret/config 的内容不可修改，因此按内容的 HMAC 生成带版本的名称，
+// 内容变化时创建新版本，并将声明改写为 external 引用，由 stack deploy 滚动更新服务。
+func prepareStackObjects(stack, baseDir string, data []byte) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	changed := false
+	for i, section := range doc {
+		var kind string
+		switch section.Key {
+		case "secrets":
+			kind = "secret"
+		case "configs":
+			kind = "config"
+		default:
+			continue
+		}
+
+		defs, ok := section.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+
+		for j, def := range defs {
+			key := fmt.Sprint(def.Key)
+			spec, ok := def.Value.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+
+			content, ok, err := readStackObjectContent(baseDir, spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", kind, key, err)
+			}
+			if !ok {
+				continue
+			}
+
+			name, err := ensureStackObject(kind, stack, key, content)
+			if err != nil {
+				return nil, err
+			}
+
+			defs[j].Value = yaml.MapSlice{
+				{Key: "name", Value: name},
+				{Key: "external", Value: true},
+			}
+			changed = true
+		}
+		doc[i].Value = defs
+	}
+
+	if !changed {
+		return data, nil
+	}
+	return yaml.Marshal(doc)
+}
+
+// readStackObjectContent 读取 secret/config 声明的内容，external 声明返回 false
+func readStackObjectContent(baseDir string, spec yaml.MapSlice) (string, bool, error) {
+	var file, env string
+	for _, item := range spec {
+		switch item.Key {
+		case "external":
+			if external, _ := item.Value.(bool); external {
+				return "", false, nil
+			}
+		case "file":
+			file = fmt.Sprint(item.Value)
+		case "environment":
+			env = fmt.Sprint(item.Value)
+		}
+	}
+
+	switch {
+	case file != "":
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(baseDir, file)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read file: %w", err)
+		}
+		return string(content), true, nil
+	case env != "":
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return "", false, fmt.Errorf("environment variable %s is not set", env)
+		}
+		return value, true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// stackKeyFile 旧版本保存 stack 版本密钥的本地文件，迁移到 swarm 后不再写入
+func stackKeyFile(stack string) string {
+	return filepath.Join(utils.GetDataDir(), "stacks", stack+".key")
+}
+
+// stackKeyConfig 在 swarm 中保存 stack 版本密钥的 config 名称，不以 <stack>_ 开头，不会被清理
+func stackKeyConfig(stack string) string {
+	return "somcli_stack_key_" + stack
+}
+
+// stackVersionKey 读取 stack 的版本密钥，不存在时生成并保存到 swarm config 中
+//
+// 版本名称使用该密钥计算内容的 HMAC，能够 docker secret ls 的用户无法据此验证猜测的密钥内容。
+// 密钥保存在 swarm 中，从任意机器或新的工作目录部署同一 stack 时版本名称保持不变；
+// 本地已有旧版本的密钥文件时沿用该密钥，避免升级后所有服务重启。
+func stackVersionKey(stack string) ([]byte, error) {
+	name := stackKeyConfig(stack)
+	if output, err := utils.RunCommandWithSecretOutput("docker", "config", "inspect", "--format", "{{json .Spec.Data}}", name); err == nil {
+		var data []byte
+		if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &data); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", name, err)
+		}
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+
+	var key []byte
+	if data, err := os.ReadFile(stackKeyFile(stack)); err == nil {
+		if key, err = hex.DecodeString(strings.TrimSpace(string(data))); err != nil {
+			return nil, fmt.Errorf("invalid key file %s: %w", stackKeyFile(stack), err)
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	if _, err := utils.RunCommandWithStdin(hex.EncodeToString(key)+"\n", "docker", "config", "create",
+		"--label", versionKeyLabel+"="+stack, name, "-"); err != nil {
+		return nil, fmt.Errorf("failed to save version key as config %s: %w", name, err)
+	}
+	return key, nil
+}
+
+// ensureStackObject 确保指定内容版本的 secret/config 存在，返回其名称
+func ensureStackObject(kind, stack, key, content string) (string, error) {
+	versionKey, err := stackVersionKey(stack)
+	if err != nil {
+		return "", fmt.Errorf("failed to load version key of stack %s: %w", stack, err)
+	}
+	mac := hmac.New(sha256.New, versionKey)
+	mac.Write([]byte(kind + "/" + key + "\x00" + content))
+	name := fmt.Sprintf("%s_%s_%s", stack, key, hex.EncodeToString(mac.Sum(nil))[:12])
+
+	if _, err := utils.RunCommandWithOutput("docker", kind, "inspect", name); err == nil {
+		utils.PrintDebug("%s %s is up to date", kind, name)
+		return name, nil
+	}
+
+	utils.PrintInfo("Creating %s %s", kind, name)
+	_, err = utils.RunCommandWithStdin(content, "docker", kind, "create",
+		"--label", stackLabel+"="+stack,
+		"--label", keyLabel+"="+key,
+		name, "-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s %s: %w", kind, name, err)
+	}
+	return name, nil
+}
+
+// pruneStackObjects 清理 stack 中不再被引用的旧版本 secret/config（仍被使用的会被 docker 拒绝删除）
+func pruneStackObjects(stack, composeFile string) {
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		return
+	}
+	referenced, err := referencedStackObjects(content)
+	if err != nil {
+		utils.PrintDebug("skip pruning stack %s: %v", stack, err)
+		return
+	}
+
+	for _, kind := range []string{"secret", "config"} {
+		output, err := utils.RunCommandWithOutput("docker", kind, "ls",
+			"--filter", "label="+stackLabel+"="+stack, "--format", "{{.Name}}")
+		if err != nil {
+			continue
+		}
+		for _, name := range staleStackObjects(stack, strings.Fields(output), referenced[kind]) {
+			if _, err := utils.RunCommandWithOutput("docker", kind, "rm", name); err != nil {
+				utils.PrintDebug("keep %s %s: %v", kind, name, err)
+			} else {
+				utils.PrintInfo("Removed unused %s %s", kind, name)
+			}
+		}
+	}
+}
+
+// referencedStackObjects 返回 stack 文件中 secrets/configs 声明引用的名称，按 secret/config 分组
+func referencedStackObjects(data []byte) (map[string]map[string]bool, error) {
+	var doc struct {
+		Secrets map[string]struct {
+			Name string `yaml:"name"`
+		} `yaml:"secrets"`
+		Configs map[string]struct {
+			Name string `yaml:"name"`
+		} `yaml:"configs"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	referenced := map[string]map[string]bool{"secret": {}, "config": {}}
+	for _, def := range doc.Secrets {
+		referenced["secret"][def.Name] = true
+	}
+	for _, def := range doc.Configs {
+		referenced["config"][def.Name] = true
+	}
+	return referenced, nil
+}
+
+// staleStackObjects 返回属于 stack（名称以 <stack>_ 开头）且未被引用的对象
+func staleStackObjects(stack string, names []string, referenced map[string]bool) []string {
+	var stale []string
+	for _, name := range names {
+		if strings.HasPrefix(name, stack+"_") && !referenced[name] {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
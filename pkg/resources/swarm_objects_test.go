@@ -0,0 +1,81 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package resources
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStaleStackObjects(t *testing.T) {
+	data := []byte(`
+services:
+  web:
+    image: nginx
+secrets:
+  db_password:
+    name: app_db_password_0123456789ab
+    external: true
+configs:
+  nginx_conf:
+    name: app_nginx_conf_ba9876543210
+    external: true
+`)
+	referenced, err := referencedStackObjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		kind  string
+		names []string
+		want  []string
+	}{
+		{
+			name:  "old version",
+			kind:  "secret",
+			names: []string{"app_db_password_0123456789ab", "app_db_password_ffffffffffff"},
+			want:  []string{"app_db_password_ffffffffffff"},
+		},
+		{
+			name:  "other stack with the same prefix",
+			kind:  "secret",
+			names: []string{"app2_db_password_ffffffffffff", "somcli_stack_key_app"},
+			want:  nil,
+		},
+		{
+			name:  "referenced name inside another name",
+			kind:  "config",
+			names: []string{"app_nginx_conf_ba9876543210", "app_nginx_conf_ba98765432"},
+			want:  []string{"app_nginx_conf_ba98765432"},
+		},
+		{
+			name:  "secret name referenced only as config",
+			kind:  "secret",
+			names: []string{"app_nginx_conf_ba9876543210"},
+			want:  []string{"app_nginx_conf_ba9876543210"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := staleStackObjects("app", tt.names, referenced[tt.kind]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("staleStackObjects() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
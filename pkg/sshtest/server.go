@@ -0,0 +1,516 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sshtest 提供进程内 SSH 服务端，用于在单台 Linux 机器上端到端测试远程执行层
+//
+// 服务端在沙箱目录中以 sh -c 执行命令并提供 SFTP 子系统，支持密码和公钥认证。
+// 用法类似 net/http/httptest：
+//
+//	srv, err := sshtest.NewServer(sshtest.Options{Password: "secret"})
+//	if err != nil { ... }
+//	defer srv.Close()
+//	node := srv.Node()
+//	out, err := utils.RunCommandOnNode(&node, "echo hello")
+package sshtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/sftp"
+	"github.com/structure-projects/somcli/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultUser 未指定用户时服务端接受的登录用户
+const DefaultUser = "somcli"
+
+// DefaultListenAddr 默认监听地址
+//
+// 使用 127.0.0.2 而不是 127.0.0.1，避免节点被识别为本机而跳过 SSH。
+const DefaultListenAddr = "127.0.0.2:0"
+
+// Options 服务端配置
+type Options struct {
+	// User 接受的登录用户，默认 DefaultUser
+	User string
+	// Password 设置后接受该密码登录
+	Password string
+	// DisableKeyAuth 为 true 时不生成客户端密钥，只能使用密码登录
+	DisableKeyAuth bool
+	// Dir 命令执行和 SFTP 相对路径的工作目录，为空时创建临时目录并在 Close 时删除
+	Dir string
+	// ListenAddr 监听地址，默认 DefaultListenAddr
+	ListenAddr string
+	// Handler 设置后由其处理 exec 请求而不是执行 shell 命令，返回退出码
+	Handler func(command string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+// Server 进程内 SSH 服务端
+type Server struct {
+	// Addr 监听地址 host:port
+	Addr string
+	// Dir 沙箱目录
+	Dir string
+	// User 登录用户
+	User string
+	// Password 登录密码，未启用密码认证时为空
+	Password string
+	// KeyFile 客户端私钥路径，未启用公钥认证时为空
+	KeyFile string
+	// HostKey 服务端主机公钥
+	HostKey ssh.PublicKey
+
+	opts     Options
+	config   *ssh.ServerConfig
+	listener net.Listener
+	tmpDir   string
+
+	mu       sync.Mutex
+	conns    map[*ssh.ServerConn]struct{}
+	commands []string
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer 启动 SSH 服务端
+func NewServer(opts Options) (*Server, error) {
+	if opts.User == "" {
+		opts.User = DefaultUser
+	}
+	if opts.ListenAddr == "" {
+		opts.ListenAddr = DefaultListenAddr
+	}
+	if opts.Password == "" && opts.DisableKeyAuth {
+		return nil, errors.New("sshtest: at least one of password or key authentication must be enabled")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "sshtest-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		User:     opts.User,
+		Password: opts.Password,
+		Dir:      opts.Dir,
+		opts:     opts,
+		tmpDir:   tmpDir,
+		conns:    make(map[*ssh.ServerConn]struct{}),
+	}
+	if s.Dir == "" {
+		s.Dir = filepath.Join(tmpDir, "sandbox")
+		if err := os.Mkdir(s.Dir, 0755); err != nil {
+			os.RemoveAll(tmpDir)
+			return nil, err
+		}
+	}
+
+	if err := s.setup(); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	s.listener, err = net.Listen("tcp", opts.ListenAddr)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("sshtest: listen %s: %w", opts.ListenAddr, err)
+	}
+	s.Addr = s.listener.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// setup 生成主机密钥和客户端密钥并创建服务端配置
+func (s *Server) setup() error {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		return err
+	}
+	s.HostKey = hostSigner.PublicKey()
+
+	s.config = &ssh.ServerConfig{}
+	s.config.AddHostKey(hostSigner)
+
+	if s.opts.Password != "" {
+		s.config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == s.User && string(password) == s.opts.Password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		}
+	}
+
+	if !s.opts.DisableKeyAuth {
+		clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		block, err := ssh.MarshalPrivateKey(clientPriv, "")
+		if err != nil {
+			return err
+		}
+		s.KeyFile = filepath.Join(s.tmpDir, "id_ed25519")
+		if err := os.WriteFile(s.KeyFile, pem.EncodeToMemory(block), 0600); err != nil {
+			return err
+		}
+		authorized, err := ssh.NewPublicKey(clientPub)
+		if err != nil {
+			return err
+		}
+		s.config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == s.User && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("public key rejected for %s", conn.User())
+		}
+	}
+	return nil
+}
+
+// Host 监听的主机地址
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port 监听端口
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Node 返回连接该服务端的节点配置，优先使用公钥认证
+func (s *Server) Node() types.RemoteNode {
+	return types.RemoteNode{
+		Host:     "sshtest-" + strconv.Itoa(s.Port()),
+		IP:       s.Host(),
+		Port:     s.Port(),
+		User:     s.User,
+		SSHKey:   s.KeyFile,
+		Password: s.Password,
+	}
+}
+
+// KnownHostsFile 写入包含服务端主机密钥的 known_hosts 文件并返回路径
+func (s *Server) KnownHostsFile() (string, error) {
+	path := filepath.Join(s.tmpDir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.Addr)}, s.HostKey)
+	if err := os.WriteFile(path, []byte(line+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Path 返回沙箱目录内的绝对路径
+func (s *Server) Path(elem ...string) string {
+	return filepath.Join(append([]string{s.Dir}, elem...)...)
+}
+
+// Commands 返回服务端收到的 exec 命令
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// CloseConnections 断开所有客户端连接但继续监听，用于测试重连
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	conns := make([]*ssh.ServerConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Close 停止服务端并清理临时文件
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.CloseConnections()
+	s.wg.Wait()
+	os.RemoveAll(s.tmpDir)
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConn(netConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	go ssh.DiscardRequests(reqs)
+
+	var sessions sync.WaitGroup
+	for newChan := range chans {
+		newChan := newChan
+		switch newChan.ChannelType() {
+		case "session":
+			channel, requests, err := newChan.Accept()
+			if err != nil {
+				continue
+			}
+			sessions.Add(1)
+			go func() {
+				defer sessions.Done()
+				s.handleSession(channel, requests)
+			}()
+		case "direct-tcpip":
+			// 作为跳板机时转发 TCP 连接
+			sessions.Add(1)
+			go func() {
+				defer sessions.Done()
+				s.handleDirectTCPIP(newChan)
+			}()
+		default:
+			newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+	sessions.Wait()
+}
+
+// handleSession 处理会话上的 env、exec 和 subsystem 请求
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	var env []string
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &kv); err == nil {
+				env = append(env, kv.Name+"="+kv.Value)
+			}
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			s.recordCommand(payload.Command)
+			code := s.exec(channel, requests, payload.Command, env)
+			sendExitStatus(channel, code)
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.Dir))
+			if err != nil {
+				return
+			}
+			server.Serve()
+			server.Close()
+			return
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) recordCommand(command string) {
+	s.mu.Lock()
+	s.commands = append(s.commands, command)
+	s.mu.Unlock()
+}
+
+// exec 执行命令并返回退出码，客户端关闭会话时终止进程
+func (s *Server) exec(channel ssh.Channel, requests <-chan *ssh.Request, command string, env []string) int {
+	if s.opts.Handler != nil {
+		go ssh.DiscardRequests(requests)
+		return s.opts.Handler(command, channel, channel, channel.Stderr())
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = s.Dir
+	cmd.Env = append([]string{"HOME=" + s.Dir, "USER=" + s.User, "PATH=" + os.Getenv("PATH")}, env...)
+	cmd.Stdout = channel
+	cmd.Stderr = channel.Stderr()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		fmt.Fprintf(channel.Stderr(), "sshtest: %v\n", err)
+		return 255
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(channel.Stderr(), "sshtest: %v\n", err)
+		return 127
+	}
+	go func() {
+		io.Copy(stdin, channel)
+		stdin.Close()
+	}()
+
+	// 会话请求通道关闭说明客户端已断开，结束整个进程组
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case req, ok := <-requests:
+				if !ok {
+					syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+					return
+				}
+				if req.Type == "signal" {
+					syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+				}
+				if req.WantReply {
+					req.Reply(false, nil)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	default:
+		return 255
+	}
+}
+
+// handleDirectTCPIP 转发 direct-tcpip 通道，便于测试跳板机
+func (s *Server) handleDirectTCPIP(newChan ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, "invalid payload")
+		return
+	}
+
+	target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChan.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(target, channel)
+		target.(*net.TCPConn).CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(channel, target)
+		channel.CloseWrite()
+	}()
+	wg.Wait()
+	channel.Close()
+	target.Close()
+}
+
+// sendExitStatus 发送 exit-status 请求
+func sendExitStatus(channel ssh.Channel, code int) {
+	status := make([]byte, 4)
+	binary.BigEndian.PutUint32(status, uint32(code))
+	channel.SendRequest("exit-status", false, status)
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sshtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newServer 启动服务端，测试结束时关闭
+func newServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	srv, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// dial 使用 known_hosts 校验主机密钥并以指定认证方式连接服务端
+func dial(t *testing.T, srv *Server, auth ...ssh.AuthMethod) (*ssh.Client, error) {
+	t.Helper()
+	knownHosts, err := srv.KnownHostsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ssh.Dial("tcp", srv.Addr, &ssh.ClientConfig{User: srv.User, Auth: auth, HostKeyCallback: callback})
+}
+
+// keyAuth 使用服务端生成的客户端私钥
+func keyAuth(t *testing.T, srv *Server) ssh.AuthMethod {
+	t.Helper()
+	data, err := os.ReadFile(srv.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ssh.PublicKeys(signer)
+}
+
+// run 在新会话中执行命令，返回标准输出
+func run(t *testing.T, client *ssh.Client, command string) (string, error) {
+	t.Helper()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	out, err := session.Output(command)
+	return string(out), err
+}
+
+func TestNewServerRequiresAuth(t *testing.T) {
+	if _, err := NewServer(Options{DisableKeyAuth: true}); err == nil {
+		t.Fatal("NewServer() should fail without any authentication method")
+	}
+}
+
+func TestServerNode(t *testing.T) {
+	srv := newServer(t, Options{Password: "secret"})
+
+	node := srv.Node()
+	want := fmt.Sprintf("sshtest-%d", srv.Port())
+	if node.Host != want || node.IP != "127.0.0.2" || node.Port != srv.Port() || node.User != DefaultUser {
+		t.Errorf("Node() = %+v", node)
+	}
+	if node.SSHKey == "" || node.SSHKey != srv.KeyFile || node.Password != "secret" {
+		t.Errorf("Node() credentials = %q/%q, want key %q and password", node.SSHKey, node.Password, srv.KeyFile)
+	}
+	if got := srv.Path("a", "b"); got != srv.Dir+"/a/b" {
+		t.Errorf("Path() = %q", got)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		auth    func(t *testing.T, srv *Server) ssh.AuthMethod
+		wantErr bool
+	}{
+		{
+			name: "key",
+			opts: Options{},
+			auth: keyAuth,
+		},
+		{
+			name: "password",
+			opts: Options{Password: "secret", DisableKeyAuth: true},
+			auth: func(*testing.T, *Server) ssh.AuthMethod { return ssh.Password("secret") },
+		},
+		{
+			name:    "wrong password",
+			opts:    Options{Password: "secret"},
+			auth:    func(*testing.T, *Server) ssh.AuthMethod { return ssh.Password("wrong") },
+			wantErr: true,
+		},
+		{
+			name:    "password not enabled",
+			opts:    Options{},
+			auth:    func(*testing.T, *Server) ssh.AuthMethod { return ssh.Password("") },
+			wantErr: true,
+		},
+		{
+			name: "custom user",
+			opts: Options{User: "deploy", Password: "secret"},
+			auth: func(*testing.T, *Server) ssh.AuthMethod { return ssh.Password("secret") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t, tt.opts)
+			if tt.opts.DisableKeyAuth && srv.KeyFile != "" {
+				t.Errorf("KeyFile = %q, want empty when key auth is disabled", srv.KeyFile)
+			}
+			client, err := dial(t, srv, tt.auth(t, srv))
+			if tt.wantErr {
+				if err == nil {
+					client.Close()
+					t.Fatal("dial should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dial error = %v", err)
+			}
+			defer client.Close()
+			if out, err := run(t, client, "echo $USER"); err != nil || out != srv.User+"\n" {
+				t.Errorf("output = %q, %v", out, err)
+			}
+		})
+	}
+}
+
+func TestServerExec(t *testing.T) {
+	srv := newServer(t, Options{})
+	client, err := dial(t, srv, keyAuth(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if out, err := run(t, client, "pwd"); err != nil || out != srv.Dir+"\n" {
+		t.Errorf("pwd = %q, %v, want sandbox dir %q", out, err, srv.Dir)
+	}
+
+	_, err = run(t, client, "echo failed >&2; exit 3")
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Errorf("exit error = %v, want exit status 3", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Stdin = strings.NewReader("from stdin")
+	out, err := session.Output("cat")
+	session.Close()
+	if err != nil || string(out) != "from stdin" {
+		t.Errorf("cat = %q, %v", out, err)
+	}
+
+	want := []string{"pwd", "echo failed >&2; exit 3", "cat"}
+	if got := srv.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands() = %q, want %q", got, want)
+	}
+}
+
+func TestServerHandler(t *testing.T) {
+	srv := newServer(t, Options{
+		Handler: func(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+			fmt.Fprintf(stdout, "handled %s\n", command)
+			return 7
+		},
+	})
+	client, err := dial(t, srv, keyAuth(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := run(t, client, "anything")
+	var exitErr *ssh.ExitError
+	if out != "handled anything\n" || !errors.As(err, &exitErr) || exitErr.ExitStatus() != 7 {
+		t.Errorf("output = %q, error = %v, want handler output and exit status 7", out, err)
+	}
+}
+
+func TestServerSFTP(t *testing.T) {
+	srv := newServer(t, Options{})
+	client, err := dial(t, srv, keyAuth(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sftpClient.Close()
+
+	// 相对路径以沙箱目录为准
+	f, err := sftpClient.Create("upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("uploaded\n")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if data, err := os.ReadFile(srv.Path("upload.txt")); err != nil || string(data) != "uploaded\n" {
+		t.Errorf("uploaded file = %q, %v", data, err)
+	}
+}
+
+func TestServerCloseConnections(t *testing.T) {
+	srv := newServer(t, Options{})
+	client, err := dial(t, srv, keyAuth(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.CloseConnections()
+	client.Wait()
+	if _, err := client.NewSession(); err == nil {
+		t.Error("NewSession() should fail after CloseConnections")
+	}
+	client.Close()
+
+	// 服务端仍在监听，可以重新连接
+	client, err = dial(t, srv, keyAuth(t, srv))
+	if err != nil {
+		t.Fatalf("reconnect error = %v", err)
+	}
+	client.Close()
+}
@@ -21,6 +21,7 @@ type ClusterConfig struct {
 		Type        string       `yaml:"type"`
 		Name        string       `yaml:"name"`
 		Nodes       []RemoteNode `yaml:"nodes"`
+		SSH         SSHDefaults  `yaml:"ssh,omitempty"` // 节点 SSH 连接默认值
 		K8sConfig   K8sConfig    `yaml:"k8sConfig,omitempty"`
 		SwarmConfig SwarmConfig  `yaml:"swarmConfig,omitempty"`
 	} `yaml:"cluster"`
@@ -40,9 +41,12 @@ type K8sConfig struct {
 }
 
 type SwarmConfig struct {
-	AdvertiseAddr   string   `yaml:"advertiseAddr"`
-	ListenAddr      string   `yaml:"listenAddr"`
-	DefaultAddrPool []string `yaml:"defaultAddrPool"`
-	SubnetSize      int      `yaml:"subnetSize"`
-	DataPathPort    int      `yaml:"dataPathPort"`
+	AdvertiseAddr    string   `yaml:"advertiseAddr"`
+	ListenAddr       string   `yaml:"listenAddr"`
+	DefaultAddrPool  []string `yaml:"defaultAddrPool"`  // overlay 网络地址池，避免与内网网段冲突
+	SubnetSize       int      `yaml:"subnetSize"`       // 地址池中每个子网的掩码长度
+	DataPathPort     int      `yaml:"dataPathPort"`     // VXLAN 数据通道端口，默认 4789
+	Autolock         bool     `yaml:"autolock"`         // 启用管理节点自动锁定
+	CertExpiry       string   `yaml:"certExpiry"`       // 节点证书有效期，如 "2160h"
+	TaskHistoryLimit *int     `yaml:"taskHistoryLimit"` // 任务历史保留数量，未设置时使用 Docker 默认值，0 表示不保留
 }
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package types
+
+// 多文档配置中的文档类型，kind 不区分大小写
+const (
+	KindDownload = "Download" // 需要下载的资源
+	KindResource = "Resource" // 需要安装的资源
+	KindApp      = "App"      // 应用安装流程
+	KindNode     = "Node"     // 节点清单
+	KindSource   = "Source"   // 软件源
+)
+
+// Manifest 多文档配置文件合并后的结果
+type Manifest struct {
+	Version   string            // 文档声明的版本
+	Proxy     string            // 可选代理
+	Downloads []Resource        // kind: Download
+	Resources []Resource        // kind: Resource 以及无 kind 的旧格式文件
+	Apps      []App             // kind: App
+	Nodes     []RemoteNode      // kind: Node 以及旧格式中的 nodes
+	SSH       SSHDefaults       // 节点 SSH 连接默认值
+	Sources   []Source          // kind: Source
+	Vars      map[string]string // 配置级模板变量
+}
+
+// App 应用定义，由若干安装流程组成
+type App struct {
+	Name    string    `yaml:"name"`
+	Runtime string    `yaml:"runtime"` // 运行方式 host、container
+	Hosts   []AppHost `yaml:"hosts"`   // 为节点补充应用内的角色
+	Flows   []Flow    `yaml:"flows"`
+}
+
+// AppHost 应用内的节点角色
+type AppHost struct {
+	Host  string   `yaml:"host"`
+	IP    string   `yaml:"ip"`
+	Roles []string `yaml:"roles"`
+}
+
+// Flow 安装流程中的一步，在选中的节点上安装一个资源
+type Flow struct {
+	Name      string      `yaml:"name"`
+	Resource  string      `yaml:"resource"`
+	Nodes     string      `yaml:"nodes"`      // 节点选择，写法与资源 hosts 相同，为空时使用资源的 hosts
+	DependsOn *StringList `yaml:"depends_on"` // 依赖的流程或资源名称，未设置时依赖上一个流程，[] 表示无依赖
+}
+
+// Source 软件源定义
+type Source struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Type   string   `yaml:"type"` // install 或 download
+	Script []string `yaml:"script"`
+}
+
+// StringList 既可以写成单个字符串也可以写成列表的字段
+type StringList []string
+
+// UnmarshalYAML 支持 "a" 和 ["a", "b"] 两种写法
+func (s *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		if single == "" {
+			*s = nil
+		} else {
+			*s = StringList{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
@@ -21,10 +21,50 @@ type HostsConfig struct {
 }
 
 type RemoteNode struct {
-	Host    string `yaml:"host"`
-	IP      string `yaml:"ip"`
-	Role    string `yaml:"role"` // todo 抽取出来 master,harbor,work
-	User    string `yaml:"user"`
-	SSHKey  string `yaml:"sshKey"`
-	IsLocal bool
+	Host                string            `yaml:"host"`
+	IP                  string            `yaml:"ip"`
+	Role                string            `yaml:"role"`   // todo 抽取出来 master,harbor,work
+	Roles               []string          `yaml:"roles"`  // 节点角色，kind: Node 中使用
+	Labels              map[string]string `yaml:"labels"` // 节点标签，用于 hosts 中的 label:<键>=<值> 选择
+	User                string            `yaml:"user"`
+	Port                int               `yaml:"port"`                // SSH 端口，默认 22
+	SSHKey              string            `yaml:"sshKey"`              // 私钥路径
+	SSHKeyPassphrase    string            `yaml:"sshKeyPassphrase"`    // 私钥密码
+	SSHKeyPassphraseRef string            `yaml:"sshKeyPassphraseRef"` // 私钥密码引用 env:NAME 或 file:/path
+	Password            string            `yaml:"password"`            // 登录密码
+	PasswordRef         string            `yaml:"passwordRef"`         // 登录密码引用 env:NAME 或 file:/path
+	Agent               *bool             `yaml:"agent"`               // 使用 ssh-agent 认证，未设置时使用默认值
+	ProxyJump           string            `yaml:"proxyJump"`           // 跳板机 [user@]host[:port]，多个用逗号分隔
+	Become              *bool             `yaml:"become"`              // 以 root 身份执行命令，未设置时使用默认值
+	BecomeMethod        string            `yaml:"becomeMethod"`        // 提权方式 sudo（默认）或 doas
+	BecomePassword      string            `yaml:"becomePassword"`      // 提权密码，未设置时使用登录密码
+	BecomePasswordRef   string            `yaml:"becomePasswordRef"`   // 提权密码引用 env:NAME 或 file:/path
+	IsLocal             bool
+}
+
+// UseAgent 是否使用 ssh-agent 认证
+func (n *RemoteNode) UseAgent() bool {
+	return n.Agent != nil && *n.Agent
+}
+
+// UseBecome 是否以 root 身份执行命令
+func (n *RemoteNode) UseBecome() bool {
+	return n.Become != nil && *n.Become
+}
+
+// SSHDefaults 节点 SSH 连接默认值，节点未设置的字段使用此处的值
+type SSHDefaults struct {
+	User                string `yaml:"user"`
+	Port                int    `yaml:"port"`
+	SSHKey              string `yaml:"sshKey"`
+	SSHKeyPassphrase    string `yaml:"sshKeyPassphrase"`
+	SSHKeyPassphraseRef string `yaml:"sshKeyPassphraseRef"`
+	Password            string `yaml:"password"`
+	PasswordRef         string `yaml:"passwordRef"`
+	Agent               *bool  `yaml:"agent"`
+	ProxyJump           string `yaml:"proxyJump"`
+	Become              *bool  `yaml:"become"`
+	BecomeMethod        string `yaml:"becomeMethod"`
+	BecomePassword      string `yaml:"becomePassword"`
+	BecomePasswordRef   string `yaml:"becomePasswordRef"`
 }
@@ -15,11 +15,15 @@ limitations under the License.
 */
 package types
 
+import "time"
+
 // 资源配置下载配置文件结构
 type ResourceConfig struct {
-	Proxy     string       `yaml:"proxy"` // 可选代理
-	Resources []Resource   `yaml:"resources,omitempty"`
-	Nodes     []RemoteNode `yaml:"nodes"`
+	Proxy     string            `yaml:"proxy"` // 可选代理
+	Resources []Resource        `yaml:"resources,omitempty"`
+	Nodes     []RemoteNode      `yaml:"nodes"`
+	SSH       SSHDefaults       `yaml:"ssh,omitempty"`  // 节点 SSH 连接默认值
+	Vars      map[string]string `yaml:"vars,omitempty"` // 模板变量，资源的 vars 覆盖同名变量
 }
 
 // Resource 单个资源定义
@@ -32,12 +36,81 @@ type Resource struct {
 	Checksum      string            `yaml:"checksum"` // 可选校验和
 	Image         string            `yaml:"image"`
 	Hosts         []string          `yaml:"hosts"`          //安装节点
-	PreInstall    []string          `yaml:"pre_install"`    //检测脚本
-	PostInstall   []string          `yaml:"post_install"`   // 安装脚本
-	RemoveScripts []string          `yaml:"remove_scripts"` //卸载脚本
+	PreInstall    []Script          `yaml:"pre_install"`    //检测脚本，只在 check、when 判断后仍需安装的节点上执行
+	PostInstall   []Script          `yaml:"post_install"`   // 安装脚本
+	RemoveScripts []Script          `yaml:"remove_scripts"` //卸载脚本
 	Method        string            `yaml:"method"`         // 安装方法
-	ExtraFiles    map[string]string `yaml:"ExtraFiles"`     // 扩展文件
+	ExtraFiles    map[string]string `yaml:"ExtraFiles"`     // 扩展文件，目标路径到内容，也可以写成 extra_files
 	Files         []string          `yaml:"files"`          //文件路径
+	Roles         []string          `yaml:"roles"`          // 适用的节点角色
+	Package       string            `yaml:"package"`        // method: package 安装的软件包
+	Packages      []string          `yaml:"packages"`       // method: package 安装的多个软件包
+	BinDir        string            `yaml:"bin_dir"`        // method: binary 安装目录，默认 /usr/local/bin
+	Mode          string            `yaml:"mode"`           // method: binary 文件权限，默认 0755
+	Binaries      []string          `yaml:"binaries"`       // method: binary 只安装这些文件名，为空时安装全部
+	Args          []string          `yaml:"args"`           // method: container 附加的 run 参数
+	Check         string            `yaml:"check"`          // 在节点上执行成功时视为已安装，跳过该节点的全部步骤（包括 pre_install），相当于 unless
+	When          string            `yaml:"when"`           // 在节点上执行成功时才安装，否则跳过该节点
+	Vars          map[string]string `yaml:"vars"`           // 资源级模板变量，覆盖配置级的同名变量
+}
+
+// UnmarshalYAML 同时支持 ExtraFiles 和 extra_files 两种写法，同一路径以 extra_files 为准
+func (r *Resource) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Resource
+	var aux struct {
+		plain      `yaml:",inline"`
+		ExtraFiles map[string]string `yaml:"extra_files"`
+	}
+	if err := unmarshal(&aux); err != nil {
+		return err
+	}
+	*r = Resource(aux.plain)
+	if len(aux.ExtraFiles) > 0 && r.ExtraFiles == nil {
+		r.ExtraFiles = make(map[string]string, len(aux.ExtraFiles))
+	}
+	for path, content := range aux.ExtraFiles {
+		r.ExtraFiles[path] = content
+	}
+	return nil
+}
+
+// Script 安装脚本，可以写成字符串或带执行选项的对象
+//
+//	post_install:
+//	  - "systemctl daemon-reload"
+//	  - run: "systemctl restart containerd"
+//	    retries: 2
+//	    timeout: 1m
+//	    ignoreErrors: true
+//	  - run: "kubeadm init"
+//	    check: "test -f /etc/kubernetes/admin.conf"
+type Script struct {
+	Run          string        `yaml:"run"`
+	IgnoreErrors bool          `yaml:"ignoreErrors"` // 失败时只输出警告并继续执行
+	Retries      int           `yaml:"retries"`      // 失败后的重试次数
+	Timeout      time.Duration `yaml:"timeout"`      // 单次执行超时，为 0 时使用 command_timeout 配置
+	Check        string        `yaml:"check"`        // 执行成功时跳过该脚本，相当于 unless
+	When         string        `yaml:"when"`         // 执行成功时才执行该脚本
+}
+
+// UnmarshalYAML 支持字符串和对象两种写法
+func (s *Script) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var run string
+	if err := unmarshal(&run); err == nil {
+		*s = Script{Run: run}
+		return nil
+	}
+	type plain Script
+	return unmarshal((*plain)(s))
+}
+
+// NewScripts 将命令转换为脚本列表
+func NewScripts(commands ...string) []Script {
+	scripts := make([]Script, len(commands))
+	for i, command := range commands {
+		scripts[i] = Script{Run: command}
+	}
+	return scripts
 }
 
 // DownloadResult 下载结果
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestResourceExtraFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{
+			name: "ExtraFiles",
+			data: "name: demo\nExtraFiles:\n  /etc/a.conf: a\n",
+			want: map[string]string{"/etc/a.conf": "a"},
+		},
+		{
+			name: "extra_files",
+			data: "name: demo\nextra_files:\n  /etc/b.conf: b\n",
+			want: map[string]string{"/etc/b.conf": "b"},
+		},
+		{
+			name: "both merged, extra_files wins",
+			data: "name: demo\nExtraFiles:\n  /etc/a.conf: old\n  /etc/c.conf: c\nextra_files:\n  /etc/a.conf: new\n",
+			want: map[string]string{"/etc/a.conf": "new", "/etc/c.conf": "c"},
+		},
+		{
+			name: "none",
+			data: "name: demo\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Resource
+			if err := yaml.Unmarshal([]byte(tt.data), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Name != "demo" {
+				t.Errorf("Name = %q, other fields should still be decoded", res.Name)
+			}
+			if !reflect.DeepEqual(res.ExtraFiles, tt.want) {
+				t.Errorf("ExtraFiles = %v, want %v", res.ExtraFiles, tt.want)
+			}
+		})
+	}
+}
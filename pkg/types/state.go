@@ -0,0 +1,44 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package types
+
+import "time"
+
+// InstallState 本地记录的各节点已安装资源
+type InstallState struct {
+	Nodes map[string]map[string]ResourceState `json:"nodes"` // 节点 -> 资源名称 -> 安装记录
+}
+
+// ResourceState 节点上一个资源的安装记录，同时写入节点上的标记文件
+type ResourceState struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Method      string            `json:"method,omitempty"`
+	Fingerprint string            `json:"fingerprint"` // 资源定义的摘要，定义变化时需要重新安装
+	InstalledAt time.Time         `json:"installed_at"`
+	RunID       string            `json:"run_id,omitempty"`
+	Files       map[string]string `json:"files,omitempty"` // 节点上安装的文件 -> sha256
+}
+
+// ResourceStatus 资源在节点上的状态
+type ResourceStatus struct {
+	Node      string
+	Resource  string
+	Desired   string // 配置中的版本
+	Installed string // 已安装的版本
+	Status    string
+	Detail    string
+}
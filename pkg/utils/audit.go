@@ -0,0 +1,274 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// 审计事件类型
+const (
+	AuditStart = "start" // 命令开始
+	AuditExec  = "exec"  // 执行的本地或远程命令
+	AuditEnd   = "end"   // 命令结束
+)
+
+// auditOutputLimit 审计日志中保留的命令输出长度
+const auditOutputLimit = 4096
+
+// secretFlagPattern 值需要隐藏的参数名，literal 匹配 create secret/config 的 --from-literal
+var secretFlagPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|passphrase|credential|unlock-key|api-key|access-key|literal)`)
+
+// AuditEvent 审计日志中的一行
+type AuditEvent struct {
+	Time       time.Time         `json:"time"`
+	RunID      string            `json:"run_id"`
+	Type       string            `json:"type"`
+	Command    string            `json:"command,omitempty"`     // start: 子命令；exec: 执行的命令
+	Args       []string          `json:"args,omitempty"`        // start: 位置参数
+	Flags      map[string]string `json:"flags,omitempty"`       // start: 显式设置的参数
+	Node       string            `json:"node,omitempty"`        // exec: 节点，本机为 local
+	ExitCode   int               `json:"exit_code"`             // exec/end
+	DurationMS int64             `json:"duration_ms,omitempty"` // exec/end
+	Output     string            `json:"output,omitempty"`      // exec: 截断后的输出
+	Error      string            `json:"error,omitempty"`
+}
+
+// auditLog 当前进程的审计日志
+type auditLog struct {
+	mu    sync.Mutex
+	runID string
+	file  *os.File
+	start time.Time
+}
+
+var currentAudit *auditLog
+
+// auditLocalNode 本机命令在审计日志中的节点名
+const auditLocalNode = "local"
+
+// AuditDir 审计日志目录
+func AuditDir() string {
+	return filepath.Join(GetLogDir(), "history")
+}
+
+// newRunID 生成按时间排序的运行 ID
+func newRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// StartAudit 开始记录本次运行，返回运行 ID；无法创建日志文件时只输出调试信息
+func StartAudit(command string, args []string, flags map[string]string) string {
+	runID := newRunID()
+	if err := CreateDir(AuditDir()); err != nil {
+		PrintDebug("audit log disabled: %v", err)
+		return ""
+	}
+	f, err := os.OpenFile(filepath.Join(AuditDir(), runID+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		PrintDebug("audit log disabled: %v", err)
+		return ""
+	}
+
+	currentAudit = &auditLog{runID: runID, file: f, start: time.Now()}
+	redactedArgs := make([]string, len(args))
+	for i, arg := range args {
+		redactedArgs[i] = RedactSecrets(arg)
+	}
+	currentAudit.write(AuditEvent{Type: AuditStart, Command: command, Args: redactedArgs, Flags: RedactFlags(flags)})
+	PrintDebug("run id %s", runID)
+	return runID
+}
+
+// FinishAudit 记录运行结束并关闭日志
+func FinishAudit(err error) {
+	a := currentAudit
+	if a == nil {
+		return
+	}
+	event := AuditEvent{Type: AuditEnd, DurationMS: time.Since(a.start).Milliseconds()}
+	if err != nil {
+		event.ExitCode = 1
+		event.Error = RedactSecrets(err.Error())
+	}
+	a.write(event)
+
+	a.mu.Lock()
+	a.file.Close()
+	a.file = nil
+	a.mu.Unlock()
+}
+
+// CurrentRunID 当前运行 ID，未开启审计时为空
+func CurrentRunID() string {
+	if currentAudit == nil {
+		return ""
+	}
+	return currentAudit.runID
+}
+
+// RedactFlags 隐藏敏感参数的值
+func RedactFlags(flags map[string]string) map[string]string {
+	redacted := make(map[string]string, len(flags))
+	for name, value := range flags {
+		if secretFlagPattern.MatchString(name) && value != "" && !strings.HasPrefix(value, "env:") && !strings.HasPrefix(value, "file:") {
+			value = "<redacted>"
+		}
+		redacted[name] = RedactSecrets(value)
+	}
+	return redacted
+}
+
+// auditExec 记录一条执行的命令
+func auditExec(node, command, output string, exitCode int, duration time.Duration, err error) {
+	a := currentAudit
+	if a == nil {
+		return
+	}
+	if len(output) > auditOutputLimit {
+		output = output[:auditOutputLimit] + "\n...(truncated)"
+	}
+	event := AuditEvent{
+		Type:       AuditExec,
+		Node:       node,
+		Command:    RedactSecrets(command),
+		ExitCode:   exitCode,
+		DurationMS: duration.Milliseconds(),
+		Output:     RedactSecrets(output),
+	}
+	if err != nil {
+		event.Error = RedactSecrets(err.Error())
+	}
+	a.write(event)
+}
+
+// auditNodeName 审计日志中的节点名
+func auditNodeName(node *types.RemoteNode) string {
+	if IsLocalNode(node) {
+		return auditLocalNode
+	}
+	if node.Host != "" {
+		return node.Host
+	}
+	return node.IP
+}
+
+// write 追加一行事件，每行单独写入，进程被 os.Exit 终止时已写入的内容不会丢失
+func (a *auditLog) write(event AuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.RunID = a.runID
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	a.file.Write(append(data, '\n'))
+}
+
+// AuditRun 一次运行的审计记录
+type AuditRun struct {
+	RunID  string
+	Start  AuditEvent
+	Execs  []AuditEvent
+	End    *AuditEvent // 进程异常退出时为空
+	Failed int         // 失败的命令数
+}
+
+// Status 运行状态：ok、failed 或 aborted（未记录结束事件）
+func (r *AuditRun) Status() string {
+	switch {
+	case r.End == nil:
+		return "aborted"
+	case r.End.ExitCode != 0:
+		return "failed"
+	default:
+		return "ok"
+	}
+}
+
+// ReadAuditRun 读取指定运行的审计记录
+func ReadAuditRun(runID string) (*AuditRun, error) {
+	f, err := os.Open(filepath.Join(AuditDir(), filepath.Base(runID)+".jsonl"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %s not found in %s", runID, AuditDir())
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	run := &AuditRun{RunID: runID}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case AuditStart:
+			run.Start = event
+		case AuditExec:
+			run.Execs = append(run.Execs, event)
+			if event.ExitCode != 0 {
+				run.Failed++
+			}
+		case AuditEnd:
+			end := event
+			run.End = &end
+		}
+	}
+	return run, scanner.Err()
+}
+
+// ListAuditRuns 按时间倒序列出运行 ID
+func ListAuditRuns() ([]string, error) {
+	entries, err := os.ReadDir(AuditDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runs []string
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".jsonl") {
+			runs = append(runs, strings.TrimSuffix(name, ".jsonl"))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+	return runs, nil
+}
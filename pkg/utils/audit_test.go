@@ -0,0 +1,47 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactFlags(t *testing.T) {
+	flags := map[string]string{
+		"from-literal":        "s3cret",
+		"from-file":           "./nginx.conf",
+		"password":            "hunter2",
+		"become-password-ref": "env:SUDO_PASSWORD",
+		"ssh-key-passphrase":  "file:/run/secrets/passphrase",
+		"token":               "",
+		"label":               "env=prod",
+		"join-command":        "docker swarm join --token SWMTKN-1-abc 10.0.0.1:2377",
+	}
+	want := map[string]string{
+		"from-literal":        "<redacted>",
+		"from-file":           "./nginx.conf",
+		"password":            "<redacted>",
+		"become-password-ref": "env:SUDO_PASSWORD",
+		"ssh-key-passphrase":  "file:/run/secrets/passphrase",
+		"token":               "",
+		"label":               "env=prod",
+		"join-command":        "docker swarm join --token <redacted> 10.0.0.1:2377",
+	}
+	if got := RedactFlags(flags); !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactFlags() = %v, want %v", got, want)
+	}
+}
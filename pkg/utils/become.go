@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// 提权方式
+const (
+	BecomeSudo = "sudo"
+	BecomeDoas = "doas"
+)
+
+// ShellQuote 使用单引号包裹参数，避免 shell 解析
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// becomePassword 提权密码，未设置时使用登录密码
+func becomePassword(node *types.RemoteNode) (string, error) {
+	password, err := resolveSecret(node.BecomePassword, node.BecomePasswordRef)
+	if err != nil {
+		return "", fmt.Errorf("node %s become password: %w", node.Host, err)
+	}
+	if password == "" {
+		return nodePassword(node)
+	}
+	return password, nil
+}
+
+// wrapBecome 按节点提权配置包装命令，返回包装后的命令和需要写入标准输入的内容
+//
+// sudo 密码通过标准输入传递（sudo -S），不会出现在命令行和日志中；
+// 未配置密码时使用非交互模式，需要免密提权时直接失败而不是挂起。
+func wrapBecome(node *types.RemoteNode, command string) (string, string, error) {
+	if !node.UseBecome() {
+		return command, "", nil
+	}
+
+	password, err := becomePassword(node)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch method := strings.ToLower(node.BecomeMethod); method {
+	case "", BecomeSudo:
+		if password == "" {
+			return "sudo -n -- sh -c " + ShellQuote(command), "", nil
+		}
+		return "sudo -S -p '' -- sh -c " + ShellQuote(command), password + "\n", nil
+	case BecomeDoas:
+		if password != "" {
+			return "", "", fmt.Errorf("becomeMethod doas does not accept a password, configure nopass for user %s", node.User)
+		}
+		return "doas -n sh -c " + ShellQuote(command), "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported becomeMethod %q (expected sudo or doas)", node.BecomeMethod)
+	}
+}
+
+// becomeInstall 以 root 身份将本地文件安装到节点
+//
+// 文件先以登录用户上传到临时路径，再通过提权执行 install 移动到目标路径并保留权限。
+func becomeInstall(node *types.RemoteNode, localPath, remotePath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+
+	tmpPath := path.Join(GetTmpDir(), fmt.Sprintf("somcli-%d-%s", time.Now().UnixNano(), path.Base(remotePath)))
+	if IsLocalNode(node) {
+		err = CopyFile(localPath, tmpPath)
+	} else {
+		err = sftpUpload(node, localPath, tmpPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to temporary path: %w", localPath, err)
+	}
+
+	installCmd := fmt.Sprintf("install -D -m %04o %s %s; rc=$?; rm -f %s; exit $rc",
+		info.Mode().Perm(), ShellQuote(tmpPath), ShellQuote(remotePath), ShellQuote(tmpPath))
+	if _, err := RunCommandOnNode(node, installCmd); err != nil {
+		return fmt.Errorf("failed to install %s: %w", remotePath, err)
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/structure-projects/somcli/pkg/types"
 )
@@ -31,19 +32,49 @@ func RunCommand(name string, args ...string) error {
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err := cmd.Run()
+	auditExec(auditLocalNode, commandLine(name, args), "", exitCode(err), time.Since(start), err)
+	if err != nil {
 		return fmt.Errorf("command failed: %v", err)
 	}
 	return nil
 }
 
 func RunCommandWithOutput(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
-	output, err := cmd.CombinedOutput()
+	return RunCommandWithStdin("", name, args...)
+}
+
+// RunCommandWithStdin 执行命令并通过标准输入传入内容，避免敏感内容出现在命令行参数中
+func RunCommandWithStdin(input string, name string, args ...string) (string, error) {
+	start := time.Now()
+	output, err := runCaptured(input, name, args...)
+	auditExec(auditLocalNode, commandLine(name, args), output, exitCode(err), time.Since(start), err)
 	if err != nil {
-		return "", fmt.Errorf("command failed: %v, output: %s", err, string(output))
+		return "", fmt.Errorf("command failed: %v, output: %s", err, output)
 	}
-	return string(output), nil
+	return output, nil
+}
+
+// RunCommandWithSecretOutput 执行命令并返回输出，用于读取密钥等敏感内容，审计日志中不记录输出
+func RunCommandWithSecretOutput(name string, args ...string) (string, error) {
+	start := time.Now()
+	output, err := runCaptured("", name, args...)
+	auditExec(auditLocalNode, commandLine(name, args), "", exitCode(err), time.Since(start), err)
+	if err != nil {
+		return "", fmt.Errorf("command failed: %v", err)
+	}
+	return output, nil
+}
+
+// runCaptured 执行命令并返回合并的标准输出和标准错误，不记录审计日志
+func runCaptured(input string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+	output, err := cmd.CombinedOutput()
+	return string(output), err
 }
 
 // RunCommandInDir 在指定目录执行命令
@@ -53,7 +84,11 @@ func RunCommandInDir(dir, name string, args ...string) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
-	return cmd.Run()
+
+	start := time.Now()
+	err := cmd.Run()
+	auditExec(auditLocalNode, commandLine(name, args), "", exitCode(err), time.Since(start), err)
+	return err
 }
 
 // RunCommandWithEnv 带环境变量执行本地命令
@@ -68,7 +103,9 @@ func RunCommandWithEnv(env map[string]string, name string, arg ...string) (strin
 		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", k, v))
 	}
 
+	start := time.Now()
 	err := cmd.Run()
+	auditExec(auditLocalNode, commandLine(name, arg), stdout.String()+stderr.String(), exitCode(err), time.Since(start), err)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w\n%s", strings.Join(cmd.Args, " "), err, stderr.String())
 	}
@@ -76,6 +113,11 @@ func RunCommandWithEnv(env map[string]string, name string, arg ...string) (strin
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+// commandLine 审计日志中显示的命令行
+func commandLine(name string, args []string) string {
+	return strings.TrimSpace(name + " " + strings.Join(args, " "))
+}
+
 // CommandExists 检查命令是否存在
 func CommandExists(name string) bool {
 	_, err := exec.LookPath(name)
@@ -84,51 +126,180 @@ func CommandExists(name string) bool {
 }
 
 // RunCommandOnNode 在节点上执行命令（改为接收指针）
+//
+// 节点开启 become 时命令通过 sudo/doas 以 root 身份执行。
 func RunCommandOnNode(node *types.RemoteNode, command string) (string, error) {
-	if node.Host == "localhost" || node.Host == "127.0.0.1" || node.IP == "127.0.0.1" {
-		return RunCommandWithOutput("sh", "-c", command)
+	wrapped, input, err := wrapBecome(node, command)
+	if err != nil {
+		return "", err
 	}
 
-	sshKey := ExpandPath(node.SSHKey)
-	output, err := SSHMCmd(node.User, node.IP, sshKey, command)
+	if IsLocalNode(node) {
+		start := time.Now()
+		output, err := runCaptured(input, "sh", "-c", wrapped)
+		auditExec(auditNodeName(node), command, output, exitCode(err), time.Since(start), err)
+		if err != nil {
+			return "", &CommandError{Host: node.Host, Command: command, Detail: "local", Output: output, Err: err}
+		}
+		return output, nil
+	}
+
+	output, err := sshMCmdWithInput(node, wrapped, input)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute command '%s' on node %s (%s@%s): %w",
-			command, node.Host, node.User, node.IP, err)
+		return "", &CommandError{Host: node.Host, Command: command, Detail: node.User + "@" + node.IP, Err: err}
 	}
 	return strings.TrimSpace(string(output)), nil
 }
 
+// CommandError 节点上的命令执行失败
+//
+// 错误信息中的令牌、密钥已隐藏，原始错误（如 *ssh.ExitError、context.DeadlineExceeded）可通过 errors.As/errors.Is 获取。
+type CommandError struct {
+	Host    string
+	Command string
+	Detail  string // 连接信息、退出码等附加信息
+	Output  string // 需要附加在错误信息中的命令输出
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("failed to execute command '%s' on node %s", RedactSecrets(e.Command), e.Host)
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	msg += ": " + RedactSecrets(e.Err.Error())
+	if e.Output != "" {
+		msg += ", output: " + RedactSecrets(e.Output)
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// CopyToNode 复制本地文件到节点，节点开启 become 时以 root 身份写入目标路径
+func CopyToNode(node *types.RemoteNode, localPath, remotePath string) error {
+	if IsLocalNode(node) {
+		if localPath == remotePath {
+			return nil
+		}
+		if node.UseBecome() {
+			return becomeInstall(node, localPath, remotePath)
+		}
+		return CopyFile(localPath, remotePath)
+	}
+	return CopyToRemote(node, localPath, remotePath)
+}
+
+// CopyFromNode 从节点复制文件到本地
+func CopyFromNode(node *types.RemoteNode, remotePath, localPath string) error {
+	if IsLocalNode(node) {
+		return CopyFile(remotePath, localPath)
+	}
+	return CopyFromRemote(node, remotePath, localPath)
+}
+
+// scriptRetryDelay 脚本重试前的等待时间
+var scriptRetryDelay = 2 * time.Second
+
+// ScriptError 脚本执行失败
+type ScriptError struct {
+	Host     string
+	Script   string
+	ExitCode int // 未能获取退出码（如超时、连接断开）时为 -1
+	Attempts int
+	Err      error
+}
+
+func (e *ScriptError) Error() string {
+	msg := fmt.Sprintf("script %q failed on %s", RedactSecrets(e.Script), e.Host)
+	if e.ExitCode >= 0 {
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	} else if e.Err != nil {
+		msg += ": " + RedactSecrets(e.Err.Error())
+	}
+	if e.Attempts > 1 {
+		msg += fmt.Sprintf(" after %d attempts", e.Attempts)
+	}
+	return msg
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
 // 运行脚本
-func RunScripts(scripts []string, res types.Resource) error {
+func RunScripts(scripts []types.Script, res types.Resource) error {
+	return RunScriptsWith(NewNodeExecutor(), scripts, res)
+}
 
-	for _, script := range scripts {
-		runScript, err := ParseStr(script, res)
+// RunScriptsWith 使用指定执行器运行脚本
+//
+// 脚本依次在资源的每个节点上执行（未指定 hosts 时在本机执行），默认在第一次失败时停止并返回 *ScriptError；
+// 设置 ignoreErrors 的脚本失败时只输出警告；check 成功或 when 失败的节点跳过该脚本。
+func RunScriptsWith(executor Executor, scripts []types.Script, res types.Resource) error {
+	nodes := []*types.RemoteNode{LocalNode()}
+	if len(res.Hosts) > 0 {
+		resolved, err := ResolveHosts(res.Hosts)
 		if err != nil {
-			PrintWarning("scripts parse err -> %v", err)
+			return fmt.Errorf("%s hosts: %w", res.Name, err)
 		}
-		PrintDebug("exec scripts -> %s", runScript)
-		//判断是否在本地执行
-		if len(res.Hosts) > 0 {
-			//远程执行
-			for _, hostname := range res.Hosts {
-
-				node := GetNode(hostname)
-				PrintDebug("remote node %s", node.IP)
-				out, err := RunCommandOnNode(&node, runScript)
-				if err != nil {
-					PrintDebug("err -> %v", err)
-				}
-				PrintInfo("exec remote -> node: %s ,scripts: %s ,scripts out ->\n%s", hostname, runScript, out)
+		nodes = resolved
+	}
+
+	for _, script := range scripts {
+		for _, node := range nodes {
+			runScript, err := ParseNodeStr(executor, node, script.Run, res)
+			if err != nil {
+				return fmt.Errorf("parse script %q for %s failed: %w", script.Run, node.Host, err)
 			}
-		} else {
-			//本地执行
-			out, err := RunCommandWithOutput("sh", "-c", runScript)
+			PrintDebug("exec scripts -> %s", runScript)
+
+			skip, reason, err := SkipStep(executor, node, script.Check, script.When, res)
 			if err != nil {
-				PrintDebug("err -> %v", err)
+				return &ScriptError{Host: node.Host, Script: runScript, ExitCode: -1, Attempts: 1, Err: err}
+			}
+			if skip {
+				PrintInfo("skip -> node: %s ,scripts: %s (%s)", node.Host, RedactSecrets(runScript), reason)
+				continue
+			}
+			PrintInfo("exec -> node: %s ,scripts: %s", node.Host, RedactSecrets(runScript))
+			err = runScriptOnNode(executor, node, runScript, script)
+			if err == nil {
+				continue
+			}
+			if script.IgnoreErrors {
+				PrintWarning("%v (ignored)", err)
+				continue
 			}
-			PrintInfo("exec local scripts -> %s ,scripts out ->    \n%s", runScript, out)
+			return err
 		}
-
 	}
 	return nil
 }
+
+// runScriptOnNode 在节点上执行脚本，失败时按 retries 重试
+func runScriptOnNode(executor Executor, node *types.RemoteNode, command string, script types.Script) error {
+	attempts := script.Retries + 1
+	var scriptErr *ScriptError
+	for attempt := 1; attempt <= attempts; attempt++ {
+		result, err := executor.Stream(RootContext(), node, command, StreamOptions{Timeout: script.Timeout})
+		if err == nil {
+			return nil
+		}
+		scriptErr = &ScriptError{Host: node.Host, Script: command, ExitCode: -1, Attempts: attempt, Err: err}
+		if result != nil {
+			scriptErr.ExitCode = result.ExitCode
+		}
+		if attempt == attempts || RootContext().Err() != nil {
+			break
+		}
+		PrintWarning("%v, retrying (%d/%d)", scriptErr, attempt, script.Retries)
+		select {
+		case <-time.After(scriptRetryDelay):
+		case <-RootContext().Done():
+		}
+	}
+	return scriptErr
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// scriptTestNodes 执行脚本的测试节点，IP 不属于本机
+var scriptTestNodes = []types.RemoteNode{
+	{Host: "script-01", IP: "10.255.2.1", Role: "master"},
+	{Host: "script-02", IP: "10.255.2.2", Role: "worker"},
+}
+
+// scriptCommands 返回执行器在各节点上执行的命令，忽略获取节点信息的命令
+func scriptCommands(fake *FakeExecutor) []string {
+	var commands []string
+	for _, call := range fake.Calls() {
+		if call.Op == CallRun && !strings.HasPrefix(call.Command, "uname -s") {
+			commands = append(commands, call.Host+": "+call.Command)
+		}
+	}
+	return commands
+}
+
+func TestRunScriptsWithConditions(t *testing.T) {
+	previous := Config.Nodes
+	Config.Nodes = scriptTestNodes
+	t.Cleanup(func() { Config.Nodes = previous })
+	exitErr := errors.New("exit status 1")
+
+	tests := []struct {
+		name   string
+		script types.Script
+		fake   *FakeExecutor
+		want   []string
+	}{
+		{
+			name:   "no condition",
+			script: types.Script{Run: "echo {{ .Host }}"},
+			fake:   NewFakeExecutor(),
+			want:   []string{"script-01: echo script-01", "script-02: echo script-02"},
+		},
+		{
+			name:   "check passed skips node",
+			script: types.Script{Run: "kubeadm init", Check: "test -f /etc/{{ .Host }}.done"},
+			fake:   NewFakeExecutor().On("test -f /etc/script-02.done", "", exitErr),
+			want: []string{
+				"script-01: test -f /etc/script-01.done",
+				"script-02: test -f /etc/script-02.done",
+				"script-02: kubeadm init",
+			},
+		},
+		{
+			name:   "when failed skips node",
+			script: types.Script{Run: "systemctl restart firewalld", When: "systemctl is-active -q firewalld"},
+			fake:   NewFakeExecutor().OnNode("script-01", "systemctl is-active", "", exitErr),
+			want: []string{
+				"script-01: systemctl is-active -q firewalld",
+				"script-02: systemctl is-active -q firewalld",
+				"script-02: systemctl restart firewalld",
+			},
+		},
+		{
+			name:   "when rendered per node",
+			script: types.Script{Run: "kubeadm init", When: `{{ if has "master" .Roles }}true{{ else }}false{{ end }}`},
+			fake:   NewFakeExecutor().On("false", "", exitErr),
+			want: []string{
+				"script-01: true",
+				"script-01: kubeadm init",
+				"script-02: false",
+			},
+		},
+		{
+			name:   "when is checked before check",
+			script: types.Script{Run: "install", Check: "installed", When: "supported"},
+			fake: NewFakeExecutor().
+				OnNode("script-01", "supported", "", exitErr).
+				OnNode("script-02", "installed", "", exitErr),
+			want: []string{
+				"script-01: supported",
+				"script-02: supported",
+				"script-02: installed",
+				"script-02: install",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fake.On("uname -s", "Linux\nx86_64\nubuntu\n", nil)
+			res := types.Resource{Name: "demo", Hosts: []string{"all"}}
+			if err := RunScriptsWith(tt.fake, []types.Script{tt.script}, res); err != nil {
+				t.Fatalf("RunScriptsWith() error = %v", err)
+			}
+			if got := scriptCommands(tt.fake); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRunScriptOnNode(t *testing.T) {
+	previousDelay := scriptRetryDelay
+	scriptRetryDelay = 0
+	t.Cleanup(func() { scriptRetryDelay = previousDelay })
+	node := &scriptTestNodes[0]
+
+	tests := []struct {
+		name         string
+		script       types.Script
+		fail         bool
+		wantAttempts int
+		wantCalls    int
+	}{
+		{name: "success", script: types.Script{Retries: 2}, wantCalls: 1},
+		{name: "failure", script: types.Script{}, fail: true, wantAttempts: 1, wantCalls: 1},
+		{name: "retries", script: types.Script{Retries: 2}, fail: true, wantAttempts: 3, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeExecutor()
+			if tt.fail {
+				fake.On("systemctl restart demo", "", errors.New("exit status 1"))
+			}
+			err := runScriptOnNode(fake, node, "systemctl restart demo", tt.script)
+			if got := len(fake.Calls()); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if !tt.fail {
+				if err != nil {
+					t.Fatalf("runScriptOnNode() error = %v", err)
+				}
+				return
+			}
+			var scriptErr *ScriptError
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("runScriptOnNode() error = %v, want *ScriptError", err)
+			}
+			if scriptErr.Attempts != tt.wantAttempts || scriptErr.ExitCode != 1 || scriptErr.Host != "script-01" {
+				t.Errorf("ScriptError = %+v", scriptErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// SkipStep 根据 check 和 when 判断节点是否跳过该步骤
+//
+// when 执行失败时跳过；check 执行成功时说明已满足，跳过，即 when 的反义（unless），
+// 因此不单独提供 unless。条件按节点渲染模板，无法获取退出码（如连接失败、超时）时返回错误。
+func SkipStep(executor Executor, node *types.RemoteNode, check, when string, res types.Resource) (bool, string, error) {
+	if when != "" {
+		ok, err := evalCondition(executor, node, when, res)
+		if err != nil {
+			return false, "", fmt.Errorf("when %q: %w", when, err)
+		}
+		if !ok {
+			return true, "when not met: " + when, nil
+		}
+	}
+	if check != "" {
+		ok, err := evalCondition(executor, node, check, res)
+		if err != nil {
+			return false, "", fmt.Errorf("check %q: %w", check, err)
+		}
+		if ok {
+			return true, "check passed: " + check, nil
+		}
+	}
+	return false, "", nil
+}
+
+// evalCondition 在节点上执行条件命令，退出码为 0 时返回 true，不输出命令的输出
+func evalCondition(executor Executor, node *types.RemoteNode, condition string, res types.Resource) (bool, error) {
+	command, err := ParseNodeStr(executor, node, condition, res)
+	if err != nil {
+		return false, fmt.Errorf("parse failed: %w", err)
+	}
+	result, err := executor.Stream(RootContext(), node, command, StreamOptions{Stdout: io.Discard, Stderr: io.Discard})
+	if err == nil {
+		return true, nil
+	}
+	if result != nil && result.ExitCode > 0 {
+		PrintDebug("[%s] condition %q exited with %d", node.Host, command, result.ExitCode)
+		return false, nil
+	}
+	return false, err
+}
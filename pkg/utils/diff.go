@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffMaxCells 逐行比较的最大规模，超过时只输出行数变化
+const diffMaxCells = 4000000
+
+// DiffLines 按行比较两段文本，返回以 "-"、"+" 开头的差异行，相同的行不输出
+func DiffLines(oldText, newText string) []string {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+	n, m := len(oldLines), len(newLines)
+	if n*m > diffMaxCells {
+		return []string{fmt.Sprintf("~ content changed (%d -> %d lines)", n, m)}
+	}
+
+	// lcs[i][j] 为 oldLines[i:] 和 newLines[j:] 的最长公共子序列长度
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && oldLines[i] == newLines[j]:
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "- "+oldLines[i])
+			i++
+		default:
+			diff = append(diff, "+ "+newLines[j])
+			j++
+		}
+	}
+	return diff
+}
+
+// splitLines 拆分为行，忽略末尾换行
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
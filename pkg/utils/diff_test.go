@@ -0,0 +1,56 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    []string
+	}{
+		{name: "unchanged", oldText: "a\nb\n", newText: "a\nb\n", want: nil},
+		{name: "trailing newline ignored", oldText: "a\nb", newText: "a\nb\n", want: nil},
+		{name: "changed line", oldText: "a\nb\nc\n", newText: "a\nB\nc\n", want: []string{"- b", "+ B"}},
+		{name: "added lines", oldText: "a\n", newText: "a\nb\nc\n", want: []string{"+ b", "+ c"}},
+		{name: "removed line", oldText: "a\nb\nc\n", newText: "a\nc\n", want: []string{"- b"}},
+		{name: "from empty", oldText: "", newText: "a\n", want: []string{"+ a"}},
+		{name: "to empty", oldText: "a\n", newText: "", want: []string{"- a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLines(tt.oldText, tt.newText); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	oldText := strings.Repeat("a\n", 3000)
+	newText := strings.Repeat("b\n", 2000)
+	want := []string{"~ content changed (3000 -> 2000 lines)"}
+	if got := DiffLines(oldText, newText); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffLines() = %q, want %q", got, want)
+	}
+}
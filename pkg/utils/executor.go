@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// Executor 在节点上执行命令和传输文件
+//
+// cluster、installer 和 docker 包通过该接口访问节点，测试时可替换为 FakeExecutor。
+type Executor interface {
+	// Run 在节点上执行命令，返回合并的标准输出和标准错误
+	Run(node *types.RemoteNode, command string) (string, error)
+	// Stream 在节点上执行耗时命令，逐行输出并返回退出码和耗时
+	Stream(ctx context.Context, node *types.RemoteNode, command string, opts StreamOptions) (*CommandResult, error)
+	// Copy 复制本地文件到节点
+	Copy(node *types.RemoteNode, localPath, remotePath string) error
+	// Fetch 从节点复制文件到本地
+	Fetch(node *types.RemoteNode, remotePath, localPath string) error
+	// FileExists 检查节点上的文件是否存在
+	FileExists(node *types.RemoteNode, path string) (bool, error)
+}
+
+// NodeExecutor 默认执行器，本机直接执行，远程节点通过 SSH 连接池执行
+type NodeExecutor struct{}
+
+// NewNodeExecutor 创建默认执行器
+func NewNodeExecutor() Executor {
+	return NodeExecutor{}
+}
+
+func (NodeExecutor) Run(node *types.RemoteNode, command string) (string, error) {
+	return RunCommandOnNode(node, command)
+}
+
+func (NodeExecutor) Stream(ctx context.Context, node *types.RemoteNode, command string, opts StreamOptions) (*CommandResult, error) {
+	return StreamCommandOnNode(ctx, node, command, opts)
+}
+
+func (NodeExecutor) Copy(node *types.RemoteNode, localPath, remotePath string) error {
+	return CopyToNode(node, localPath, remotePath)
+}
+
+func (NodeExecutor) Fetch(node *types.RemoteNode, remotePath, localPath string) error {
+	return CopyFromNode(node, remotePath, localPath)
+}
+
+func (NodeExecutor) FileExists(node *types.RemoteNode, path string) (bool, error) {
+	output, err := RunCommandOnNode(node, fmt.Sprintf("test -e %s && echo exists || echo not_exists", ShellQuote(path)))
+	if err != nil {
+		return false, fmt.Errorf("failed to check file %s: %w", path, err)
+	}
+	return strings.TrimSpace(output) == "exists", nil
+}
+
+// LocalNode 表示本机的节点
+func LocalNode() *types.RemoteNode {
+	return &types.RemoteNode{Host: "localhost", IP: "127.0.0.1", IsLocal: true}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// 执行器调用类型
+const (
+	CallRun        = "run"
+	CallCopy       = "copy"
+	CallFetch      = "fetch"
+	CallFileExists = "exists"
+)
+
+// ExecutorCall FakeExecutor 记录的一次调用
+type ExecutorCall struct {
+	Op         string // run/copy/fetch/exists
+	Host       string
+	Command    string
+	LocalPath  string
+	RemotePath string
+}
+
+// String 便于在断言失败时输出调用序列
+func (c ExecutorCall) String() string {
+	switch c.Op {
+	case CallRun:
+		return fmt.Sprintf("%s: %s", c.Host, c.Command)
+	case CallCopy:
+		return fmt.Sprintf("%s: copy %s -> %s", c.Host, c.LocalPath, c.RemotePath)
+	case CallFetch:
+		return fmt.Sprintf("%s: fetch %s -> %s", c.Host, c.RemotePath, c.LocalPath)
+	default:
+		return fmt.Sprintf("%s: exists %s", c.Host, c.RemotePath)
+	}
+}
+
+// fakeRule 预设的命令响应
+type fakeRule struct {
+	host   string // 为空时匹配所有节点
+	match  string // 命令包含该字符串时匹配
+	output string
+	err    error
+}
+
+// FakeExecutor 记录调用并返回预设输出的执行器，用于在没有真实节点时测试编排流程
+//
+// 命令按注册顺序匹配第一条规则，未匹配的命令返回空输出。
+// Copy 的目标路径会记为节点上已存在的文件，FileExists 和 Fetch 据此返回结果。
+type FakeExecutor struct {
+	mu    sync.Mutex
+	calls []ExecutorCall
+	rules []fakeRule
+	files map[string]map[string]string
+}
+
+// NewFakeExecutor 创建 FakeExecutor
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{files: make(map[string]map[string]string)}
+}
+
+// On 为所有节点上包含 match 的命令预设输出
+func (f *FakeExecutor) On(match, output string, err error) *FakeExecutor {
+	return f.OnNode("", match, output, err)
+}
+
+// OnNode 为指定节点上包含 match 的命令预设输出
+func (f *FakeExecutor) OnNode(host, match, output string, err error) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{host: host, match: match, output: output, err: err})
+	return f
+}
+
+// SetFile 设置节点上的文件内容
+func (f *FakeExecutor) SetFile(host, path, content string) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setFile(host, path, content)
+	return f
+}
+
+func (f *FakeExecutor) setFile(host, path, content string) {
+	if f.files[host] == nil {
+		f.files[host] = make(map[string]string)
+	}
+	f.files[host][path] = content
+}
+
+// Calls 返回所有调用记录
+func (f *FakeExecutor) Calls() []ExecutorCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ExecutorCall(nil), f.calls...)
+}
+
+// Commands 返回在指定节点上执行的命令，host 为空时返回所有节点的命令
+func (f *FakeExecutor) Commands(host string) []string {
+	var commands []string
+	for _, call := range f.Calls() {
+		if call.Op == CallRun && (host == "" || call.Host == host) {
+			commands = append(commands, call.Command)
+		}
+	}
+	return commands
+}
+
+// Reset 清空调用记录，保留预设规则和文件
+func (f *FakeExecutor) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+func (f *FakeExecutor) Run(node *types.RemoteNode, command string) (string, error) {
+	host := fakeHost(node)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, ExecutorCall{Op: CallRun, Host: host, Command: command})
+	for _, rule := range f.rules {
+		if (rule.host == "" || rule.host == host) && strings.Contains(command, rule.match) {
+			return rule.output, rule.err
+		}
+	}
+	return "", nil
+}
+
+// Stream 与 Run 使用相同的规则，预设输出按行写入 opts.Stdout
+func (f *FakeExecutor) Stream(ctx context.Context, node *types.RemoteNode, command string, opts StreamOptions) (*CommandResult, error) {
+	output, err := f.Run(node, command)
+	result := &CommandResult{Host: fakeHost(node), Command: command, Output: output}
+	if opts.Stdout != nil && output != "" {
+		w := &prefixWriter{prefix: "[" + result.Host + "] ", out: opts.Stdout, mu: &sync.Mutex{}, copy: io.Discard}
+		w.Write([]byte(output))
+		w.Flush()
+	}
+	if err != nil {
+		result.ExitCode = 1
+	}
+	return result, err
+}
+
+func (f *FakeExecutor) Copy(node *types.RemoteNode, localPath, remotePath string) error {
+	host := fakeHost(node)
+	content, _ := os.ReadFile(localPath)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, ExecutorCall{Op: CallCopy, Host: host, LocalPath: localPath, RemotePath: remotePath})
+	f.setFile(host, remotePath, string(content))
+	return nil
+}
+
+func (f *FakeExecutor) Fetch(node *types.RemoteNode, remotePath, localPath string) error {
+	host := fakeHost(node)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, ExecutorCall{Op: CallFetch, Host: host, LocalPath: localPath, RemotePath: remotePath})
+	content, ok := f.files[host][remotePath]
+	f.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%s: %s: no such file", host, remotePath)
+	}
+	if err := CreateDir(filepath.Dir(localPath)); err != nil {
+		return err
+	}
+	return os.WriteFile(localPath, []byte(content), 0644)
+}
+
+func (f *FakeExecutor) FileExists(node *types.RemoteNode, path string) (bool, error) {
+	host := fakeHost(node)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, ExecutorCall{Op: CallFileExists, Host: host, RemotePath: path})
+	_, ok := f.files[host][path]
+	return ok, nil
+}
+
+// fakeHost 调用记录中的节点名称
+func fakeHost(node *types.RemoteNode) string {
+	if node.Host != "" {
+		return node.Host
+	}
+	return node.IP
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/structure-projects/somcli/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 主机密钥校验模式
+const (
+	HostKeyStrict   = "strict"   // 只接受 known_hosts 中已有的主机密钥
+	HostKeyTOFU     = "tofu"     // 首次连接时记录主机密钥，之后严格校验
+	HostKeyInsecure = "insecure" // 不校验主机密钥
+)
+
+// knownHostsMu 串行化 known_hosts 的读取和追加
+var knownHostsMu sync.Mutex
+
+// errHostKeyCaptured 获取主机密钥后中止握手
+var errHostKeyCaptured = errors.New("host key captured")
+
+// HostKeyCheckingMode 当前主机密钥校验模式，默认 tofu
+func HostKeyCheckingMode() string {
+	mode := strings.ToLower(strings.TrimSpace(viper.GetString("host_key_checking")))
+	if mode == "" {
+		return HostKeyTOFU
+	}
+	return mode
+}
+
+// KnownHostsFile somcli 管理的 known_hosts 文件，新信任的主机密钥写入此文件
+func KnownHostsFile() string {
+	if path := viper.GetString("known_hosts"); path != "" {
+		return ExpandPath(path)
+	}
+	return filepath.Join(GetHomeDir(), ".somcli", "known_hosts")
+}
+
+// knownHostsFiles 参与校验的 known_hosts 文件：somcli 文件和 ~/.ssh/known_hosts
+func knownHostsFiles() ([]string, error) {
+	managed := KnownHostsFile()
+	if err := os.MkdirAll(filepath.Dir(managed), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+	f, err := os.OpenFile(managed, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open known_hosts file: %w", err)
+	}
+	f.Close()
+
+	files := []string{managed}
+	if user := filepath.Join(GetHomeDir(), ".ssh", "known_hosts"); user != managed && FileExists(user) {
+		files = append(files, user)
+	}
+	return files, nil
+}
+
+// hostKeyCallback 按当前模式创建主机密钥校验回调
+func hostKeyCallback() (ssh.HostKeyCallback, error) {
+	mode := HostKeyCheckingMode()
+	switch mode {
+	case HostKeyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil
+	case HostKeyStrict, HostKeyTOFU:
+	default:
+		return nil, fmt.Errorf("unsupported host key checking mode: %s (expected strict, tofu or insecure)", mode)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		known, err := checkKnownHost(hostname, remote, key)
+		if err != nil || known {
+			return err
+		}
+
+		if mode == HostKeyStrict {
+			return fmt.Errorf("host key for %s is not trusted (%s %s), run 'somcli nodes trust' first",
+				hostname, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		if err := appendKnownHost(hostname, key); err != nil {
+			return err
+		}
+		PrintWarning("Permanently added %s (%s %s) to %s",
+			hostname, key.Type(), ssh.FingerprintSHA256(key), KnownHostsFile())
+		return nil
+	}, nil
+}
+
+// checkKnownHost 校验主机密钥，返回主机是否已知；密钥不匹配时返回错误
+func checkKnownHost(hostname string, remote net.Addr, key ssh.PublicKey) (bool, error) {
+	files, err := knownHostsFiles()
+	if err != nil {
+		return false, err
+	}
+	check, err := knownhosts.New(files...)
+	if err != nil {
+		return false, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	err = check(hostname, remote, key)
+	if err == nil {
+		return true, nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return false, err
+	}
+	if len(keyErr.Want) == 0 {
+		return false, nil
+	}
+
+	want := keyErr.Want[0]
+	return false, fmt.Errorf("HOST KEY MISMATCH for %s: server presented %s %s, but %s:%d expects %s %s. "+
+		"The host may have been reinstalled or the connection is being intercepted; "+
+		"if the change is expected, remove the old entry and run 'somcli nodes trust'",
+		hostname, key.Type(), ssh.FingerprintSHA256(key),
+		want.Filename, want.Line, want.Key.Type(), ssh.FingerprintSHA256(want.Key))
+}
+
+// knownHostKeyAlgorithms known_hosts 中为 addr（host:port）记录的主机密钥算法
+//
+// 握手时只协商这些算法，避免服务端提供了未记录类型的密钥而校验失败（golang/go#29286）。
+// 没有记录或不校验主机密钥时返回空，使用默认算法列表。
+func knownHostKeyAlgorithms(addr string) []string {
+	if HostKeyCheckingMode() == HostKeyInsecure {
+		return nil
+	}
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	files, err := knownHostsFiles()
+	if err != nil {
+		return nil
+	}
+	check, err := knownhosts.New(files...)
+	if err != nil {
+		return nil
+	}
+
+	remote := &net.TCPAddr{}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		remote.IP = net.ParseIP(host)
+		remote.Port, _ = strconv.Atoi(port)
+	}
+	var keyErr *knownhosts.KeyError
+	if err := check(addr, remote, probeKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algos []string
+	for _, want := range keyErr.Want {
+		keyAlgos := []string{want.Key.Type()}
+		if want.Key.Type() == ssh.KeyAlgoRSA {
+			keyAlgos = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algo := range keyAlgos {
+			if !StringInSlice(algo, algos) {
+				algos = append(algos, algo)
+			}
+		}
+	}
+	return algos
+}
+
+// probeKey 不会出现在 known_hosts 中的公钥，用于查询主机已记录的密钥
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "somcli-probe" }
+func (probeKey) Marshal() []byte                              { return []byte("somcli-probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("probe key") }
+
+// appendKnownHost 将主机密钥写入 somcli 管理的 known_hosts 文件
+func appendKnownHost(hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(KnownHostsFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts file: %w", err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write known_hosts file: %w", err)
+	}
+	return nil
+}
+
+// TrustHostKey 获取节点主机密钥并写入 known_hosts，已信任时不做修改
+//
+// 返回主机密钥指纹以及是否新增了记录。已记录的密钥与服务端不一致时返回错误。
+// 配置了跳板机的节点经跳板机获取密钥，跳板机本身按当前模式校验。
+func TrustHostKey(node *types.RemoteNode) (string, bool, error) {
+	var key ssh.PublicKey
+	var hostname string
+	var remote net.Addr
+	config := &ssh.ClientConfig{
+		User: node.User,
+		HostKeyCallback: func(h string, r net.Addr, k ssh.PublicKey) error {
+			hostname, remote, key = h, r, k
+			return errHostKeyCaptured
+		},
+		Timeout: 30 * time.Second,
+	}
+	client, jumps, err := dialNode(node, config)
+	if client != nil {
+		client.Close()
+	}
+	closeSSHClients(jumps)
+	if key == nil {
+		return "", false, fmt.Errorf("failed to fetch host key from %s: %v", nodeEndpoint(node), err)
+	}
+	fingerprint := key.Type() + " " + ssh.FingerprintSHA256(key)
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	known, err := checkKnownHost(hostname, remote, key)
+	if err != nil {
+		return fingerprint, false, err
+	}
+	if known {
+		return fingerprint, false, nil
+	}
+	if err := appendKnownHost(hostname, key); err != nil {
+		return fingerprint, false, err
+	}
+	return fingerprint, true, nil
+}
+
+// SSHHostKeyArgs 调用 ssh/scp 命令时使用的主机密钥校验参数
+func SSHHostKeyArgs() []string {
+	switch HostKeyCheckingMode() {
+	case HostKeyInsecure:
+		return []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null"}
+	case HostKeyStrict:
+		return []string{"-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile=" + userKnownHostsOption()}
+	default:
+		return []string{"-o", "StrictHostKeyChecking=accept-new", "-o", "UserKnownHostsFile=" + userKnownHostsOption()}
+	}
+}
+
+// userKnownHostsOption UserKnownHostsFile 选项值，OpenSSH 将新主机写入第一个文件
+func userKnownHostsOption() string {
+	files, err := knownHostsFiles()
+	if err != nil {
+		return KnownHostsFile()
+	}
+	return strings.Join(files, " ")
+}
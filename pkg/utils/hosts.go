@@ -0,0 +1,196 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// SelectNodes 按主机名或选择器从 nodes 中选择节点
+//
+// 支持的写法：
+//
+//	all                   所有节点
+//	role:<角色>            role 或 roles 包含该角色的节点
+//	label:<键>=<值>        labels 中键值相同的节点，label:<键> 只要求存在该键
+//	10.0.0.0/24           IP 在网段内的节点
+//	10.0.0.10-10.0.0.20   IP 在范围内的节点，也可以写成 10.0.0.10-20
+//	其他                  host 或 ip 相同的节点
+//
+// 选择器写法错误或主机名不在 nodes 中时返回错误，选择器没有匹配的节点时返回空列表。
+func SelectNodes(selector string, nodes []types.RemoteNode) ([]types.RemoteNode, error) {
+	selector = strings.TrimSpace(selector)
+	match, err := nodeMatcher(selector)
+	if err != nil {
+		return nil, err
+	}
+	selected := []types.RemoteNode{}
+	for _, node := range nodes {
+		if match(node) {
+			selected = append(selected, node)
+		}
+	}
+	if len(selected) == 0 && isHostName(selector) {
+		return nil, fmt.Errorf("unknown host %q", selector)
+	}
+	return selected, nil
+}
+
+// ResolveHosts 将资源的 hosts 解析为节点清单中的节点，结果按出现顺序去重
+//
+// 不在节点清单中的本机地址（如 localhost）解析为本机；未知的主机名或没有匹配任何节点的选择器返回错误。
+func ResolveHosts(hosts []string) ([]*types.RemoteNode, error) {
+	var resolved []*types.RemoteNode
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		selected, err := SelectNodes(host, Config.Nodes)
+		if err != nil {
+			if !isHostName(host) || !isLocalAddress(host) {
+				return nil, err
+			}
+			selected = []types.RemoteNode{*LocalNode()}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("hosts selector %q matched no nodes", host)
+		}
+		for j := range selected {
+			node := selected[j]
+			key := node.Host + "/" + node.IP
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			resolved = append(resolved, &node)
+		}
+	}
+	return resolved, nil
+}
+
+// ValidateHosts 校验 hosts 中的选择器写法，以及主机名是否在节点清单中
+func ValidateHosts(hosts []string, nodes []types.RemoteNode) error {
+	for _, host := range hosts {
+		if _, err := SelectNodes(host, nodes); err != nil {
+			if isHostName(host) && isLocalAddress(host) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// NodeName 节点在 hosts 中使用的名称
+func NodeName(node types.RemoteNode) string {
+	if node.Host != "" {
+		return node.Host
+	}
+	return node.IP
+}
+
+// NodeHasRole 判断节点是否具有指定角色
+func NodeHasRole(node types.RemoteNode, role string) bool {
+	return node.Role == role || StringInSlice(role, node.Roles)
+}
+
+// nodeMatcher 解析选择器
+func nodeMatcher(selector string) (func(types.RemoteNode) bool, error) {
+	switch {
+	case selector == "":
+		return nil, fmt.Errorf("empty host")
+	case selector == "all":
+		return func(types.RemoteNode) bool { return true }, nil
+	case strings.HasPrefix(selector, "role:"):
+		role := strings.TrimPrefix(selector, "role:")
+		if role == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing role", selector)
+		}
+		return func(node types.RemoteNode) bool { return NodeHasRole(node, role) }, nil
+	case strings.HasPrefix(selector, "label:"):
+		key, value, hasValue := strings.Cut(strings.TrimPrefix(selector, "label:"), "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing label key", selector)
+		}
+		return func(node types.RemoteNode) bool {
+			v, ok := node.Labels[key]
+			return ok && (!hasValue || v == value)
+		}, nil
+	case strings.Contains(selector, "/"):
+		prefix, err := netip.ParsePrefix(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		return func(node types.RemoteNode) bool {
+			addr, err := netip.ParseAddr(node.IP)
+			return err == nil && prefix.Contains(addr)
+		}, nil
+	}
+
+	if first, last, ok, err := parseIPRange(selector); ok {
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		return func(node types.RemoteNode) bool {
+			addr, err := netip.ParseAddr(node.IP)
+			return err == nil && addr.Compare(first) >= 0 && addr.Compare(last) <= 0
+		}, nil
+	}
+	return func(node types.RemoteNode) bool {
+		return node.Host == selector || node.IP == selector
+	}, nil
+}
+
+// parseIPRange 解析 <起始 IP>-<结束 IP> 或 <起始 IP>-<最后一段>，ok 表示写法为 IP 范围
+func parseIPRange(selector string) (first, last netip.Addr, ok bool, err error) {
+	start, end, found := strings.Cut(selector, "-")
+	if !found {
+		return first, last, false, nil
+	}
+	first, parseErr := netip.ParseAddr(start)
+	if parseErr != nil {
+		return first, last, false, nil
+	}
+	if !strings.Contains(end, ".") && !strings.Contains(end, ":") && first.Is4() {
+		octets := first.As4()
+		end = fmt.Sprintf("%d.%d.%d.%s", octets[0], octets[1], octets[2], end)
+	}
+	if last, err = netip.ParseAddr(end); err != nil {
+		return first, last, true, err
+	}
+	if first.Is4() != last.Is4() {
+		return first, last, true, fmt.Errorf("range mixes IPv4 and IPv6")
+	}
+	if first.Compare(last) > 0 {
+		return first, last, true, fmt.Errorf("range start is after end")
+	}
+	return first, last, true, nil
+}
+
+// isHostName 判断是否为主机名或单个 IP，而不是选择器
+func isHostName(selector string) bool {
+	if selector == "all" || strings.HasPrefix(selector, "role:") || strings.HasPrefix(selector, "label:") || strings.Contains(selector, "/") {
+		return false
+	}
+	if net.ParseIP(selector) != nil {
+		return true
+	}
+	_, _, isRange, _ := parseIPRange(selector)
+	return !isRange
+}
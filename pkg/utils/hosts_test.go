@@ -0,0 +1,144 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// hostsTestNodes 跨越两个 /24 网段的节点清单
+var hostsTestNodes = []types.RemoteNode{
+	{Host: "master-01", IP: "198.51.100.250", Role: "master", Labels: map[string]string{"zone": "a"}},
+	{Host: "master-02", IP: "198.51.100.251", Roles: []string{"master", "etcd"}, Labels: map[string]string{"zone": "b"}},
+	{Host: "worker-01", IP: "198.51.101.5", Role: "worker", Labels: map[string]string{"zone": "a", "gpu": "true"}},
+	{Host: "worker-02", IP: "198.51.101.6", Role: "worker"},
+}
+
+// nodeNames 返回节点的主机名
+func nodeNames(nodes []types.RemoteNode) []string {
+	names := []string{}
+	for _, node := range nodes {
+		names = append(names, node.Host)
+	}
+	return names
+}
+
+func TestSelectNodes(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []string
+		wantErr  string
+	}{
+		{selector: "all", want: []string{"master-01", "master-02", "worker-01", "worker-02"}},
+		{selector: "master-02", want: []string{"master-02"}},
+		{selector: " worker-02 ", want: []string{"worker-02"}},
+		{selector: "198.51.101.5", want: []string{"worker-01"}},
+		{selector: "role:master", want: []string{"master-01", "master-02"}},
+		{selector: "role:etcd", want: []string{"master-02"}},
+		{selector: "role:storage", want: []string{}},
+		{selector: "label:zone=a", want: []string{"master-01", "worker-01"}},
+		{selector: "label:gpu", want: []string{"worker-01"}},
+		{selector: "label:zone=c", want: []string{}},
+		{selector: "198.51.100.0/24", want: []string{"master-01", "master-02"}},
+		{selector: "198.51.100.0/23", want: []string{"master-01", "master-02", "worker-01", "worker-02"}},
+		{selector: "198.51.100.251-198.51.101.5", want: []string{"master-02", "worker-01"}},
+		{selector: "198.51.101.1-6", want: []string{"worker-01", "worker-02"}},
+		{selector: "198.51.101.6-6", want: []string{"worker-02"}},
+		{selector: "198.51.101.7-10", want: []string{}},
+		{selector: "unknown-01", wantErr: `unknown host "unknown-01"`},
+		{selector: "198.51.101.99", wantErr: `unknown host "198.51.101.99"`},
+		{selector: "", wantErr: "empty host"},
+		{selector: "role:", wantErr: "missing role"},
+		{selector: "label:=a", wantErr: "missing label key"},
+		{selector: "198.51.100.0/33", wantErr: "invalid selector"},
+		{selector: "198.51.101.6-198.51.101.5", wantErr: "range start is after end"},
+		{selector: "198.51.101.6-1", wantErr: "range start is after end"},
+		{selector: "198.51.101.1-300", wantErr: "invalid selector"},
+		{selector: "198.51.101.1-2001:db8::1", wantErr: "mixes IPv4 and IPv6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			got, err := SelectNodes(tt.selector, hostsTestNodes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SelectNodes(%q) error = %v, want %q", tt.selector, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectNodes(%q) error = %v", tt.selector, err)
+			}
+			if names := nodeNames(got); !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("SelectNodes(%q) = %v, want %v", tt.selector, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHosts(t *testing.T) {
+	previous := Config.Nodes
+	Config.Nodes = hostsTestNodes
+	t.Cleanup(func() { Config.Nodes = previous })
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		want    []string
+		wantErr string
+	}{
+		{name: "deduplicated in order", hosts: []string{"worker-01", "role:master", "label:zone=a"}, want: []string{"worker-01", "master-01", "master-02"}},
+		{name: "localhost is not in the inventory", hosts: []string{"localhost"}, want: []string{"localhost"}},
+		{name: "unknown host", hosts: []string{"master-01", "mastr-01"}, wantErr: `unknown host "mastr-01"`},
+		{name: "selector without nodes", hosts: []string{"role:storage"}, wantErr: `hosts selector "role:storage" matched no nodes`},
+		{name: "invalid range", hosts: []string{"198.51.101.9-1"}, wantErr: "range start is after end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveHosts(tt.hosts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveHosts() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveHosts() error = %v", err)
+			}
+			names := []string{}
+			for _, node := range got {
+				names = append(names, node.Host)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ResolveHosts() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHosts(t *testing.T) {
+	if err := ValidateHosts([]string{"all", "role:worker", "master-01", "127.0.0.1", "198.51.100.0/24"}, hostsTestNodes); err != nil {
+		t.Errorf("ValidateHosts() error = %v", err)
+	}
+	if err := ValidateHosts([]string{"master-01", "typo-01"}, hostsTestNodes); err == nil || !strings.Contains(err.Error(), "typo-01") {
+		t.Errorf("ValidateHosts() error = %v, want unknown host typo-01", err)
+	}
+}
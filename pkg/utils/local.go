@@ -0,0 +1,96 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+var (
+	localIdentityOnce sync.Once
+	localAddrs        map[string]bool // 本机所有网卡地址
+	localNames        map[string]bool // 本机主机名（小写，含短主机名）
+)
+
+// loadLocalIdentity 收集本机网卡地址和主机名，只在首次使用时执行
+func loadLocalIdentity() {
+	localIdentityOnce.Do(func() {
+		localAddrs = map[string]bool{"127.0.0.1": true, "::1": true}
+		localNames = map[string]bool{"localhost": true}
+
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					localAddrs[ipNet.IP.String()] = true
+				}
+			}
+		} else {
+			PrintDebug("failed to list interface addresses: %v", err)
+		}
+
+		if hostname, err := os.Hostname(); err == nil && hostname != "" {
+			hostname = strings.ToLower(hostname)
+			localNames[hostname] = true
+			localNames[strings.SplitN(hostname, ".", 2)[0]] = true
+		}
+	})
+}
+
+// isLocalAddress 判断地址或主机名是否指向本机
+func isLocalAddress(address string) bool {
+	if address == "" {
+		return false
+	}
+	loadLocalIdentity()
+
+	if ip := net.ParseIP(address); ip != nil {
+		return localAddrs[ip.String()]
+	}
+	return localNames[strings.ToLower(address)]
+}
+
+// IsLocalNode 判断节点是否为本机，结果缓存在 node.IsLocal
+//
+// 设置了 IP 时只按 IP 判断，IP 与本机任一网卡地址相同时视为本机；未设置 IP 时按主机名判断。
+// 回环地址配合非默认 SSH 端口（如转发到容器的 127.0.0.1:2222）或跳板机时指向其他机器，始终通过 SSH 访问；
+// 本机网卡地址使用非默认端口时仍视为本机。
+func IsLocalNode(node *types.RemoteNode) bool {
+	if node.IsLocal {
+		return true
+	}
+	address := node.IP
+	if address == "" {
+		address = node.Host
+	}
+	if isLoopbackAddress(address) && (node.ProxyJump != "" || nodePort(node) != defaultSSHPort) {
+		return false
+	}
+	node.IsLocal = isLocalAddress(address)
+	return node.IsLocal
+}
+
+// isLoopbackAddress 判断地址是否为回环地址或 localhost
+func isLoopbackAddress(address string) bool {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.IsLoopback()
+	}
+	return strings.EqualFold(address, "localhost")
+}
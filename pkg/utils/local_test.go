@@ -0,0 +1,78 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+func TestIsLocalNode(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localIP := localInterfaceIP(t)
+
+	tests := []struct {
+		name string
+		node types.RemoteNode
+		want bool
+	}{
+		{name: "loopback ip", node: types.RemoteNode{Host: "node-01", IP: "127.0.0.1"}, want: true},
+		{name: "explicit default port", node: types.RemoteNode{IP: "127.0.0.1", Port: 22}, want: true},
+		{name: "hostname without ip", node: types.RemoteNode{Host: hostname}, want: true},
+		{name: "localhost without ip", node: types.RemoteNode{Host: "localhost"}, want: true},
+		{name: "local hostname with remote ip", node: types.RemoteNode{Host: hostname, IP: "192.0.2.10"}, want: false},
+		{name: "localhost with remote ip", node: types.RemoteNode{Host: "localhost", IP: "192.0.2.10"}, want: false},
+		{name: "forwarded port", node: types.RemoteNode{Host: "container", IP: "127.0.0.1", Port: 2222}, want: false},
+		{name: "localhost with forwarded port", node: types.RemoteNode{Host: "localhost", Port: 2222}, want: false},
+		{name: "proxy jump", node: types.RemoteNode{IP: "127.0.0.1", ProxyJump: "bastion"}, want: false},
+		{name: "interface ip with non-default port", node: types.RemoteNode{Host: "master-01", IP: localIP, Port: 2222}, want: true},
+		{name: "interface ip with proxy jump", node: types.RemoteNode{Host: "master-01", IP: localIP, ProxyJump: "bastion"}, want: true},
+		{name: "remote ip", node: types.RemoteNode{Host: "node-02", IP: "192.0.2.11"}, want: false},
+		{name: "marked local", node: types.RemoteNode{Host: "node-03", IP: "192.0.2.12", IsLocal: true}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node
+			if got := IsLocalNode(&node); got != tt.want {
+				t.Errorf("IsLocalNode(%+v) = %v, want %v", tt.node, got, tt.want)
+			}
+		})
+	}
+}
+
+// localInterfaceIP 返回本机一个非回环网卡地址
+func localInterfaceIP(t *testing.T) string {
+	t.Helper()
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			return ipNet.IP.String()
+		}
+	}
+	t.Skip("no non-loopback interface address")
+	return ""
+}
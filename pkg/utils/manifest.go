@@ -0,0 +1,338 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"gopkg.in/yaml.v2"
+)
+
+// SupportedManifestVersions 支持的配置文档版本
+var SupportedManifestVersions = []string{"1.0"}
+
+// manifestKinds 小写 kind 到类型名的映射
+var manifestKinds = map[string]string{
+	"download": types.KindDownload,
+	"resource": types.KindResource,
+	"app":      types.KindApp,
+	"node":     types.KindNode,
+	"source":   types.KindSource,
+}
+
+// manifestHeader 每个文档的公共字段
+type manifestHeader struct {
+	Version string            `yaml:"version"`
+	Kind    string            `yaml:"kind"`
+	Vars    map[string]string `yaml:"vars"`
+}
+
+type resourceDocument struct {
+	Proxy     string           `yaml:"proxy"`
+	Resources []types.Resource `yaml:"resources"`
+}
+
+type appDocument struct {
+	Apps       []types.App `yaml:"apps"`
+	LegacyApps []types.App `yaml:"Apps"`
+}
+
+type nodeDocument struct {
+	Nodes []types.RemoteNode `yaml:"nodes"`
+	SSH   types.SSHDefaults  `yaml:"ssh"`
+}
+
+type sourceDocument struct {
+	Sources []types.Source `yaml:"sources"`
+}
+
+// LoadManifest 加载配置文件中的所有文档
+//
+// 文档以 --- 分隔，通过 kind 区分 Download、Resource、App、Node、Source，每个文档必须声明 version。
+// 没有 kind 和 version 的文档按旧的扁平格式（proxy、resources、nodes、ssh）读取。
+func LoadManifest(path string) (*types.Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// ParseManifest 解析多文档配置内容并校验
+func ParseManifest(data []byte) (*types.Manifest, error) {
+	manifest := &types.Manifest{}
+	// kind: Download/Resource 文档中已出现的资源名称
+	seen := map[string]map[string]bool{types.KindDownload: {}, types.KindResource: {}}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for index := 1; ; index++ {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		// 重新编码后按 kind 解析为对应结构
+		doc, err := yaml.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+		if err := parseManifestDocument(manifest, doc, seen); err != nil {
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+	}
+
+	if err := ValidateManifest(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// parseManifestDocument 解析单个文档并合并到 manifest
+//
+// kind: Download/Resource 中的资源名称在同类文档中必须唯一；旧格式文件允许同名资源的多个版本，不做检查。
+func parseManifestDocument(manifest *types.Manifest, doc []byte, seen map[string]map[string]bool) error {
+	var header manifestHeader
+	if err := yaml.Unmarshal(doc, &header); err != nil {
+		return err
+	}
+	// 任意文档中的 vars 都合并为配置级变量，后出现的同名变量覆盖前面的
+	for name, value := range header.Vars {
+		if manifest.Vars == nil {
+			manifest.Vars = make(map[string]string, len(header.Vars))
+		}
+		manifest.Vars[name] = value
+	}
+
+	if header.Kind == "" && header.Version == "" {
+		var legacy types.ResourceConfig
+		if err := yaml.Unmarshal(doc, &legacy); err != nil {
+			return err
+		}
+		for _, res := range legacy.Resources {
+			if res.Name == "" {
+				return fmt.Errorf("resource without name")
+			}
+		}
+		if legacy.Proxy != "" {
+			manifest.Proxy = legacy.Proxy
+		}
+		manifest.Resources = append(manifest.Resources, legacy.Resources...)
+		manifest.Nodes = append(manifest.Nodes, legacy.Nodes...)
+		if legacy.SSH != (types.SSHDefaults{}) {
+			manifest.SSH = legacy.SSH
+		}
+		return nil
+	}
+
+	kind, ok := manifestKinds[strings.ToLower(header.Kind)]
+	if !ok {
+		if header.Kind == "" {
+			return fmt.Errorf("missing kind")
+		}
+		return fmt.Errorf("unknown kind %q (supported: Download, Resource, App, Node, Source)", header.Kind)
+	}
+	if err := checkManifestVersion(header.Version); err != nil {
+		return fmt.Errorf("kind %s: %w", kind, err)
+	}
+	if manifest.Version == "" {
+		manifest.Version = header.Version
+	}
+
+	switch kind {
+	case types.KindDownload, types.KindResource:
+		var d resourceDocument
+		if err := yaml.Unmarshal(doc, &d); err != nil {
+			return fmt.Errorf("kind %s: %w", kind, err)
+		}
+		for _, res := range d.Resources {
+			if res.Name == "" {
+				return fmt.Errorf("kind %s: resource without name", kind)
+			}
+			if seen[kind][res.Name] {
+				return fmt.Errorf("kind %s: duplicate resource %q", kind, res.Name)
+			}
+			seen[kind][res.Name] = true
+		}
+		if d.Proxy != "" {
+			manifest.Proxy = d.Proxy
+		}
+		if kind == types.KindDownload {
+			manifest.Downloads = append(manifest.Downloads, d.Resources...)
+		} else {
+			manifest.Resources = append(manifest.Resources, d.Resources...)
+		}
+	case types.KindApp:
+		var d appDocument
+		if err := yaml.Unmarshal(doc, &d); err != nil {
+			return fmt.Errorf("kind %s: %w", kind, err)
+		}
+		manifest.Apps = append(manifest.Apps, d.Apps...)
+		manifest.Apps = append(manifest.Apps, d.LegacyApps...)
+	case types.KindNode:
+		var d nodeDocument
+		if err := yaml.Unmarshal(doc, &d); err != nil {
+			return fmt.Errorf("kind %s: %w", kind, err)
+		}
+		manifest.Nodes = append(manifest.Nodes, d.Nodes...)
+		if d.SSH != (types.SSHDefaults{}) {
+			manifest.SSH = d.SSH
+		}
+	case types.KindSource:
+		var d sourceDocument
+		if err := yaml.Unmarshal(doc, &d); err != nil {
+			return fmt.Errorf("kind %s: %w", kind, err)
+		}
+		manifest.Sources = append(manifest.Sources, d.Sources...)
+	}
+	return nil
+}
+
+// checkManifestVersion 校验文档版本
+func checkManifestVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("missing version (supported: %s)", strings.Join(SupportedManifestVersions, ", "))
+	}
+	for _, supported := range SupportedManifestVersions {
+		if version == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported version %q (supported: %s)", version, strings.Join(SupportedManifestVersions, ", "))
+}
+
+// ValidateManifest 校验节点和应用名称唯一以及流程引用的资源和依赖存在，资源名称在解析文档时校验
+func ValidateManifest(manifest *types.Manifest) error {
+	hosts := make(map[string]bool)
+	for _, node := range manifest.Nodes {
+		if node.Host == "" && node.IP == "" {
+			return fmt.Errorf("kind %s: node without host or ip", types.KindNode)
+		}
+		if node.Host != "" {
+			if hosts[node.Host] {
+				return fmt.Errorf("kind %s: duplicate node %q", types.KindNode, node.Host)
+			}
+			hosts[node.Host] = true
+		}
+	}
+
+	apps := make(map[string]bool)
+	for _, app := range manifest.Apps {
+		if app.Name == "" {
+			return fmt.Errorf("kind %s: app without name", types.KindApp)
+		}
+		if apps[app.Name] {
+			return fmt.Errorf("kind %s: duplicate app %q", types.KindApp, app.Name)
+		}
+		apps[app.Name] = true
+
+		flows := make(map[string]bool)
+		for _, flow := range app.Flows {
+			if flow.Resource == "" {
+				return fmt.Errorf("app %s: flow %q without resource", app.Name, flow.Name)
+			}
+			if _, ok := FindManifestResource(manifest, flow.Resource); !ok {
+				return fmt.Errorf("app %s: flow %q references unknown resource %q", app.Name, flow.Name, flow.Resource)
+			}
+			if flow.Name != "" {
+				flows[flow.Name] = true
+			}
+			flows[flow.Resource] = true
+		}
+		for _, flow := range app.Flows {
+			if flow.DependsOn == nil {
+				continue
+			}
+			for _, dep := range *flow.DependsOn {
+				if !flows[dep] {
+					return fmt.Errorf("app %s: flow %q depends on unknown flow %q", app.Name, flow.Name, dep)
+				}
+			}
+		}
+	}
+	return validateManifestHosts(manifest)
+}
+
+// validateManifestHosts 按节点清单校验资源的 hosts 和流程的 nodes
+//
+// 节点清单包括已加载的节点、kind: Node 中的节点以及应用 hosts 中的节点。
+func validateManifestHosts(manifest *types.Manifest) error {
+	inventory := append(append([]types.RemoteNode(nil), Config.Nodes...), manifest.Nodes...)
+	for _, app := range manifest.Apps {
+		for _, host := range app.Hosts {
+			inventory = append(inventory, types.RemoteNode{Host: host.Host, IP: host.IP, Roles: host.Roles})
+		}
+	}
+
+	for label, resources := range map[string][]types.Resource{"download": manifest.Downloads, "resource": manifest.Resources} {
+		for _, res := range resources {
+			if err := ValidateHosts(res.Hosts, inventory); err != nil {
+				return fmt.Errorf("%s %q hosts: %w", label, res.Name, err)
+			}
+		}
+	}
+	for _, app := range manifest.Apps {
+		for _, flow := range app.Flows {
+			if strings.TrimSpace(flow.Nodes) == "" {
+				continue
+			}
+			if err := ValidateHosts([]string{flow.Nodes}, inventory); err != nil {
+				return fmt.Errorf("app %s: flow %q nodes: %w", app.Name, flow.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FindManifestResource 按名称查找资源，先查找 kind: Resource 再查找 kind: Download
+func FindManifestResource(manifest *types.Manifest, name string) (types.Resource, bool) {
+	for _, res := range manifest.Resources {
+		if res.Name == name {
+			return res, true
+		}
+	}
+	for _, res := range manifest.Downloads {
+		if res.Name == name {
+			return res, true
+		}
+	}
+	return types.Resource{}, false
+}
+
+// ManifestResourceConfig 转换为扁平的资源配置，包含下载和安装的资源
+func ManifestResourceConfig(manifest *types.Manifest) *types.ResourceConfig {
+	config := &types.ResourceConfig{
+		Proxy: manifest.Proxy,
+		Vars:  manifest.Vars,
+		Nodes: manifest.Nodes,
+		SSH:   manifest.SSH,
+	}
+	config.Resources = append(config.Resources, manifest.Downloads...)
+	config.Resources = append(config.Resources, manifest.Resources...)
+	return config
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadManifestExampleConfig(t *testing.T) {
+	manifest, err := LoadManifest("../../configs/config.yaml")
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if len(manifest.Resources) == 0 {
+		t.Error("LoadManifest() returned no resources")
+	}
+}
+
+func TestParseManifestResourceNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "legacy versions of the same resource",
+			data: `
+resources:
+  - name: cri-dockerd
+    version: 0.3.17
+  - name: cri-dockerd
+    version: 0.3.9
+`,
+		},
+		{
+			name: "legacy resource without name",
+			data: `
+resources:
+  - version: 1.0.0
+`,
+			wantErr: "document 1: resource without name",
+		},
+		{
+			name: "duplicate in kind Resource",
+			data: `
+version: "1.0"
+kind: Resource
+resources:
+  - name: containerd
+    version: 1.7.0
+---
+version: "1.0"
+kind: Resource
+resources:
+  - name: containerd
+    version: 1.7.1
+`,
+			wantErr: `kind Resource: duplicate resource "containerd"`,
+		},
+		{
+			name: "same name in Download and Resource",
+			data: `
+version: "1.0"
+kind: Download
+resources:
+  - name: containerd
+---
+version: "1.0"
+kind: Resource
+resources:
+  - name: containerd
+`,
+		},
+		{
+			name: "legacy and kind Resource with the same name",
+			data: `
+resources:
+  - name: containerd
+---
+version: "1.0"
+kind: Resource
+resources:
+  - name: containerd
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseManifest() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseManifest() error = %v, want %q", err, tt.wantErr)
+			}
+			if strings.Contains(tt.name, "legacy") && strings.Contains(err.Error(), "kind ") {
+				t.Errorf("error for a kind-less document should not mention a kind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import "regexp"
+
+// 需要在日志和错误信息中隐藏的敏感内容
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`SWMTKN-[0-9A-Za-z-]+`),                   // swarm 加入令牌
+	regexp.MustCompile(`SWMKEY-[0-9A-Za-z+/=-]+`),                // swarm 解锁密钥
+	regexp.MustCompile(`(--token[ =])[0-9a-z]{6}\.[0-9a-z]{16}`), // kubeadm 引导令牌
+	regexp.MustCompile(`(--certificate-key[ =])[0-9a-f]+`),       // kubeadm 证书密钥
+	regexp.MustCompile(`\b[0-9a-z]{6}\.[0-9a-z]{16}\b`),          // 独立出现的引导令牌
+}
+
+// RedactSecrets 将字符串中的令牌、密钥替换为 <redacted>
+func RedactSecrets(s string) string {
+	for _, re := range secretPatterns {
+		if re.NumSubexp() > 0 {
+			s = re.ReplaceAllString(s, "${1}<redacted>")
+		} else {
+			s = re.ReplaceAllString(s, "<redacted>")
+		}
+	}
+	return s
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// progressMinSize 小于该大小的文件不显示传输进度
+const progressMinSize = 1 << 20
+
+// sftpClient 获取节点连接上的 SFTP 客户端，与命令执行共用连接池中的连接
+func (p *sshPool) sftpClient(node *types.RemoteNode) (*sftp.Client, error) {
+	key := sshPoolKey(node)
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		c, err := p.get(node)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if c.sftp == nil {
+			client, err := sftp.NewClient(c.client, sftp.UseConcurrentWrites(true))
+			if err != nil {
+				c.mu.Unlock()
+				// 连接失效时重连一次
+				p.drop(key, c)
+				lastErr = err
+				continue
+			}
+			c.sftp = client
+		}
+		client := c.sftp
+		c.mu.Unlock()
+		return client, nil
+	}
+	return nil, fmt.Errorf("failed to start SFTP session on %s: %v", nodeAddress(node), lastErr)
+}
+
+// sftpUpload 通过 SFTP 上传单个文件
+//
+// 先写入同目录下的临时文件再重命名，避免中断时留下不完整的目标文件；保留权限和修改时间。
+func sftpUpload(node *types.RemoteNode, localPath, remotePath string) error {
+	client, err := defaultSSHPool.sftpClient(node)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory %s: %w", path.Dir(remotePath), err)
+	}
+
+	tmpPath := remotePath + ".somcli-tmp"
+	dst, err := client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+
+	progress := newCopyProgress("📤 "+filepath.Base(localPath), info.Size())
+	_, err = io.Copy(dst, io.TeeReader(src, progress))
+	progress.finish()
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(tmpPath)
+		return fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+
+	if err := client.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		client.Remove(tmpPath)
+		return fmt.Errorf("failed to set mode of %s: %w", remotePath, err)
+	}
+	if err := client.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		PrintDebug("failed to preserve mtime of %s: %v", remotePath, err)
+	}
+
+	if err := client.PosixRename(tmpPath, remotePath); err != nil {
+		// 服务端不支持 posix-rename 扩展时先删除目标再重命名
+		client.Remove(remotePath)
+		if err := client.Rename(tmpPath, remotePath); err != nil {
+			client.Remove(tmpPath)
+			return fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+		}
+	}
+	return nil
+}
+
+// sftpDownload 通过 SFTP 下载单个文件，保留权限和修改时间
+func sftpDownload(node *types.RemoteNode, remotePath, localPath string) error {
+	client, err := defaultSSHPool.sftpClient(node)
+	if err != nil {
+		return err
+	}
+
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", remotePath, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", remotePath, err)
+	}
+
+	if err := CreateDir(filepath.Dir(localPath)); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+
+	progress := newCopyProgress("📥 "+path.Base(remotePath), info.Size())
+	_, err = io.Copy(io.MultiWriter(dst, progress), src)
+	progress.finish()
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+
+	if err := os.Chmod(localPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(localPath, info.ModTime(), info.ModTime())
+}
+
+// CopyDirToRemote 递归复制本地目录到远程节点，只上传内容有变化的文件
+//
+// 远程目录中各文件的 sha256 通过一次远程命令获取，与本地文件比较后决定是否上传。
+// 节点开启 become 时变化的文件先上传到临时目录，再以 root 身份合并到目标目录。
+func CopyDirToRemote(node *types.RemoteNode, localDir, remoteDir string) error {
+	remoteSums, err := remoteDirChecksums(node, remoteDir)
+	if err != nil {
+		return err
+	}
+
+	client, err := defaultSSHPool.sftpClient(node)
+	if err != nil {
+		return err
+	}
+
+	target := remoteDir
+	if node.UseBecome() {
+		target = path.Join(GetTmpDir(), fmt.Sprintf("somcli-%d-%s", time.Now().UnixNano(), path.Base(remoteDir)))
+	}
+
+	uploaded, skipped := 0, 0
+	err = filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		remotePath := path.Join(target, rel)
+
+		switch {
+		case info.IsDir():
+			if err := client.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("failed to create remote directory %s: %w", remotePath, err)
+			}
+			return client.Chmod(remotePath, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(localPath)
+			if err != nil {
+				return err
+			}
+			client.Remove(remotePath)
+			return client.Symlink(link, remotePath)
+		case !info.Mode().IsRegular():
+			PrintWarning("Skipping special file %s", localPath)
+			return nil
+		}
+
+		localSum, err := fileSHA256(localPath)
+		if err != nil {
+			return err
+		}
+		if sum, ok := remoteSums[rel]; ok && sum == localSum {
+			skipped++
+			return nil
+		}
+		uploaded++
+		return sftpUpload(node, localPath, remotePath)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s:%s: %w", localDir, nodeAddress(node), remoteDir, err)
+	}
+
+	if node.UseBecome() {
+		mergeCmd := fmt.Sprintf("mkdir -p %s && cp -a %s/. %s/; rc=$?; rm -rf %s; exit $rc",
+			ShellQuote(remoteDir), ShellQuote(target), ShellQuote(remoteDir), ShellQuote(target))
+		if _, err := RunCommandOnNode(node, mergeCmd); err != nil {
+			return fmt.Errorf("failed to install directory %s: %w", remoteDir, err)
+		}
+	}
+
+	PrintInfo("📦 已同步目录 %s 到 %s:%s（上传 %d 个文件，跳过 %d 个未变化文件）",
+		localDir, nodeAddress(node), remoteDir, uploaded, skipped)
+	return nil
+}
+
+// remoteDirChecksums 获取远程目录下所有文件的 sha256，键为相对路径
+func remoteDirChecksums(node *types.RemoteNode, remoteDir string) (map[string]string, error) {
+	listCmd := fmt.Sprintf("if [ -d %s ]; then cd %s && find . -type f -exec sha256sum {} +; fi",
+		ShellQuote(remoteDir), ShellQuote(remoteDir))
+	output, err := RunCommandOnNode(node, listCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote checksums: %w", err)
+	}
+
+	sums := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "./")] = fields[0]
+	}
+	return sums, nil
+}
+
+// fileSHA256 计算本地文件的 sha256
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyProgress 文件传输进度显示，小文件不显示
+type copyProgress struct {
+	label string
+	total int64
+	done  int64
+	last  time.Time
+}
+
+func newCopyProgress(label string, total int64) *copyProgress {
+	return &copyProgress{label: label, total: total}
+}
+
+func (p *copyProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if p.total >= progressMinSize && time.Since(p.last) >= 500*time.Millisecond {
+		p.last = time.Now()
+		p.print()
+	}
+	return len(b), nil
+}
+
+func (p *copyProgress) print() {
+	percent := int64(100)
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	fmt.Printf("\r%s %3d%% (%s/%s)", p.label, percent, formatBytes(p.done), formatBytes(p.total))
+}
+
+// finish 输出最终进度并换行
+func (p *copyProgress) finish() {
+	if p.total < progressMinSize {
+		return
+	}
+	p.print()
+	fmt.Println()
+}
+
+// formatBytes 以易读的单位显示字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -18,34 +18,21 @@ package utils
 import (
 	"bytes"
 	"fmt"
-	"net"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/structure-projects/somcli/pkg/types"
 	"golang.org/x/crypto/ssh"
 )
 
 // SSHExec 在远程主机上执行命令并返回输出
-func SSHExec(user, host, keyPath, command string) ([]byte, error) {
-	config, err := getSSHConfig(user, keyPath)
+func SSHExec(node *types.RemoteNode, command string) ([]byte, error) {
+	// 从连接池获取会话
+	session, err := defaultSSHPool.newSession(node)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH config: %v", err)
-	}
-
-	// 建立SSH连接
-	client, err := ssh.Dial("tcp", net.JoinHostPort(host, "22"), config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial SSH server: %v", err)
-	}
-	defer client.Close()
-
-	// 创建会话
-	session, err := client.NewSession()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH session: %v", err)
+		return nil, err
 	}
 	defer session.Close()
 
@@ -64,21 +51,10 @@ func SSHExec(user, host, keyPath, command string) ([]byte, error) {
 }
 
 // SSHExecWithOutput 执行命令并实时输出结果
-func SSHExecWithOutput(user, host, keyPath, command string) error {
-	config, err := getSSHConfig(user, keyPath)
-	if err != nil {
-		return fmt.Errorf("failed to create SSH config: %v", err)
-	}
-
-	client, err := ssh.Dial("tcp", net.JoinHostPort(host, "22"), config)
-	if err != nil {
-		return fmt.Errorf("failed to dial SSH server: %v", err)
-	}
-	defer client.Close()
-
-	session, err := client.NewSession()
+func SSHExecWithOutput(node *types.RemoteNode, command string) error {
+	session, err := defaultSSHPool.newSession(node)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %v", err)
+		return err
 	}
 	defer session.Close()
 
@@ -89,100 +65,84 @@ func SSHExecWithOutput(user, host, keyPath, command string) error {
 	return session.Run(command)
 }
 
-// getSSHConfig 创建SSH客户端配置
-func getSSHConfig(user, keyPath string) (*ssh.ClientConfig, error) {
-	// 读取私钥文件
-	key, err := os.ReadFile(keyPath)
+// SSHClient 创建SSH客户端连接（不经过连接池，调用方负责关闭）
+func SSHClient(node *types.RemoteNode) (*ssh.Client, error) {
+	config, err := getSSHConfig(node)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read private key: %v", err)
+		return nil, err
 	}
 
-	// 解析私钥
-	signer, err := ssh.ParsePrivateKey(key)
+	client, jumps, err := dialNode(node, config)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse private key: %v", err)
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	if len(jumps) > 0 {
+		// 目标连接关闭后释放跳板机连接
+		go func() {
+			client.Wait()
+			closeSSHClients(jumps)
+		}()
 	}
 
-	return &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
-	}, nil
+	return client, nil
 }
 
-// SSHClient 创建SSH客户端连接
-func SSHClient(user, host, keyPath string) (*ssh.Client, error) {
-	key, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read private key: %w", err)
-	}
+// CopyToRemote 通过 SFTP 复制本地文件或目录到远程主机
+//
+// 远程文件与本地文件校验和一致时跳过上传；目录递归复制，只上传有变化的文件。
+func CopyToRemote(node *types.RemoteNode, localPath, remotePath string) error {
+	ip := nodeAddress(node)
 
-	signer, err := ssh.ParsePrivateKey(key)
+	info, err := os.Stat(localPath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse private key: %w", err)
+		return fmt.Errorf("failed to stat %s: %w", localPath, err)
 	}
-
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	if info.IsDir() {
+		return CopyDirToRemote(node, localPath, remotePath)
 	}
 
-	client, err := ssh.Dial("tcp", host+":22", config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial: %w", err)
-	}
-
-	return client, nil
-}
-
-func CopyToRemote(user, ip, keyPath, localPath, remotePath string) error {
 	// 检查文件是否存在
-	exists, err := RemoteFileExists(user, ip, keyPath, remotePath)
+	exists, err := RemoteFileExists(node, remotePath)
 	if err != nil {
 		return fmt.Errorf("检查远程文件失败: %w", err)
 	}
 	if exists {
 		// 验证远程文件和本地文件一致性
-		PrintInfo("检查本地文件和远程文件hash值是否一致------------------------>")
-		remoteChecksum, err := GetRemoteFileChecksum(user, ip, keyPath, remotePath)
+		PrintDebug("检查本地文件和远程文件hash值是否一致: %s", remotePath)
+		remoteChecksum, err := GetRemoteFileChecksum(node, remotePath)
 		if err == nil {
 			if err := VerifyChecksum(localPath, remoteChecksum); err == nil {
 				PrintWarning("ℹ️ 文件已存在于 %s:%s，跳过复制\n", ip, remotePath)
 				return nil
 			}
 		}
-	} else {
-		// 创建远程目录（路径用单引号包裹）
-		SSHMkdir(user, ip, keyPath, filepath.Dir(remotePath))
 	}
 
-	// 执行 SCP（添加超时和详细日志）
-	scpCmd := exec.Command("scp",
-		"-i", keyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "ConnectTimeout=30",
-		localPath,
-		fmt.Sprintf("%s@%s:'%s'", user, ip, remotePath)) // 远程路径加单引号
+	// 开启 become 时经临时路径以 root 身份安装到目标路径
+	if node.UseBecome() {
+		err = becomeInstall(node, localPath, remotePath)
+	} else {
+		err = sftpUpload(node, localPath, remotePath)
+	}
+	if err != nil {
+		return err
+	}
 
-	PrintDebug("执行 SCP 命令: %s", scpCmd)
-	scpCmd.Stdout = os.Stdout
-	scpCmd.Stderr = os.Stderr
+	PrintInfo("📤 已复制 %s 到 %s:%s\n", localPath, ip, remotePath)
+	return nil
+}
 
-	if err := scpCmd.Run(); err != nil {
-		return fmt.Errorf("SCP 传输失败: %w (命令: %s)", err, scpCmd)
+// CopyFromRemote 通过 SFTP 从远程主机复制文件到本地
+func CopyFromRemote(node *types.RemoteNode, remotePath, localPath string) error {
+	if err := sftpDownload(node, remotePath, localPath); err != nil {
+		return err
 	}
 
-	PrintInfo("📤 已复制 %s 到 %s:%s\n", localPath, ip, remotePath)
+	PrintInfo("📥 已复制 %s:%s 到 %s\n", nodeAddress(node), remotePath, localPath)
 	return nil
 }
 
-func SSHMkdir(user, ip, keyPath, remotePath string, mode ...string) error {
+func SSHMkdir(node *types.RemoteNode, remotePath string, mode ...string) error {
 	// 安全处理路径中的特殊字符（如空格、$等）
 	safePath := fmt.Sprintf("'%s'", strings.ReplaceAll(remotePath, "'", "'\\''"))
 
@@ -194,7 +154,7 @@ func SSHMkdir(user, ip, keyPath, remotePath string, mode ...string) error {
 		cmd += fmt.Sprintf(" && chmod %s %s", mode[0], safePath)
 	}
 
-	_, err := SSHMCmd(user, ip, keyPath, cmd)
+	_, err := SSHMCmd(node, cmd)
 
 	if err != nil {
 		return fmt.Errorf("SSH目录创建失败: %w", err)
@@ -203,26 +163,22 @@ func SSHMkdir(user, ip, keyPath, remotePath string, mode ...string) error {
 	return nil
 }
 
-// 执行远程命令
-func SSHMCmd(user, ip, keyPath, cmd string) (string, error) {
-
-	// 构建 SSH 命令
-	sshArgs := []string{
-		"-i", keyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "ConnectTimeout=30",
-		fmt.Sprintf("%s@%s", user, ip),
-		cmd,
-	}
+// 执行远程命令（复用连接池中的连接）
+func SSHMCmd(node *types.RemoteNode, cmd string) (string, error) {
+	return sshMCmdWithInput(node, cmd, "")
+}
 
-	sshCmd := exec.Command("ssh", sshArgs...)
-	PrintDebug("sshCmd -> %s", sshCmd)
-	output, err := sshCmd.CombinedOutput()
+// sshMCmdWithInput 执行远程命令并写入标准输入
+func sshMCmdWithInput(node *types.RemoteNode, cmd, input string) (string, error) {
+	PrintDebug("ssh %s:%d -> %s", SSHTarget(node), nodePort(node), RedactSecrets(cmd))
+	start := time.Now()
+	output, err := sshPoolRun(node, cmd, input)
+	auditExec(auditNodeName(node), cmd, string(output), exitCode(err), time.Since(start), err)
 
 	if err != nil {
-		return string(output), fmt.Errorf("SSH执行失败远程主机:%s 远程命令: %w\n命令: %s\n输出: %s", ip,
+		return string(output), fmt.Errorf("SSH执行失败远程主机:%s 远程命令: %w\n命令: %s\n输出: %s", nodeAddress(node),
 			err,
-			sshCmd.String(),
+			cmd,
 			string(output))
 	}
 
@@ -230,9 +186,9 @@ func SSHMCmd(user, ip, keyPath, cmd string) (string, error) {
 }
 
 // remoteFileExists 检查远程文件是否存在
-func RemoteFileExists(user, ip, keyPath, remotePath string) (bool, error) {
-	checkCmd := fmt.Sprintf("test -f %s && echo exists || echo not_exists", remotePath)
-	output, err := SSHMCmd(user, ip, keyPath, checkCmd)
+func RemoteFileExists(node *types.RemoteNode, remotePath string) (bool, error) {
+	checkCmd := fmt.Sprintf("test -f %s && echo exists || echo not_exists", ShellQuote(remotePath))
+	output, err := SSHMCmd(node, checkCmd)
 
 	if err != nil {
 		return false, fmt.Errorf("failed to check remote file: %v", err)
@@ -242,7 +198,7 @@ func RemoteFileExists(user, ip, keyPath, remotePath string) (bool, error) {
 }
 
 // RsyncCopy 兼容低版本的rsync实现
-func RsyncCopy(keyPath, localPath, user, ip, remotePath string) error {
+func RsyncCopy(node *types.RemoteNode, localPath, remotePath string) error {
 	// 基础参数（兼容大多数rsync版本）
 	args := []string{
 		"-rlpt",      // 等效于 -a 但不保留设备和特殊文件
@@ -259,15 +215,21 @@ func RsyncCopy(keyPath, localPath, user, ip, remotePath string) error {
 		args = append(args, "-c") // 旧版本的校验和选项
 	}
 
-	// SSH配置（保持与SCP相同的安全设置）
-	sshOpts := fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no", keyPath)
-	args = append(args, "--rsh="+sshOpts)
+	// SSH配置（保持与SCP相同的连接参数；密码由外层 sshpass 提供）
+	args = append(args, "--rsh="+SSHShellCommand(&types.RemoteNode{
+		SSHKey:    node.SSHKey,
+		Port:      node.Port,
+		ProxyJump: node.ProxyJump,
+	}, "ssh"))
 
 	// 添加路径参数
 	args = append(args, localPath)
-	args = append(args, fmt.Sprintf("%s@%s:%s", user, ip, remotePath))
+	args = append(args, fmt.Sprintf("%s:%s", SSHTarget(node), remotePath))
 
-	rsyncCmd := exec.Command("rsync", args...)
+	rsyncCmd, err := sshCommand(node, "rsync", args...)
+	if err != nil {
+		return err
+	}
 	rsyncCmd.Stdout = os.Stdout
 	rsyncCmd.Stderr = os.Stderr
 
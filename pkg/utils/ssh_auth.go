@@ -0,0 +1,448 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/structure-projects/somcli/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const defaultSSHPort = 22
+
+var (
+	sshAgentOnce   sync.Once
+	sshAgentClient agent.ExtendedAgent
+	sshAgentErr    error
+)
+
+// ApplySSHDefaults 为节点填充未设置的 SSH 连接参数，并标记本机节点
+func ApplySSHDefaults(nodes []types.RemoteNode, defaults types.SSHDefaults) {
+	for i := range nodes {
+		node := &nodes[i]
+		if node.User == "" {
+			node.User = defaults.User
+		}
+		if node.Port == 0 {
+			node.Port = defaults.Port
+		}
+		if node.SSHKey == "" {
+			node.SSHKey = defaults.SSHKey
+		}
+		if node.SSHKeyPassphrase == "" && node.SSHKeyPassphraseRef == "" {
+			node.SSHKeyPassphrase = defaults.SSHKeyPassphrase
+			node.SSHKeyPassphraseRef = defaults.SSHKeyPassphraseRef
+		}
+		if node.Password == "" && node.PasswordRef == "" {
+			node.Password = defaults.Password
+			node.PasswordRef = defaults.PasswordRef
+		}
+		if node.Agent == nil {
+			node.Agent = defaults.Agent
+		}
+		if node.ProxyJump == "" {
+			node.ProxyJump = defaults.ProxyJump
+		}
+		if node.Become == nil {
+			node.Become = defaults.Become
+		}
+		if node.BecomeMethod == "" {
+			node.BecomeMethod = defaults.BecomeMethod
+		}
+		if node.BecomePassword == "" && node.BecomePasswordRef == "" {
+			node.BecomePassword = defaults.BecomePassword
+			node.BecomePasswordRef = defaults.BecomePasswordRef
+		}
+		IsLocalNode(node)
+	}
+}
+
+// nodeAddress 节点连接地址，未设置 IP 时使用主机名
+func nodeAddress(node *types.RemoteNode) string {
+	if node.IP != "" {
+		return node.IP
+	}
+	return node.Host
+}
+
+// nodePort 节点 SSH 端口
+func nodePort(node *types.RemoteNode) int {
+	if node.Port > 0 {
+		return node.Port
+	}
+	return defaultSSHPort
+}
+
+// nodeEndpoint 节点 SSH 地址 host:port
+func nodeEndpoint(node *types.RemoteNode) string {
+	return net.JoinHostPort(nodeAddress(node), strconv.Itoa(nodePort(node)))
+}
+
+// resolveSecret 返回明文值，未设置时解析引用（env:NAME 或 file:/path）
+func resolveSecret(value, ref string) (string, error) {
+	if value != "" || ref == "" {
+		return value, nil
+	}
+
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(ExpandPath(strings.TrimPrefix(ref, "file:")))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("unsupported secret reference %q (expected env:NAME or file:/path)", ref)
+	}
+}
+
+// nodePassword 节点登录密码
+func nodePassword(node *types.RemoteNode) (string, error) {
+	password, err := resolveSecret(node.Password, node.PasswordRef)
+	if err != nil {
+		return "", fmt.Errorf("node %s password: %w", node.Host, err)
+	}
+	return password, nil
+}
+
+// loadPrivateKey 加载私钥，带密码的私钥使用节点配置的私钥密码解密
+func loadPrivateKey(node *types.RemoteNode, keyPath string) (ssh.Signer, error) {
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse private key: %v", err)
+		}
+		return signer, nil
+	}
+
+	passphrase, err := resolveSecret(node.SSHKeyPassphrase, node.SSHKeyPassphraseRef)
+	if err != nil {
+		return nil, fmt.Errorf("private key %s passphrase: %w", keyPath, err)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("private key %s is passphrase protected, set sshKeyPassphrase/sshKeyPassphraseRef or use agent", keyPath)
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt private key %s: %v", keyPath, err)
+	}
+	return signer, nil
+}
+
+// sshAgentSigners 从 ssh-agent 获取签名密钥，进程内共享一个 agent 连接
+func sshAgentSigners() ([]ssh.Signer, error) {
+	sshAgentOnce.Do(func() {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			sshAgentErr = errors.New("SSH_AUTH_SOCK is not set")
+			return
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			sshAgentErr = fmt.Errorf("failed to connect to ssh-agent: %w", err)
+			return
+		}
+		sshAgentClient = agent.NewClient(conn)
+	})
+	if sshAgentErr != nil {
+		return nil, sshAgentErr
+	}
+	return sshAgentClient.Signers()
+}
+
+// nodeAuthMethods 按节点配置生成认证方式：私钥、ssh-agent、密码
+//
+// 节点未配置任何认证方式时，依次尝试 ssh-agent 和 ~/.ssh 下的默认私钥。
+func nodeAuthMethods(node *types.RemoteNode) ([]ssh.AuthMethod, error) {
+	password, err := nodePassword(node)
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []ssh.Signer
+	keyPath := ExpandPath(node.SSHKey)
+	if keyPath != "" {
+		signer, err := loadPrivateKey(node, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	unconfigured := keyPath == "" && password == "" && !node.UseAgent()
+	if node.UseAgent() || unconfigured {
+		agentSigners, err := sshAgentSigners()
+		if err != nil && node.UseAgent() {
+			return nil, err
+		}
+		signers = append(signers, agentSigners...)
+	}
+	if unconfigured {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			path := filepath.Join(GetHomeDir(), ".ssh", name)
+			if !FileExists(path) {
+				continue
+			}
+			if signer, err := loadPrivateKey(node, path); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+
+	var methods []ssh.AuthMethod
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if password != "" {
+		methods = append(methods,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no SSH authentication method available for node %s", nodeAddress(node))
+	}
+	return methods, nil
+}
+
+// getSSHConfig 创建SSH客户端配置
+func getSSHConfig(node *types.RemoteNode) (*ssh.ClientConfig, error) {
+	auth, err := nodeAuthMethods(node)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCheck, err := hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:              node.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCheck,
+		HostKeyAlgorithms: knownHostKeyAlgorithms(nodeEndpoint(node)),
+		Timeout:           30 * time.Second,
+	}, nil
+}
+
+// proxyJumpHops 解析节点的跳板机列表
+//
+// 跳板机在节点清单中存在时使用清单中的连接参数，否则沿用目标节点的认证方式。
+func proxyJumpHops(node *types.RemoteNode) ([]*types.RemoteNode, error) {
+	if node.ProxyJump == "" {
+		return nil, nil
+	}
+
+	var hops []*types.RemoteNode
+	for _, spec := range strings.Split(node.ProxyJump, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		user, hostPort := "", spec
+		if at := strings.LastIndex(spec, "@"); at >= 0 {
+			user, hostPort = spec[:at], spec[at+1:]
+		}
+		host, port := hostPort, 0
+		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxyJump port in %q", spec)
+			}
+			host, port = h, n
+		}
+
+		hop := *node
+		hop.Host, hop.IP, hop.Port = host, host, defaultSSHPort
+		for _, known := range Config.Nodes {
+			if known.Host == host || known.IP == host {
+				hop = known
+				break
+			}
+		}
+		hop.ProxyJump = ""
+		if user != "" {
+			hop.User = user
+		}
+		if port != 0 {
+			hop.Port = port
+		}
+		hops = append(hops, &hop)
+	}
+	return hops, nil
+}
+
+// dialNode 建立到节点的 SSH 连接，配置了跳板机时经跳板机转发
+//
+// 返回目标连接和途经的跳板机连接，关闭目标连接后需一并关闭跳板机连接。
+func dialNode(node *types.RemoteNode, config *ssh.ClientConfig) (*ssh.Client, []*ssh.Client, error) {
+	hops, err := proxyJumpHops(node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var jumps []*ssh.Client
+	var via *ssh.Client
+	for _, hop := range hops {
+		hopConfig, err := getSSHConfig(hop)
+		if err != nil {
+			closeSSHClients(jumps)
+			return nil, nil, fmt.Errorf("proxy jump %s: %w", nodeEndpoint(hop), err)
+		}
+		client, err := dialVia(via, nodeEndpoint(hop), hopConfig)
+		if err != nil {
+			closeSSHClients(jumps)
+			return nil, nil, fmt.Errorf("proxy jump %s: %w", nodeEndpoint(hop), err)
+		}
+		jumps = append(jumps, client)
+		via = client
+	}
+
+	client, err := dialVia(via, nodeEndpoint(node), config)
+	if err != nil {
+		closeSSHClients(jumps)
+		return nil, nil, err
+	}
+	return client, jumps, nil
+}
+
+// dialVia 直接或经已有连接转发建立 SSH 连接
+func dialVia(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// closeSSHClients 按建立的逆序关闭连接
+func closeSSHClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// SSHArgs 调用 ssh/scp/rsync 时的连接参数（不含目标地址）
+func SSHArgs(node *types.RemoteNode) []string {
+	var args []string
+	if keyPath := ExpandPath(node.SSHKey); keyPath != "" {
+		args = append(args, "-i", keyPath)
+	}
+	args = append(args, "-o", "Port="+strconv.Itoa(nodePort(node)))
+	if hops, err := proxyJumpHops(node); err == nil && len(hops) > 0 {
+		// 跳板机名称按节点清单解析为实际地址
+		jumps := make([]string, 0, len(hops))
+		for _, hop := range hops {
+			jumps = append(jumps, fmt.Sprintf("%s:%d", SSHTarget(hop), nodePort(hop)))
+		}
+		args = append(args, "-o", "ProxyJump="+strings.Join(jumps, ","))
+	} else if node.ProxyJump != "" {
+		args = append(args, "-o", "ProxyJump="+node.ProxyJump)
+	}
+	args = append(args, SSHHostKeyArgs()...)
+	return append(args, "-o", "ConnectTimeout=30")
+}
+
+// SSHTarget ssh 命令的目标 user@host
+func SSHTarget(node *types.RemoteNode) string {
+	if node.User == "" {
+		return nodeAddress(node)
+	}
+	return node.User + "@" + nodeAddress(node)
+}
+
+// SSHShellCommand 拼接到 shell 命令中的 ssh/scp 前缀，使用密码认证时通过 sshpass 传递密码
+func SSHShellCommand(node *types.RemoteNode, program string) string {
+	parts := []string{program}
+	for _, arg := range SSHArgs(node) {
+		parts = append(parts, ShellQuote(arg))
+	}
+	if password, _ := nodePassword(node); password != "" {
+		parts = append([]string{"sshpass", "-e"}, parts...)
+	}
+	return strings.Join(parts, " ")
+}
+
+// SSHCommandEnv 执行 ssh 相关命令时的环境变量，密码通过 SSHPASS 传给 sshpass
+func SSHCommandEnv(node *types.RemoteNode) ([]string, error) {
+	password, err := nodePassword(node)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("sshpass"); err != nil {
+		return nil, fmt.Errorf("password authentication for %s requires sshpass", nodeAddress(node))
+	}
+	return append(os.Environ(), "SSHPASS="+password), nil
+}
+
+// sshCommand 构造 ssh/scp/rsync 命令，参数中不含 ssh 连接参数
+func sshCommand(node *types.RemoteNode, name string, args ...string) (*exec.Cmd, error) {
+	env, err := SSHCommandEnv(node)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return exec.Command(name, args...), nil
+	}
+
+	cmd := exec.Command("sshpass", append([]string{"-e", name}, args...)...)
+	cmd.Env = env
+	return cmd, nil
+}
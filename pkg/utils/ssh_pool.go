@@ -0,0 +1,240 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/structure-projects/somcli/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshKeepAliveInterval  = 30 * time.Second
+	sshKeepAliveMaxMissed = 3
+	sshSessionRetries     = 5
+)
+
+// sshPool 按节点复用 SSH 连接，每个节点保持一个 *ssh.Client，命令在其上以独立会话执行
+type sshPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+	closed  bool
+}
+
+// pooledClient 连接池中的连接
+type pooledClient struct {
+	client *ssh.Client
+	jumps  []*ssh.Client // 经过的跳板机连接
+	stop   chan struct{}
+	once   sync.Once
+
+	mu   sync.Mutex
+	sftp *sftp.Client // 按需创建的 SFTP 会话
+}
+
+var defaultSSHPool = &sshPool{clients: make(map[string]*pooledClient)}
+
+// close 关闭连接并停止保活
+func (c *pooledClient) close() {
+	c.once.Do(func() {
+		close(c.stop)
+		c.mu.Lock()
+		if c.sftp != nil {
+			c.sftp.Close()
+		}
+		c.mu.Unlock()
+		c.client.Close()
+		closeSSHClients(c.jumps)
+	})
+}
+
+// sshPoolKey 连接池键
+func sshPoolKey(node *types.RemoteNode) string {
+	key := node.User + "@" + nodeEndpoint(node)
+	if node.ProxyJump != "" {
+		key += " via " + node.ProxyJump
+	}
+	return key
+}
+
+// get 获取节点连接，不存在时建立新连接
+func (p *sshPool) get(node *types.RemoteNode) (*pooledClient, error) {
+	key := sshPoolKey(node)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errors.New("ssh connection pool is closed")
+	}
+	if c, ok := p.clients[key]; ok {
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	// 握手期间不持有锁，避免多个节点的连接互相阻塞
+	config, err := getSSHConfig(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH config: %v", err)
+	}
+	client, jumps, err := dialNode(node, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial SSH server: %v", err)
+	}
+	PrintDebug("ssh pool: connected %s", key)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := &pooledClient{client: client, jumps: jumps, stop: make(chan struct{})}
+	if p.closed {
+		c.close()
+		return nil, errors.New("ssh connection pool is closed")
+	}
+	// 并发建立连接时保留先完成的一个
+	if existing, ok := p.clients[key]; ok {
+		c.close()
+		return existing, nil
+	}
+
+	p.clients[key] = c
+	go p.keepAlive(key, c)
+	return c, nil
+}
+
+// drop 从连接池移除并关闭连接
+func (p *sshPool) drop(key string, c *pooledClient) {
+	p.mu.Lock()
+	if p.clients[key] == c {
+		delete(p.clients, key)
+	}
+	p.mu.Unlock()
+	c.close()
+}
+
+// keepAlive 定期发送保活请求，连续多次无响应时移除连接，下次使用时重连
+func (p *sshPool) keepAlive(key string, c *pooledClient) {
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case <-c.stop:
+			return
+		case err := <-reply:
+			if err != nil {
+				PrintDebug("ssh pool: keepalive to %s failed: %v", key, err)
+				p.drop(key, c)
+				return
+			}
+			missed = 0
+		case <-time.After(sshKeepAliveInterval):
+			missed++
+			if missed >= sshKeepAliveMaxMissed {
+				PrintDebug("ssh pool: %s missed %d keepalives, closing", key, missed)
+				p.drop(key, c)
+				return
+			}
+		}
+	}
+}
+
+// newSession 在节点连接上创建会话，连接失效时重连一次
+func (p *sshPool) newSession(node *types.RemoteNode) (*ssh.Session, error) {
+	key := sshPoolKey(node)
+	reconnected := false
+
+	for attempt := 0; ; attempt++ {
+		c, err := p.get(node)
+		if err != nil {
+			return nil, err
+		}
+
+		session, err := c.client.NewSession()
+		if err == nil {
+			return session, nil
+		}
+
+		// 服务端拒绝打开通道（如超过 MaxSessions）时连接仍然可用，稍后重试
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			if attempt >= sshSessionRetries {
+				return nil, fmt.Errorf("failed to create SSH session: %v", err)
+			}
+			time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+			continue
+		}
+
+		p.drop(key, c)
+		if reconnected {
+			return nil, fmt.Errorf("failed to create SSH session: %v", err)
+		}
+		PrintDebug("ssh pool: connection to %s broken (%v), reconnecting", key, err)
+		reconnected = true
+	}
+}
+
+// closeAll 关闭所有连接，之后的请求将返回错误
+func (p *sshPool) closeAll() {
+	p.mu.Lock()
+	clients := p.clients
+	p.clients = make(map[string]*pooledClient)
+	p.closed = true
+	p.mu.Unlock()
+
+	for key, c := range clients {
+		c.close()
+		PrintDebug("ssh pool: closed %s", key)
+	}
+}
+
+// CloseSSHPool 关闭 SSH 连接池中的所有连接，程序退出前调用
+func CloseSSHPool() {
+	defaultSSHPool.closeAll()
+}
+
+// sshPoolRun 通过连接池在远程主机上执行命令，返回合并的标准输出和标准错误
+func sshPoolRun(node *types.RemoteNode, command, input string) ([]byte, error) {
+	session, err := defaultSSHPool.newSession(node)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	if input != "" {
+		session.Stdin = strings.NewReader(input)
+	}
+
+	return session.CombinedOutput(command)
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/structure-projects/somcli/pkg/sshtest"
+	"github.com/structure-projects/somcli/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestServer 启动 sshtest 服务端，并使用只信任该服务端主机密钥的 known_hosts
+func newTestServer(t *testing.T, opts sshtest.Options) (*sshtest.Server, *types.RemoteNode) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	srv, err := sshtest.NewServer(opts)
+	if err != nil {
+		t.Fatalf("start ssh server: %v", err)
+	}
+	knownHosts, err := srv.KnownHostsFile()
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	previous := map[string]interface{}{}
+	for key, value := range map[string]interface{}{
+		"known_hosts":       knownHosts,
+		"host_key_checking": HostKeyStrict,
+		"workdir":           t.TempDir(),
+	} {
+		previous[key] = viper.Get(key)
+		viper.Set(key, value)
+	}
+	t.Cleanup(func() {
+		srv.Close()
+		for key, value := range previous {
+			viper.Set(key, value)
+		}
+	})
+
+	node := srv.Node()
+	return srv, &node
+}
+
+// writeTestFile 写入本地临时文件
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSSHExec(t *testing.T) {
+	_, node := newTestServer(t, sshtest.Options{})
+
+	output, err := SSHExec(node, "echo hello; echo ignored >&2")
+	if err != nil {
+		t.Fatalf("SSHExec() error = %v", err)
+	}
+	if string(output) != "hello\n" {
+		t.Errorf("SSHExec() = %q, want %q", output, "hello\n")
+	}
+
+	_, err = SSHExec(node, "echo boom >&2; exit 3")
+	if err == nil {
+		t.Fatal("SSHExec() should fail on non-zero exit code")
+	}
+	if !strings.Contains(err.Error(), "boom") {
+		t.Errorf("SSHExec() error should contain stderr, got %v", err)
+	}
+}
+
+func TestSSHMCmd(t *testing.T) {
+	srv, node := newTestServer(t, sshtest.Options{})
+
+	output, err := SSHMCmd(node, "pwd; echo warn >&2")
+	if err != nil {
+		t.Fatalf("SSHMCmd() error = %v", err)
+	}
+	if !strings.Contains(output, srv.Dir) || !strings.Contains(output, "warn") {
+		t.Errorf("SSHMCmd() = %q, want working dir and stderr", output)
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		exitCode int
+	}{
+		{name: "exit 1", command: "false", exitCode: 1},
+		{name: "exit 42", command: "echo partial; exit 42", exitCode: 42},
+		{name: "command not found", command: "somcli-no-such-command", exitCode: 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SSHMCmd(node, tt.command)
+			var exitErr *ssh.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("SSHMCmd() error = %v, want *ssh.ExitError", err)
+			}
+			if exitErr.ExitStatus() != tt.exitCode {
+				t.Errorf("exit code = %d, want %d", exitErr.ExitStatus(), tt.exitCode)
+			}
+		})
+	}
+}
+
+func TestSSHAuthFailure(t *testing.T) {
+	srv, node := newTestServer(t, sshtest.Options{Password: "secret", DisableKeyAuth: true})
+
+	node.Password = "wrong"
+	if _, err := SSHMCmd(node, "true"); err == nil {
+		t.Fatal("SSHMCmd() should fail with a wrong password")
+	}
+	if _, err := SSHExec(node, "true"); err == nil {
+		t.Fatal("SSHExec() should fail with a wrong password")
+	}
+	if commands := srv.Commands(); len(commands) != 0 {
+		t.Errorf("no command should reach the server, got %q", commands)
+	}
+
+	node.Password = "secret"
+	if _, err := SSHMCmd(node, "true"); err != nil {
+		t.Fatalf("SSHMCmd() with the right password error = %v", err)
+	}
+}
+
+func TestSSHUnknownHostKey(t *testing.T) {
+	newTestServer(t, sshtest.Options{})
+
+	// known_hosts 中只有 newTestServer 启动的服务端，strict 模式下拒绝连接其他主机
+	other, err := sshtest.NewServer(sshtest.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	node := other.Node()
+	if _, err := SSHMCmd(&node, "true"); err == nil {
+		t.Fatal("SSHMCmd() should fail for a host missing from known_hosts in strict mode")
+	}
+	if commands := other.Commands(); len(commands) != 0 {
+		t.Errorf("no command should reach the server, got %q", commands)
+	}
+}
+
+func TestRemoteFileExists(t *testing.T) {
+	srv, node := newTestServer(t, sshtest.Options{})
+	for _, name := range []string{"present.txt", "with space.txt"} {
+		if err := os.WriteFile(srv.Path(name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: srv.Path("present.txt"), want: true},
+		{path: srv.Path("with space.txt"), want: true},
+		{path: srv.Path("missing.txt"), want: false},
+		{path: srv.Path("missing.txt") + " || true", want: false},
+		{path: srv.Dir, want: false},
+	}
+	for _, tt := range tests {
+		got, err := RemoteFileExists(node, tt.path)
+		if err != nil {
+			t.Fatalf("RemoteFileExists(%s) error = %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("RemoteFileExists(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGetRemoteFileChecksum(t *testing.T) {
+	srv, node := newTestServer(t, sshtest.Options{})
+	content := "checksum me\n"
+	if err := os.WriteFile(srv.Path("file with space.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	got, err := GetRemoteFileChecksum(node, srv.Path("file with space.txt"))
+	if err != nil {
+		t.Fatalf("GetRemoteFileChecksum() error = %v", err)
+	}
+	if got != hex.EncodeToString(sum[:]) {
+		t.Errorf("GetRemoteFileChecksum() = %s, want %s", got, hex.EncodeToString(sum[:]))
+	}
+
+	if _, err := GetRemoteFileChecksum(node, srv.Path("missing.txt")); err == nil {
+		t.Error("GetRemoteFileChecksum() should fail for a missing file")
+	}
+	if _, err := GetRemoteFileChecksum(node, srv.Path("file with space.txt"), "crc32"); err == nil {
+		t.Error("GetRemoteFileChecksum() should reject unsupported algorithms")
+	}
+}
+
+func TestCopyToRemote(t *testing.T) {
+	srv, node := newTestServer(t, sshtest.Options{})
+	target := srv.Path("copied.txt")
+
+	local := writeTestFile(t, "local.txt", "version 1\n")
+	if err := CopyToRemote(node, local, target); err != nil {
+		t.Fatalf("CopyToRemote() error = %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "version 1\n" {
+		t.Fatalf("remote content = %q, %v", data, err)
+	}
+
+	// 内容变化时覆盖远程文件
+	if err := os.WriteFile(local, []byte("version 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyToRemote(node, local, target); err != nil {
+		t.Fatalf("CopyToRemote() error = %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "version 2\n" {
+		t.Errorf("remote content = %q, %v", data, err)
+	}
+
+	if err := CopyToRemote(node, filepath.Join(t.TempDir(), "missing"), target); err == nil {
+		t.Error("CopyToRemote() should fail for a missing local file")
+	}
+}
+
+func TestRunScripts(t *testing.T) {
+	srv, node := newTestServer(t, sshtest.Options{})
+	previousNodes := Config.Nodes
+	Config.Nodes = []types.RemoteNode{*node}
+	t.Cleanup(func() { Config.Nodes = previousNodes })
+	res := types.Resource{Name: "demo", Version: "1.0.0", Hosts: []string{node.Host}}
+
+	t.Run("ok", func(t *testing.T) {
+		scripts := types.NewScripts("echo {{ .Name }}-{{ .Version }} > result.txt")
+		if err := RunScripts(scripts, res); err != nil {
+			t.Fatalf("RunScripts() error = %v", err)
+		}
+		if data, err := os.ReadFile(srv.Path("result.txt")); err != nil || string(data) != "demo-1.0.0\n" {
+			t.Errorf("result.txt = %q, %v", data, err)
+		}
+	})
+
+	t.Run("non-zero exit", func(t *testing.T) {
+		scripts := types.NewScripts("exit 4", "touch not-reached.txt")
+		err := RunScripts(scripts, res)
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) {
+			t.Fatalf("RunScripts() error = %v, want *ScriptError", err)
+		}
+		if scriptErr.ExitCode != 4 || scriptErr.Host != node.Host {
+			t.Errorf("ScriptError = %+v, want exit code 4 on %s", scriptErr, node.Host)
+		}
+		if FileExists(srv.Path("not-reached.txt")) {
+			t.Error("scripts after a failure should not run")
+		}
+	})
+
+	t.Run("ignore errors", func(t *testing.T) {
+		scripts := []types.Script{{Run: "exit 1", IgnoreErrors: true}, {Run: "touch after-ignored.txt"}}
+		if err := RunScripts(scripts, res); err != nil {
+			t.Fatalf("RunScripts() error = %v", err)
+		}
+		if !FileExists(srv.Path("after-ignored.txt")) {
+			t.Error("scripts after an ignored failure should run")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		scripts := []types.Script{{Run: "sleep 30", Timeout: 200 * time.Millisecond}}
+		start := time.Now()
+		err := RunScripts(scripts, res)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("RunScripts() error = %v, want deadline exceeded", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("timed out command took %s to stop", elapsed)
+		}
+	})
+}
+
+// processAlive 进程存在且不是僵尸进程
+func processAlive(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestStreamTimeoutKillsProcessGroup(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid not available")
+	}
+	// 与没有 pty 的 sshd 一样，会话关闭和 signal 请求都不会终止命令的子进程
+	dir := t.TempDir()
+	_, node := newTestServer(t, sshtest.Options{
+		Handler: func(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Dir = dir
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+			if err := cmd.Run(); err != nil {
+				return 1
+			}
+			return 0
+		},
+	})
+
+	_, err := StreamCommandOnNode(context.Background(), node, "sleep 30 & echo $! > child.pid; wait",
+		StreamOptions{Timeout: 500 * time.Millisecond, Stdout: io.Discard, Stderr: io.Discard})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("StreamCommandOnNode() error = %v, want deadline exceeded", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("child process %d still running after timeout", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,326 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/structure-projects/somcli/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// CommandResult 命令执行结果
+type CommandResult struct {
+	Host     string
+	Command  string
+	Output   string // 合并的标准输出和标准错误
+	ExitCode int    // 未能获取退出码（如超时、连接断开）时为 -1
+	Duration time.Duration
+}
+
+// StreamOptions 流式执行选项
+type StreamOptions struct {
+	// Timeout 命令超时时间，为 0 时使用 command_timeout 配置，均未设置时不超时
+	Timeout time.Duration
+	// Stdout、Stderr 输出目标，默认为 os.Stdout 和 os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+var (
+	rootCtx, cancelRoot = context.WithCancel(context.Background())
+	runningCommands     sync.WaitGroup
+)
+
+// RootContext 进程级上下文，收到中断信号时取消
+func RootContext() context.Context {
+	return rootCtx
+}
+
+// CancelRunningCommands 取消所有流式执行中的命令，并最多等待 wait 让远程进程退出
+func CancelRunningCommands(wait time.Duration) {
+	cancelRoot()
+
+	done := make(chan struct{})
+	go func() {
+		runningCommands.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+}
+
+// CommandTimeout 流式命令默认超时时间，读取 command_timeout 配置
+func CommandTimeout() time.Duration {
+	return viper.GetDuration("command_timeout")
+}
+
+// StreamCommandOnNode 在节点上执行命令并逐行输出，每行带 [host] 前缀
+//
+// 超时或 ctx 取消时终止命令，返回的结果中包含退出码和耗时。远程命令在新会话中执行，
+// 取消时通过另一个会话终止整个进程组，sudo 等提权命令的子进程也会被终止。
+// 节点开启 become 时命令通过 sudo/doas 以 root 身份执行。
+func StreamCommandOnNode(ctx context.Context, node *types.RemoteNode, command string, opts StreamOptions) (*CommandResult, error) {
+	runningCommands.Add(1)
+	defer runningCommands.Done()
+
+	if opts.Timeout == 0 {
+		opts.Timeout = CommandTimeout()
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	host := node.Host
+	if host == "" {
+		host = nodeAddress(node)
+	}
+	result := &CommandResult{Host: host, Command: command, ExitCode: -1}
+
+	local := IsLocalNode(node)
+	runCommand, pidFile := command, ""
+	if !local {
+		pidFile = fmt.Sprintf("/tmp/somcli-stream-%s.pid", newRunID())
+		runCommand = processGroupCommand(command, pidFile)
+	}
+	wrapped, input, err := wrapBecome(node, runCommand)
+	if err != nil {
+		return result, err
+	}
+
+	var combined lockedBuffer
+	var mu sync.Mutex
+	stdout := &prefixWriter{prefix: "[" + host + "] ", out: opts.Stdout, mu: &mu, copy: &combined}
+	stderr := &prefixWriter{prefix: "[" + host + "] ", out: opts.Stderr, mu: &mu, copy: &combined}
+
+	PrintDebug("stream %s -> %s", host, RedactSecrets(command))
+	start := time.Now()
+	if local {
+		err = streamLocal(ctx, wrapped, input, stdout, stderr)
+	} else {
+		err = streamRemote(ctx, node, wrapped, input, pidFile, stdout, stderr)
+	}
+	stdout.Flush()
+	stderr.Flush()
+	result.Duration = time.Since(start)
+	result.Output = combined.String()
+	result.ExitCode = exitCode(err)
+	auditExec(auditNodeName(node), command, result.Output, result.ExitCode, result.Duration, err)
+
+	switch {
+	case err == nil:
+		PrintDebug("stream %s finished in %s", host, result.Duration.Round(time.Millisecond))
+		return result, nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("command timed out after %s: %w", opts.Timeout, ctx.Err())
+	case ctx.Err() != nil:
+		err = fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
+	return result, &CommandError{
+		Host:    host,
+		Command: command,
+		Detail:  fmt.Sprintf("exit code %d, %s", result.ExitCode, result.Duration.Round(time.Millisecond)),
+		Err:     err,
+	}
+}
+
+// streamLocal 在本机执行命令，取消时终止整个进程组
+func streamLocal(ctx context.Context, command, input string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd.Run()
+}
+
+// streamRemote 通过连接池在远程节点执行命令，取消时终止 pidFile 记录的进程组，再发送 KILL 信号并关闭会话
+func streamRemote(ctx context.Context, node *types.RemoteNode, command, input, pidFile string, stdout, stderr io.Writer) error {
+	session, err := defaultSSHPool.newSession(node)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if input != "" {
+		session.Stdin = strings.NewReader(input)
+	}
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		// 没有 pty 的会话收到 signal 请求时只有会话的 shell 收到信号，sudo -S sh -c 下的子进程不受影响，
+		// 因此先按进程组终止；OpenSSH 7.9 及以上支持 signal 请求，关闭会话后 sshd 也会关闭命令的管道
+		killRemoteProcessGroup(node, pidFile)
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		return ctx.Err()
+	}
+}
+
+// processGroupCommand 让命令在新会话中执行并将进程组号写入 pidFile，命令结束后删除 pidFile
+//
+// 节点没有支持 -w 的 setsid 时直接执行，取消时只能终止命令的 shell 进程。
+func processGroupCommand(command, pidFile string) string {
+	file := ShellQuote(pidFile)
+	inner := ShellQuote("echo $$ > " + file + "; sh -c " + ShellQuote(command) + "; rc=$?; rm -f " + file + "; exit $rc")
+	return "if setsid -w true >/dev/null 2>&1; then exec setsid -w sh -c " + inner + "; else exec sh -c " + inner + "; fi"
+}
+
+// killRemoteProcessGroup 通过新的会话终止 pidFile 记录的进程组，提权节点同样以 root 身份执行
+func killRemoteProcessGroup(node *types.RemoteNode, pidFile string) {
+	file := ShellQuote(pidFile)
+	command := "if [ -f " + file + " ]; then pid=$(cat " + file + "); kill -KILL -$pid 2>/dev/null || kill -KILL $pid 2>/dev/null; rm -f " + file + "; fi"
+	wrapped, input, err := wrapBecome(node, command)
+	if err != nil {
+		PrintDebug("kill %s process group: %v", node.Host, err)
+		return
+	}
+	session, err := defaultSSHPool.newSession(node)
+	if err != nil {
+		PrintDebug("kill %s process group: %v", node.Host, err)
+		return
+	}
+	defer session.Close()
+	if input != "" {
+		session.Stdin = strings.NewReader(input)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(wrapped)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			PrintDebug("kill %s process group: %v", node.Host, err)
+		}
+	case <-time.After(5 * time.Second):
+		PrintDebug("kill %s process group timed out", node.Host)
+	}
+}
+
+// exitCode 从执行错误中获取退出码
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var sshExit *ssh.ExitError
+	if errors.As(err, &sshExit) {
+		return sshExit.ExitStatus()
+	}
+	var execExit *exec.ExitError
+	if errors.As(err, &execExit) && execExit.ExitCode() >= 0 {
+		return execExit.ExitCode()
+	}
+	return -1
+}
+
+// prefixWriter 按行输出并添加前缀，同时保留一份完整输出
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex // 标准输出和标准错误共用，避免行交错
+	copy   io.Writer
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.copy.Write(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf[:i]), "\r")
+		fmt.Fprintf(w.out, "%s%s\n", w.prefix, RedactSecrets(line))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush 输出最后不完整的一行
+func (w *prefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		fmt.Fprintf(w.out, "%s%s\n", w.prefix, RedactSecrets(string(w.buf)))
+		w.buf = nil
+	}
+}
+
+// lockedBuffer 并发安全的 bytes.Buffer
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+// NodeFacts 节点的系统信息
+type NodeFacts struct {
+	Platform string // 操作系统，如 linux
+	Arch     string // 架构，使用 Go 的命名，如 amd64、arm64
+	Distro   string // 发行版，/etc/os-release 中的 ID，如 ubuntu、centos
+}
+
+var (
+	nodeFactsMu    sync.Mutex
+	nodeFactsCache = make(map[string]NodeFacts)
+)
+
+// 节点架构名称到 Go 架构名称的映射，与本机的 Arch 保持一致
+var unameArch = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"armv7l":  "arm",
+	"i386":    "386",
+	"i686":    "386",
+}
+
+// GatherNodeFacts 获取节点的系统信息，远程节点的结果在本次运行中缓存
+func GatherNodeFacts(executor Executor, node *types.RemoteNode) (NodeFacts, error) {
+	if IsLocalNode(node) {
+		return NodeFacts{Platform: GetPlatform(), Arch: GetArch(), Distro: GetDistroInfo()["ID"]}, nil
+	}
+
+	key := nodeAddress(node)
+	nodeFactsMu.Lock()
+	facts, ok := nodeFactsCache[key]
+	nodeFactsMu.Unlock()
+	if ok {
+		return facts, nil
+	}
+
+	output, err := executor.Run(node, `uname -s; uname -m; (. /etc/os-release 2>/dev/null && echo "$ID")`)
+	if err != nil {
+		return NodeFacts{}, fmt.Errorf("gather facts on %s failed: %w", node.Host, err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+	facts = NodeFacts{
+		Platform: strings.ToLower(strings.TrimSpace(lines[0])),
+		Arch:     strings.TrimSpace(lines[1]),
+		Distro:   strings.TrimSpace(lines[2]),
+	}
+	if arch, ok := unameArch[facts.Arch]; ok {
+		facts.Arch = arch
+	}
+
+	nodeFactsMu.Lock()
+	nodeFactsCache[key] = facts
+	nodeFactsMu.Unlock()
+	return facts, nil
+}
+
+// TemplateData 模板渲染上下文
+//
+// 引用未定义的字段、变量（.Vars.x）或环境变量（.Env.X）时渲染失败。
+type TemplateData map[string]interface{}
+
+// NewTemplateData 创建资源在节点上的渲染上下文，node 为空时使用本机
+func NewTemplateData(res types.Resource, node *types.RemoteNode, facts NodeFacts) TemplateData {
+	if node == nil {
+		node = LocalNode()
+	}
+	roles := node.Roles
+	if len(roles) == 0 && node.Role != "" {
+		roles = []string{node.Role}
+	}
+	vars := make(map[string]string, len(Config.Vars)+len(res.Vars))
+	for name, value := range Config.Vars {
+		vars[name] = value
+	}
+	for name, value := range res.Vars {
+		vars[name] = value
+	}
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+
+	return TemplateData{
+		"Name":        res.Name,
+		"Version":     res.Version,
+		"Platform":    facts.Platform,
+		"Arch":        facts.Arch,
+		"Distro":      facts.Distro,
+		"Host":        node.Host,
+		"IP":          node.IP,
+		"Roles":       roles,
+		"Vars":        vars,
+		"Env":         env,
+		"DownloadDir": GetDownloadDir(),
+		"AppDir":      GetAppDir(),
+		"HostDir":     GetHomeDir(),
+		"WorkDir":     GetWorkDir(),
+		"DataDir":     GetDataDir(),
+		"TmpDir":      GetTmpDir(),
+		"ImagesDir":   GetImagesDir(),
+		"ScriptDir":   GetScriptDir(),
+		"CacheDir":    filepath.Join(GetDownloadDir(), res.Name, res.Version),
+	}
+}
+
+// NodeTemplateData 获取节点信息并创建资源在该节点上的渲染上下文
+func NodeTemplateData(executor Executor, node *types.RemoteNode, res types.Resource) (TemplateData, error) {
+	facts, err := GatherNodeFacts(executor, node)
+	if err != nil {
+		return nil, err
+	}
+	return NewTemplateData(res, node, facts), nil
+}
+
+// WithURL 返回增加了下载地址文件名 Filename 和扩展名 Ext 的上下文
+func (d TemplateData) WithURL(url string) TemplateData {
+	data := make(TemplateData, len(d)+2)
+	for key, value := range d {
+		data[key] = value
+	}
+	data["Filename"] = filepath.Base(url)
+	data["Ext"] = filepath.Ext(url)
+	return data
+}
+
+// Render 渲染模板
+func (d TemplateData) Render(tmpl string) (string, error) {
+	tpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// 模板辅助函数，参数顺序与 sprig 相同，便于在管道中使用
+var templateFuncs = template.FuncMap{
+	"default":    defaultValue,
+	"empty":      isEmpty,
+	"env":        os.Getenv,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"join":       func(sep string, list []string) string { return strings.Join(list, sep) },
+	"has":        func(item string, list []string) bool { return StringInSlice(item, list) },
+}
+
+// defaultValue value 为空时返回 def，如 {{ env "REGISTRY" | default "docker.io" }}
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || isEmpty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// isEmpty 判断值是否为零值、空字符串或空集合
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// ParseStr 使用本机信息渲染模板，用于下载等在本机执行的步骤
+func ParseStr(tmpl string, res types.Resource) (string, error) {
+	return localTemplateData(res).Render(tmpl)
+}
+
+// ParseTargetPath 使用本机信息渲染下载目标路径，可以使用下载地址的 Filename 和 Ext
+func ParseTargetPath(tmpl, url string, res types.Resource) (string, error) {
+	return localTemplateData(res).WithURL(url).Render(tmpl)
+}
+
+// ParseNodeStr 使用目标节点的信息渲染模板
+func ParseNodeStr(executor Executor, node *types.RemoteNode, tmpl string, res types.Resource) (string, error) {
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl, nil
+	}
+	data, err := NodeTemplateData(executor, node, res)
+	if err != nil {
+		return "", err
+	}
+	return data.Render(tmpl)
+}
+
+// localTemplateData 本机的渲染上下文
+func localTemplateData(res types.Resource) TemplateData {
+	facts, _ := GatherNodeFacts(nil, LocalNode())
+	return NewTemplateData(res, nil, facts)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+func TestGatherNodeFacts(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		err     error
+		want    NodeFacts
+		wantErr bool
+	}{
+		{name: "ubuntu amd64", output: "Linux\nx86_64\nubuntu\n", want: NodeFacts{Platform: "linux", Arch: "amd64", Distro: "ubuntu"}},
+		{name: "centos arm64", output: "Linux\naarch64\ncentos\n", want: NodeFacts{Platform: "linux", Arch: "arm64", Distro: "centos"}},
+		{name: "unknown arch without os-release", output: "Linux\nriscv64\n", want: NodeFacts{Platform: "linux", Arch: "riscv64"}},
+		{name: "command failed", err: errors.New("exit status 1"), wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 每个用例使用不同的地址，避免命中缓存
+			node := &types.RemoteNode{Host: "facts-node", IP: "203.0.113." + string(rune('1'+i))}
+			fake := NewFakeExecutor().On("uname -s", tt.output, tt.err)
+
+			got, err := GatherNodeFacts(fake, node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GatherNodeFacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GatherNodeFacts() = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if _, err := GatherNodeFacts(fake, node); err != nil {
+				t.Fatal(err)
+			}
+			if calls := fake.Calls(); len(calls) != 1 {
+				t.Errorf("facts should be cached per node, got %d calls", len(calls))
+			}
+		})
+	}
+}
+
+func TestParseNodeStr(t *testing.T) {
+	previousVars := Config.Vars
+	Config.Vars = map[string]string{"registry": "registry.example.com", "port": "8080"}
+	t.Cleanup(func() { Config.Vars = previousVars })
+	t.Setenv("SOMCLI_TEST_MIRROR", "mirror.example.com")
+	t.Setenv("SOMCLI_TEST_EMPTY", "")
+
+	res := types.Resource{Name: "demo", Version: "1.2.3", Vars: map[string]string{"port": "9090"}}
+	master := &types.RemoteNode{Host: "master-01", IP: "198.51.100.11", Roles: []string{"master", "etcd"}}
+	worker := &types.RemoteNode{Host: "worker-01", IP: "198.51.100.21", Role: "worker"}
+	fake := NewFakeExecutor().
+		OnNode("master-01", "uname -s", "Linux\nx86_64\nubuntu\n", nil).
+		OnNode("worker-01", "uname -s", "Linux\naarch64\ncentos\n", nil)
+
+	tests := []struct {
+		name    string
+		node    *types.RemoteNode
+		tmpl    string
+		want    string
+		wantErr string
+	}{
+		{name: "plain string", node: master, tmpl: "no template", want: "no template"},
+		{name: "arch per node", node: master, tmpl: "demo-{{ .Version }}-{{ .Platform }}-{{ .Arch }}", want: "demo-1.2.3-linux-amd64"},
+		{name: "arch on arm node", node: worker, tmpl: "demo-{{ .Version }}-{{ .Platform }}-{{ .Arch }}", want: "demo-1.2.3-linux-arm64"},
+		{name: "distro", node: worker, tmpl: "{{ if eq .Distro \"centos\" }}yum{{ else }}apt{{ end }}", want: "yum"},
+		{name: "roles", node: master, tmpl: "{{ join \",\" .Roles }}", want: "master,etcd"},
+		{name: "single role", node: worker, tmpl: "{{ .Roles }}", want: "[worker]"},
+		{name: "has role", node: master, tmpl: "{{ if has \"master\" .Roles }}control-plane{{ end }}", want: "control-plane"},
+		{name: "host and ip", node: worker, tmpl: "{{ .Host }}={{ .IP }}", want: "worker-01=198.51.100.21"},
+		{name: "config vars", node: master, tmpl: "{{ .Vars.registry }}", want: "registry.example.com"},
+		{name: "resource vars override config vars", node: master, tmpl: "{{ .Vars.port }}", want: "9090"},
+		{name: "env field", node: master, tmpl: "{{ .Env.SOMCLI_TEST_MIRROR }}", want: "mirror.example.com"},
+		{name: "env function with default", node: master, tmpl: "{{ env \"SOMCLI_TEST_EMPTY\" | default \"docker.io\" }}", want: "docker.io"},
+		{name: "default keeps value", node: master, tmpl: "{{ .Vars.registry | default \"docker.io\" }}", want: "registry.example.com"},
+		{name: "string helpers", node: master, tmpl: "{{ \" V1.2 \" | trim | lower | trimPrefix \"v\" | replace \".\" \"-\" | upper }}", want: "1-2"},
+		{name: "contains and trimSuffix", node: master, tmpl: "{{ if contains \"rc\" \"v1-rc\" }}{{ trimSuffix \"-rc\" \"v1-rc\" }}{{ end }}", want: "v1"},
+		{name: "empty", node: worker, tmpl: "{{ if empty .Vars.registry }}unset{{ else }}set{{ end }}", want: "set"},
+		{name: "undefined var", node: master, tmpl: "{{ .Vars.missing }}", wantErr: "missing"},
+		{name: "undefined env", node: master, tmpl: "{{ .Env.SOMCLI_TEST_UNDEFINED }}", wantErr: "SOMCLI_TEST_UNDEFINED"},
+		{name: "undefined field", node: master, tmpl: "{{ .Nope }}", wantErr: "Nope"},
+		{name: "syntax error", node: master, tmpl: "{{ .Name ", wantErr: "unclosed action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNodeStr(fake, tt.node, tt.tmpl, res)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseNodeStr() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNodeStr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseNodeStr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTargetPath(t *testing.T) {
+	res := types.Resource{Name: "demo", Version: "1.2.3"}
+	got, err := ParseTargetPath("{{ .Name }}/{{ .Filename }}|{{ .Ext }}", "https://example.com/demo.tar.gz", res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "demo/demo.tar.gz|.gz"; got != want {
+		t.Errorf("ParseTargetPath() = %q, want %q", got, want)
+	}
+}
@@ -16,7 +16,6 @@ limitations under the License.
 package utils
 
 import (
-	"bytes"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -24,7 +23,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
-	"html/template"
 	"io"
 	"net/url"
 	"os"
@@ -189,101 +187,6 @@ func NormalizeVersion(version string) string {
 	return version
 }
 
-// 公共解析
-func ParseStr(tmpl string, res types.Resource) (string, error) {
-	tpl, err := template.New("").Parse(tmpl)
-
-	if err != nil {
-		return "", err
-	}
-
-	data := struct {
-		Name        string
-		Version     string
-		Platform    string
-		Arch        string
-		DownloadDir string
-		AppDir      string
-		HostDir     string
-		WorkDir     string
-		DataDir     string
-		TmpDir      string
-		ImagesDir   string
-		ScriptDir   string
-		CacheDir    string
-	}{
-		Name:        res.Name,
-		Version:     res.Version,
-		Platform:    GetPlatform(),
-		Arch:        GetArch(),
-		DownloadDir: GetDownloadDir(),
-		AppDir:      GetAppDir(),
-		HostDir:     GetHomeDir(),
-		WorkDir:     GetWorkDir(),
-		DataDir:     GetDataDir(),
-		TmpDir:      GetTmpDir(),
-		ImagesDir:   GetImagesDir(),
-		ScriptDir:   GetScriptDir(),
-		CacheDir:    filepath.Join(GetDownloadDir(), res.Name, res.Version),
-	}
-
-	var buf bytes.Buffer
-	if err := tpl.Execute(&buf, data); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
-
-// --- 内部辅助函数 ---
-
-func ParseTargetPath(tmpl, url string, res types.Resource) (string, error) {
-
-	tpl, err := template.New("").Parse(tmpl)
-	if err != nil {
-		return "", err
-	}
-
-	data := struct {
-		Name        string
-		Version     string
-		Platform    string
-		Arch        string
-		DownloadDir string
-		AppDir      string
-		HostDir     string
-		WorkDir     string
-		DataDir     string
-		TmpDir      string
-		ImagesDir   string
-		ScriptDir   string
-		CacheDir    string
-		Filename    string
-		Ext         string
-	}{
-		Name:        res.Name,
-		Version:     res.Version,
-		Platform:    GetPlatform(),
-		Arch:        GetArch(),
-		DownloadDir: GetDownloadDir(),
-		AppDir:      GetAppDir(),
-		HostDir:     GetHomeDir(),
-		WorkDir:     GetWorkDir(),
-		DataDir:     GetDataDir(),
-		TmpDir:      GetTmpDir(),
-		ImagesDir:   GetImagesDir(),
-		ScriptDir:   GetScriptDir(),
-		CacheDir:    filepath.Join(GetDownloadDir(), res.Name, res.Version),
-		Filename:    filepath.Base(url),
-		Ext:         filepath.Ext(url),
-	}
-
-	var buf bytes.Buffer
-	if err := tpl.Execute(&buf, data); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
-
 func SetEnv(name string, value string) {
 	err := os.Setenv(name, value)
 	if err != nil {
@@ -303,32 +206,84 @@ func IsOffline() bool {
 
 var Config types.ResourceConfig
 
-// 加载配置文件
+// 加载配置文件，支持多文档格式，文件中的代理、节点和 SSH 默认值覆盖全局配置
 func LoadConfig(path string) (*types.ResourceConfig, error) {
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyManifest(manifest), nil
+}
+
+// ApplyManifest 将配置中的代理、节点和 SSH 默认值合并到全局配置
+func ApplyManifest(manifest *types.Manifest) *types.ResourceConfig {
+	config := ManifestResourceConfig(manifest)
+	if config.Proxy != "" {
+		Config.Proxy = config.Proxy
+	}
+	if len(config.Nodes) > 0 {
+		Config.Nodes = config.Nodes
+	}
+	if config.SSH != (types.SSHDefaults{}) {
+		Config.SSH = config.SSH
+	}
+	if len(config.Vars) > 0 {
+		Config.Vars = config.Vars
+	}
+	Config.Resources = config.Resources
+	ApplySSHDefaults(Config.Nodes, Config.SSH)
+
+	return &Config
+}
+
+// LoadNodes 从节点清单文件加载节点，支持顶层 nodes 和集群配置中的 cluster.nodes
+func LoadNodes(path string) ([]types.RemoteNode, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data, &Config); err != nil {
+	var inventory struct {
+		Nodes   []types.RemoteNode `yaml:"nodes"`
+		SSH     types.SSHDefaults  `yaml:"ssh"`
+		Cluster struct {
+			Nodes []types.RemoteNode `yaml:"nodes"`
+			SSH   types.SSHDefaults  `yaml:"ssh"`
+		} `yaml:"cluster"`
+	}
+	if err := yaml.Unmarshal(data, &inventory); err != nil {
 		return nil, err
 	}
 
-	return &Config, nil
+	ApplySSHDefaults(inventory.Nodes, inventory.SSH)
+	ApplySSHDefaults(inventory.Cluster.Nodes, inventory.Cluster.SSH)
+	return append(inventory.Nodes, inventory.Cluster.Nodes...), nil
 }
 
 func SetNode(nodes []types.RemoteNode) {
 	Config.Nodes = nodes
 }
-func GetNode(hostname string) types.RemoteNode {
 
-	for _, host := range Config.Nodes {
-		if host.Host == hostname || host.IP == hostname {
-			return host
+// AddNodes 将节点加入节点清单，host 或 ip 与已有节点相同时替换已有节点，
+// 集群配置中的 SSH 和角色设置优先于全局节点清单
+func AddNodes(nodes []types.RemoteNode) {
+	for _, node := range nodes {
+		merged := make([]types.RemoteNode, 0, len(Config.Nodes)+1)
+		replaced := false
+		for _, existing := range Config.Nodes {
+			if (node.Host != "" && existing.Host == node.Host) || (node.IP != "" && existing.IP == node.IP) {
+				if !replaced {
+					merged = append(merged, node)
+					replaced = true
+				}
+				continue
+			}
+			merged = append(merged, existing)
 		}
-	}
-	return types.RemoteNode{
-		IP: "127.0.0.1",
+		if !replaced {
+			merged = append(merged, node)
+		}
+		Config.Nodes = merged
 	}
 }
 
@@ -402,7 +357,7 @@ func CalculateLocalHash(filePath string, hashFn func() hash.Hash) (string, error
 }
 
 // GetRemoteFileChecksum 远程获取文件的 checksum (默认为 sha256)
-func GetRemoteFileChecksum(user, ip, keyPath, filePath string, algo ...string) (string, error) {
+func GetRemoteFileChecksum(node *types.RemoteNode, filePath string, algo ...string) (string, error) {
 	// 默认使用 sha256sum，也可以指定其他算法
 	checksumAlgo := "sha256sum"
 	if len(algo) > 0 {
@@ -420,22 +375,22 @@ func GetRemoteFileChecksum(user, ip, keyPath, filePath string, algo ...string) (
 		}
 	}
 
-	// 构建远程命令
-	cmd := fmt.Sprintf("%s %s | awk '{print $1}'", checksumAlgo, filePath)
+	// 构建远程命令，不经过管道以便文件不存在时返回非零退出码
+	cmd := fmt.Sprintf("%s %s", checksumAlgo, ShellQuote(filePath))
 
 	// 执行远程命令
-	output, err := SSHMCmd(user, ip, keyPath, cmd)
+	output, err := SSHMCmd(node, cmd)
 	if err != nil {
 		return "", fmt.Errorf("获取远程文件 checksum 失败: %w", err)
 	}
 
-	// 清理输出结果
-	checksum := strings.TrimSpace(output)
-	if checksum == "" {
+	// 输出格式为 "<checksum>  <文件名>"
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
 		return "", fmt.Errorf("远程文件不存在或 checksum 计算失败")
 	}
 
-	return checksum, nil
+	return fields[0], nil
 }
 
 // parseChecksum 解析校验和字符串
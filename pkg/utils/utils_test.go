@@ -0,0 +1,49 @@
+/*
+Copyright 2023 Structure Projects
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/structure-projects/somcli/pkg/types"
+)
+
+func TestAddNodes(t *testing.T) {
+	previous := Config.Nodes
+	t.Cleanup(func() { Config.Nodes = previous })
+
+	Config.Nodes = []types.RemoteNode{
+		{Host: "node-01", IP: "192.0.2.11", User: "admin"},
+		{Host: "node-02", IP: "192.0.2.12", User: "admin"},
+		{Host: "old-03", IP: "192.0.2.13", User: "admin"},
+	}
+	AddNodes([]types.RemoteNode{
+		{Host: "node-01", IP: "192.0.2.11", User: "root", Role: "master"},
+		{Host: "node-03", IP: "192.0.2.13", User: "root", Role: "worker"},
+		{Host: "node-04", IP: "192.0.2.14", User: "root", Role: "worker"},
+	})
+
+	want := []types.RemoteNode{
+		{Host: "node-01", IP: "192.0.2.11", User: "root", Role: "master"},
+		{Host: "node-02", IP: "192.0.2.12", User: "admin"},
+		{Host: "node-03", IP: "192.0.2.13", User: "root", Role: "worker"},
+		{Host: "node-04", IP: "192.0.2.14", User: "root", Role: "worker"},
+	}
+	if !reflect.DeepEqual(Config.Nodes, want) {
+		t.Errorf("Config.Nodes =\n%+v\nwant\n%+v", Config.Nodes, want)
+	}
+}